@@ -0,0 +1,375 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/avro"
+	"github.com/apache/arrow-go/v18/arrow/extensions"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+	hamba "github.com/hamba/avro/v2"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/tidwall/gjson"
+)
+
+// readAvroSchema converts the writer schema embedded in an Avro object
+// container file header to an Arrow schema.
+func (c *Client) readAvroSchema(ctx context.Context, key string) (*arrow.Schema, error) {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	r, err := newAvroReader(body, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avro schema for %s: %w", key, err)
+	}
+	defer r.Close()
+
+	return avroToCQSchema(r.Schema()), nil
+}
+
+// streamAvroRecords streams the data blocks of an Avro object container file
+// as Arrow record batches of at most batchSize rows. The version id of the
+// object read is stored in versionID if it is not nil.
+func (c *Client) streamAvroRecords(ctx context.Context, key string, batchSize int, versionID *string, records chan<- arrow.RecordBatch) error {
+	body, err := c.openObjectVersion(ctx, key, versionID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := readAvroRecords(ctx, body, batchSize, records); err != nil {
+		return fmt.Errorf("error reading records from %s: %w", key, err)
+	}
+	return nil
+}
+
+// readAvroRecords decodes an Avro object container file into Arrow record
+// batches of at most batchSize rows. Decode errors after the first batch was
+// sent fail the sync rather than marking the object malformed.
+func readAvroRecords(ctx context.Context, r io.Reader, batchSize int, records chan<- arrow.RecordBatch) error {
+	framing := &avroFraming{}
+	ar, err := newAvroReader(io.TeeReader(r, framing), batchSize)
+	if err != nil {
+		return err
+	}
+	// Close stops the reader's decoding goroutines if we return early.
+	defer ar.Close()
+
+	sc := avroToCQSchema(ar.Schema())
+	emitted := false
+	for ar.Next() {
+		rec := avroToCQRecord(ar.RecordBatch(), sc)
+		select {
+		case records <- rec:
+			emitted = true
+		case <-ctx.Done():
+			rec.Release()
+			return ctx.Err()
+		}
+	}
+	if err := ar.Err(); err != nil {
+		return partialObjectError(fmt.Errorf("%w: %v", errMalformedObject, err), emitted)
+	}
+	if err := framing.check(); err != nil {
+		return partialObjectError(fmt.Errorf("%w: %v", errMalformedObject, err), emitted)
+	}
+	return nil
+}
+
+// errAvroShort reports that more bytes are needed to parse an Avro value.
+var errAvroShort = errors.New("short avro buffer")
+
+// avroFraming checks the block framing of an Avro object container file as
+// it is written to it. The Arrow OCF reader stops without an error at a
+// truncated or corrupt block, so the file must also end after a complete
+// block for its rows to be complete.
+type avroFraming struct {
+	buf     []byte // bytes not parsed yet
+	header  bool   // whether the header was parsed
+	sync    []byte
+	skip    int64 // data bytes of the current block still to come
+	inBlock bool  // whether the sync marker of the current block is next
+	err     error
+}
+
+func (f *avroFraming) Write(p []byte) (int, error) {
+	n := len(p)
+	if f.err != nil {
+		return n, nil
+	}
+	if len(f.buf) == 0 && f.skip > 0 {
+		k := min(int64(len(p)), f.skip)
+		p, f.skip = p[k:], f.skip-k
+	}
+	f.buf = append(f.buf, p...)
+	f.err = f.parse()
+	return n, nil
+}
+
+// parse consumes the complete framing elements at the start of f.buf.
+func (f *avroFraming) parse() error {
+	for {
+		if f.skip > 0 {
+			if len(f.buf) == 0 {
+				return nil
+			}
+			k := min(int64(len(f.buf)), f.skip)
+			f.buf, f.skip = f.buf[k:], f.skip-k
+			continue
+		}
+		var (
+			n   int
+			err error
+		)
+		switch {
+		case !f.header:
+			n, err = f.parseHeader()
+		case f.inBlock:
+			if len(f.buf) < len(f.sync) {
+				return nil
+			}
+			if !bytes.Equal(f.buf[:len(f.sync)], f.sync) {
+				return errors.New("invalid sync marker after a block")
+			}
+			n, f.inBlock = len(f.sync), false
+		default:
+			var count, size int64
+			r := avroBytes(f.buf)
+			if count, err = r.long(); err == nil {
+				size, err = r.long()
+			}
+			if err != nil {
+				break
+			}
+			if count < 0 || size < 0 {
+				return fmt.Errorf("invalid block of %d rows and %d bytes", count, size)
+			}
+			n, f.skip, f.inBlock = len(f.buf)-len(r), size, true
+		}
+		if err == errAvroShort || (err == nil && n == 0) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		f.buf = f.buf[n:]
+	}
+}
+
+// parseHeader parses the magic, metadata and sync marker of the file.
+func (f *avroFraming) parseHeader() (int, error) {
+	r := avroBytes(f.buf)
+	magic, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	if string(magic) != "Obj\x01" {
+		return 0, errors.New("not an avro object container file")
+	}
+	for {
+		count, err := r.long()
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			break
+		}
+		if count < 0 {
+			count = -count
+			if _, err := r.long(); err != nil {
+				return 0, err
+			}
+		}
+		// Every entry is a string key and a bytes value.
+		for i := int64(0); i < 2*count; i++ {
+			size, err := r.long()
+			if err != nil {
+				return 0, err
+			}
+			if size < 0 {
+				return 0, errors.New("invalid header metadata")
+			}
+			if _, err := r.next(size); err != nil {
+				return 0, err
+			}
+		}
+	}
+	sync, err := r.next(16)
+	if err != nil {
+		return 0, err
+	}
+	f.sync, f.header = bytes.Clone(sync), true
+	return len(f.buf) - len(r), nil
+}
+
+// check returns an error unless the file ended after a complete block.
+func (f *avroFraming) check() error {
+	switch {
+	case f.err != nil:
+		return f.err
+	case !f.header || f.inBlock || f.skip > 0 || len(f.buf) > 0:
+		return errors.New("file ends within a block")
+	}
+	return nil
+}
+
+// avroBytes reads Avro values from the start of a buffer.
+type avroBytes []byte
+
+// long reads a zigzag varint.
+func (b *avroBytes) long() (int64, error) {
+	v, n := binary.Varint(*b)
+	if n == 0 {
+		return 0, errAvroShort
+	}
+	if n < 0 {
+		return 0, errors.New("invalid varint")
+	}
+	*b = (*b)[n:]
+	return v, nil
+}
+
+// next reads n bytes.
+func (b *avroBytes) next(n int64) ([]byte, error) {
+	if int64(len(*b)) < n {
+		return nil, errAvroShort
+	}
+	v := (*b)[:n]
+	*b = (*b)[n:]
+	return v, nil
+}
+
+// newAvroReader reads the container header from r and returns an OCF reader
+// for the whole stream. Unions of null and one other type are rewritten so
+// that null is the first branch, which the Arrow converter requires to map
+// them to nullable columns; Avro writers commonly emit ["long", "null"] when
+// the field has a non-null default.
+func newAvroReader(r io.Reader, batchSize int) (*avro.OCFReader, error) {
+	// Buffer everything the header decoder consumes so the OCF reader can
+	// decode the same stream from the beginning.
+	var header bytes.Buffer
+	dec, err := ocf.NewDecoder(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid avro container header: %v", errMalformedObject, err)
+	}
+	writerSchema, err := hamba.Parse(string(dec.Metadata()["avro.schema"]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid avro schema: %v", errMalformedObject, err)
+	}
+
+	opts := []avro.Option{avro.WithChunk(batchSize)}
+	for _, e := range nullableUnionEdits(writerSchema.String()) {
+		opts = append(opts, avro.WithSchemaEdit("set", e.path, e.value))
+	}
+	ar, err := avro.NewOCFReader(io.MultiReader(&header, r), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errMalformedObject, err)
+	}
+	return ar, nil
+}
+
+// avroSchemaEdit replaces the JSON value at path in a canonical Avro schema.
+type avroSchemaEdit struct {
+	path  string
+	value json.RawMessage
+}
+
+// nullableUnionEdits returns the edits that move "null" to the first branch
+// of every union in the canonical schema doc. Edits are ordered so that each
+// path is valid after the preceding edits have been applied.
+func nullableUnionEdits(doc string) []avroSchemaEdit {
+	var edits []avroSchemaEdit
+	collectNullableUnionEdits(gjson.Parse(doc), "", &edits)
+	return edits
+}
+
+func collectNullableUnionEdits(node gjson.Result, path string, edits *[]avroSchemaEdit) {
+	join := func(elem string) string {
+		if path == "" {
+			return elem
+		}
+		return path + "." + elem
+	}
+
+	switch {
+	case node.IsArray():
+		branches := node.Array()
+		for i, b := range branches {
+			if i > 0 && b.Type == gjson.String && b.Str == "null" {
+				branches = append([]gjson.Result{b}, append(branches[:i:i], branches[i+1:]...)...)
+				raws := make([]string, len(branches))
+				for j, b := range branches {
+					raws[j] = b.Raw
+				}
+				*edits = append(*edits, avroSchemaEdit{
+					path:  path,
+					value: json.RawMessage("[" + strings.Join(raws, ",") + "]"),
+				})
+				break
+			}
+		}
+		for i, b := range branches {
+			collectNullableUnionEdits(b, join(strconv.Itoa(i)), edits)
+		}
+	case node.IsObject():
+		switch node.Get("type").Str {
+		case "record", "error":
+			for i, f := range node.Get("fields").Array() {
+				collectNullableUnionEdits(f.Get("type"), join("fields."+strconv.Itoa(i)+".type"), edits)
+			}
+		case "array":
+			collectNullableUnionEdits(node.Get("items"), join("items"), edits)
+		case "map":
+			collectNullableUnionEdits(node.Get("values"), join("values"), edits)
+		}
+	}
+}
+
+// avroToCQSchema replaces Arrow's canonical UUID extension type on top-level
+// columns with the CloudQuery UUID type so destinations store them as UUIDs.
+func avroToCQSchema(sc *arrow.Schema) *arrow.Schema {
+	fields := sc.Fields()
+	changed := false
+	for i, f := range fields {
+		if _, ok := f.Type.(*extensions.UUIDType); ok {
+			fields[i].Type = types.ExtensionTypes.UUID
+			changed = true
+		}
+	}
+	if !changed {
+		return sc
+	}
+	md := sc.Metadata()
+	return arrow.NewSchema(fields, &md)
+}
+
+// avroToCQRecord returns rec with its columns rewrapped to match sc, as built
+// by avroToCQSchema. The returned record is owned by the caller.
+func avroToCQRecord(rec arrow.RecordBatch, sc *arrow.Schema) arrow.RecordBatch {
+	if rec.Schema().Equal(sc) {
+		rec.Retain()
+		return rec
+	}
+	cols := make([]arrow.Array, rec.NumCols())
+	for i := range cols {
+		col := rec.Column(i)
+		if ext, ok := col.(array.ExtensionArray); ok && !arrow.TypeEqual(col.DataType(), sc.Field(i).Type) {
+			col = array.NewExtensionArrayWithStorage(sc.Field(i).Type.(arrow.ExtensionType), ext.Storage())
+			defer col.Release()
+		}
+		cols[i] = col
+	}
+	return array.NewRecordBatch(sc, cols, rec.NumRows())
+}
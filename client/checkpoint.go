@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/v4/state"
+)
+
+// checkpointer records the progress of a table's sync in the state backend
+// while its objects are synced, every checkpoint_objects objects or
+// checkpoint_interval, so a sync that stops midway resumes after the objects
+// it already emitted instead of reading the whole table again.
+//
+// Objects are synced in LastModified order. The cursor only advances to a
+// time at or before which every object has been emitted, so objects still
+// being read concurrently are never skipped; processed-object sets and ETags
+// record each emitted object.
+type checkpointer struct {
+	c           *Client
+	stateClient state.Client
+	table       string
+
+	// objects are the selected objects of the table sorted by LastModified;
+	// times holds their parsed LastModified, zero if it cannot be parsed.
+	objects []S3Object
+	times   []time.Time
+	index   map[string]int
+
+	processed *ProcessedObjects
+	etags     map[string]string
+
+	mu      sync.Mutex
+	done    []bool
+	next    int
+	pending []S3Object
+	cursor  time.Time
+	saved   time.Time
+}
+
+// newCheckpointer returns a checkpointer for the selected objects of a table,
+// which it sorts by LastModified. Objects of selected that are not synced
+// start done. processed and etags are nil unless their mode is enabled.
+func (c *Client) newCheckpointer(stateClient state.Client, table string, selected, synced []S3Object, processed *ProcessedObjects, etags map[string]string) *checkpointer {
+	cp := &checkpointer{
+		c:           c,
+		stateClient: stateClient,
+		table:       table,
+		objects:     sortByLastModified(selected),
+		index:       make(map[string]int, len(selected)),
+		processed:   processed,
+		etags:       etags,
+		done:        make([]bool, len(selected)),
+		saved:       time.Now(),
+	}
+	cp.times = make([]time.Time, len(cp.objects))
+	for i, obj := range cp.objects {
+		cp.times[i], _ = time.Parse(time.RFC3339Nano, obj.LastModified)
+		cp.index[obj.Key] = i
+		cp.done[i] = true
+	}
+	for _, obj := range synced {
+		cp.done[cp.index[obj.Key]] = false
+	}
+	cp.advance()
+	return cp
+}
+
+// sortByLastModified returns a copy of objects sorted by LastModified.
+func sortByLastModified(objects []S3Object) []S3Object {
+	sorted := slices.Clone(objects)
+	slices.SortStableFunc(sorted, func(a, b S3Object) int {
+		ta, _ := time.Parse(time.RFC3339Nano, a.LastModified)
+		tb, _ := time.Parse(time.RFC3339Nano, b.LastModified)
+		return ta.Compare(tb)
+	})
+	return sorted
+}
+
+// ordered returns the objects to sync in LastModified order.
+func (cp *checkpointer) ordered() []S3Object {
+	var ordered []S3Object
+	for i, obj := range cp.objects {
+		if !cp.done[i] {
+			ordered = append(ordered, obj)
+		}
+	}
+	return ordered
+}
+
+// objectDone records that an object has been emitted and checkpoints if
+// enough objects or time have passed since the last checkpoint.
+func (cp *checkpointer) objectDone(ctx context.Context, obj S3Object) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if i, ok := cp.index[obj.Key]; ok {
+		cp.done[i] = true
+	}
+	cp.pending = append(cp.pending, obj)
+	cp.advance()
+
+	every := cp.c.spec.CheckpointObjects
+	interval := cp.c.spec.checkpointInterval()
+	if (every > 0 && len(cp.pending) >= every) || (interval > 0 && time.Since(cp.saved) >= interval) {
+		cp.save(ctx, nil)
+		if err := cp.stateClient.Flush(ctx); err != nil {
+			cp.c.logger.Warn().Err(err).Str("table", cp.table).Msg("failed to flush checkpoint")
+		}
+	}
+}
+
+// advance moves next past the objects that are done and the cursor to the
+// latest time at or before which every object is done.
+func (cp *checkpointer) advance() {
+	for cp.next < len(cp.objects) && cp.done[cp.next] {
+		cp.next++
+	}
+	i := cp.next - 1
+	if cp.next < len(cp.objects) {
+		for i >= 0 && !cp.times[i].Before(cp.times[cp.next]) {
+			i--
+		}
+	}
+	if i >= 0 && cp.times[i].After(cp.cursor) {
+		cp.cursor = cp.times[i]
+	}
+}
+
+// finish records the state of a table whose sync has completed. listed are
+// all objects of the table; ETags of keys no longer listed are dropped.
+// Objects that were not emitted, such as those skipped by the schema_mismatch
+// policy, are not recorded, and the cursor stays before them.
+func (cp *checkpointer) finish(ctx context.Context, listed []S3Object) {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	cp.save(ctx, listed)
+}
+
+// save writes the table's state for the objects done so far. If listed is
+// not nil, ETags of keys not in it are dropped.
+func (cp *checkpointer) save(ctx context.Context, listed []S3Object) {
+	scope := cp.c.stateScope()
+	logger := cp.c.logger.With().Str("table", cp.table).Logger()
+	cp.saved = time.Now()
+
+	if cp.etags != nil {
+		for _, obj := range cp.pending {
+			cp.etags[obj.Key] = obj.ETag
+		}
+		if listed != nil {
+			updateObjectETags(cp.etags, nil, listed)
+		}
+		if err := SetObjectETags(ctx, cp.stateClient, scope, cp.table, cp.etags); err != nil {
+			logger.Warn().Err(err).Msg("failed to set object etags")
+		}
+	}
+
+	if cp.processed != nil {
+		done := cp.pending
+		if listed != nil {
+			// Objects skipped for an unchanged ETag were never pending.
+			done = nil
+			for i, obj := range cp.objects {
+				if cp.done[i] {
+					done = append(done, obj)
+				}
+			}
+		}
+		cp.processed.add(done)
+		switch {
+		case listed != nil && cp.next == len(cp.objects):
+			cp.processed.compact(cp.c.spec.incrementalLookback(), time.Time{})
+		case !cp.cursor.IsZero():
+			// Objects still being read must stay after the watermark.
+			cp.processed.compact(cp.c.spec.incrementalLookback(), cp.cursor)
+		}
+		if err := SetProcessedObjects(ctx, cp.stateClient, scope, cp.table, cp.processed); err != nil {
+			logger.Warn().Err(err).Msg("failed to set processed objects")
+		}
+	} else if !cp.cursor.IsZero() {
+		if err := SetCursor(ctx, cp.stateClient, scope, cp.table, cp.cursor); err != nil {
+			logger.Warn().Err(err).Msg("failed to set cursor")
+		}
+	}
+	cp.pending = cp.pending[:0]
+}
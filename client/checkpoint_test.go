@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckpointer_CursorWaitsForEarlierObjects(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	c := &Client{spec: Spec{Bucket: "b", CheckpointObjects: 1}}
+	objects := []S3Object{
+		{Key: "t/3.parquet", LastModified: "2024-01-03T00:00:00Z"},
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z"},
+		{Key: "t/2a.parquet", LastModified: "2024-01-02T00:00:00Z"},
+		{Key: "t/2b.parquet", LastModified: "2024-01-02T00:00:00Z"},
+	}
+	cp := c.newCheckpointer(sc, "t", objects, objects, nil, nil)
+
+	ordered := cp.ordered()
+	for i, key := range []string{"t/1.parquet", "t/2a.parquet", "t/2b.parquet", "t/3.parquet"} {
+		if ordered[i].Key != key {
+			t.Errorf("ordered[%d] = %s, want %s", i, ordered[i].Key, key)
+		}
+	}
+
+	cursor := func() time.Time {
+		got, err := GetCursor(ctx, sc, c.stateScope(), "t")
+		if err != nil {
+			t.Fatalf("GetCursor: %v", err)
+		}
+		return got
+	}
+
+	// A later object finishing first does not move the cursor.
+	cp.objectDone(ctx, ordered[2])
+	if got := cursor(); !got.IsZero() {
+		t.Errorf("cursor = %v, want zero while t/1.parquet is in flight", got)
+	}
+	cp.objectDone(ctx, ordered[0])
+	if got, want := cursor(), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("cursor = %v, want %v while t/2a.parquet is in flight", got, want)
+	}
+	cp.objectDone(ctx, ordered[1])
+	if got, want := cursor(), time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("cursor = %v, want %v", got, want)
+	}
+	cp.objectDone(ctx, ordered[3])
+	cp.finish(ctx, objects)
+	if got, want := cursor(), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("cursor after finish = %v, want %v", got, want)
+	}
+}
+
+func TestCheckpointer_FinishSkipsObjectsNotSynced(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	c := &Client{spec: Spec{Bucket: "b", IncrementalLookback: "0s"}}
+	objects := []S3Object{
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z", ETag: `"1"`},
+		{Key: "t/2.parquet", LastModified: "2024-01-02T00:00:00Z", ETag: `"2"`},
+		{Key: "t/3.parquet", LastModified: "2024-01-03T00:00:00Z", ETag: `"3"`},
+	}
+	processed := &ProcessedObjects{Objects: make(map[string]processedObject)}
+	cp := c.newCheckpointer(sc, "t", objects, objects, processed, map[string]string{})
+
+	// t/2.parquet is dropped by the schema_mismatch policy and never emitted.
+	cp.objectDone(ctx, objects[0])
+	cp.objectDone(ctx, objects[2])
+	cp.finish(ctx, objects)
+
+	got, err := GetProcessedObjects(ctx, sc, c.stateScope(), "t")
+	if err != nil {
+		t.Fatalf("GetProcessedObjects: %v", err)
+	}
+	if unprocessed := got.filter(objects); len(unprocessed) != 1 || unprocessed[0].Key != "t/2.parquet" {
+		t.Errorf("unprocessed = %v, want t/2.parquet", unprocessed)
+	}
+	etags, err := GetObjectETags(ctx, sc, c.stateScope(), "t")
+	if err != nil {
+		t.Fatalf("GetObjectETags: %v", err)
+	}
+	if _, ok := etags["t/2.parquet"]; ok || len(etags) != 2 {
+		t.Errorf("etags = %v, want t/1.parquet and t/3.parquet", etags)
+	}
+}
+
+func TestCheckpointer_Thresholds(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	c := &Client{spec: Spec{Bucket: "b", CheckpointObjects: 2, CheckpointInterval: "1h"}}
+	objects := []S3Object{
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z"},
+		{Key: "t/2.parquet", LastModified: "2024-01-02T00:00:00Z"},
+		{Key: "t/3.parquet", LastModified: "2024-01-03T00:00:00Z"},
+	}
+	cp := c.newCheckpointer(sc, "t", objects, objects, nil, nil)
+
+	cp.objectDone(ctx, objects[0])
+	if len(sc) != 0 {
+		t.Errorf("state = %v, want no checkpoint after one object", sc)
+	}
+	cp.objectDone(ctx, objects[1])
+	if got, _ := GetCursor(ctx, sc, c.stateScope(), "t"); !got.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("cursor = %v, want a checkpoint after two objects", got)
+	}
+}
+
+func TestCheckpointer_ProcessedAndETags(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	c := &Client{spec: Spec{Bucket: "b", CheckpointObjects: 1, IncrementalLookback: "0s"}}
+	objects := []S3Object{
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z", ETag: `"1"`},
+		{Key: "t/2.parquet", LastModified: "2024-01-02T00:00:00Z", ETag: `"2"`},
+	}
+	processed := &ProcessedObjects{Objects: make(map[string]processedObject)}
+	etags := map[string]string{"t/gone.parquet": `"x"`}
+	cp := c.newCheckpointer(sc, "t", objects, objects, processed, etags)
+
+	// t/2.parquet finishes while t/1.parquet is in flight; the watermark must
+	// not pass t/1.parquet.
+	cp.objectDone(ctx, objects[1])
+	got, err := GetProcessedObjects(ctx, sc, c.stateScope(), "t")
+	if err != nil {
+		t.Fatalf("GetProcessedObjects: %v", err)
+	}
+	if !got.Watermark.IsZero() || len(got.Objects) != 1 {
+		t.Errorf("processed = %+v, want only t/2.parquet and no watermark", got)
+	}
+	if got := processed.filter(objects); len(got) != 1 || got[0].Key != "t/1.parquet" {
+		t.Errorf("unprocessed = %v, want t/1.parquet", got)
+	}
+
+	cp.objectDone(ctx, objects[0])
+	cp.finish(ctx, objects)
+	gotETags, err := GetObjectETags(ctx, sc, c.stateScope(), "t")
+	if err != nil {
+		t.Fatalf("GetObjectETags: %v", err)
+	}
+	if len(gotETags) != 2 || gotETags["t/1.parquet"] != `"1"` || gotETags["t/2.parquet"] != `"2"` {
+		t.Errorf("etags = %v, want t/1.parquet and t/2.parquet", gotETags)
+	}
+}
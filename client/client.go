@@ -4,9 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/cloudquery/plugin-sdk/v4/message"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
 	"github.com/cloudquery/plugin-sdk/v4/schema"
@@ -20,6 +25,13 @@ type Client struct {
 	logger   zerolog.Logger
 	spec     Spec
 	s3Client *s3.Client
+
+	// sources are the clients of the buckets listed in the sources option,
+	// each with the source's bucket, prefix and connection settings in its
+	// spec. A spec without sources syncs its own bucket.
+	sources []*Client
+	// tablePrefix is prepended to the names of the tables of a source.
+	tablePrefix string
 }
 
 // Configure is the NewClientFunc that the plugin SDK calls to create a Client.
@@ -33,39 +45,94 @@ func Configure(ctx context.Context, logger zerolog.Logger, specBytes []byte, opt
 		return nil, fmt.Errorf("invalid spec: %w", err)
 	}
 
+	c := &Client{logger: logger, spec: spec}
+	if len(spec.Sources) == 0 {
+		s3Client, err := newS3Client(ctx, spec.Region, spec.LocalProfile, "", spec.Endpoint, spec.PathStyle)
+		if err != nil {
+			return nil, err
+		}
+		c.s3Client = s3Client
+		return c, nil
+	}
+
+	for _, src := range spec.Sources {
+		srcSpec := spec
+		srcSpec.Sources = nil
+		srcSpec.Bucket = src.Bucket
+		srcSpec.PathPrefix = src.PathPrefix
+		if src.Region != "" {
+			srcSpec.Region = src.Region
+		}
+		if src.Endpoint != "" {
+			srcSpec.Endpoint = src.Endpoint
+		}
+		if src.LocalProfile != "" {
+			srcSpec.LocalProfile = src.LocalProfile
+		}
+		if src.PathStyle != nil {
+			srcSpec.PathStyle = *src.PathStyle
+		}
+		s3Client, err := newS3Client(ctx, srcSpec.Region, srcSpec.LocalProfile, src.RoleARN, srcSpec.Endpoint, srcSpec.PathStyle)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", src.Bucket, err)
+		}
+		c.sources = append(c.sources, &Client{
+			logger:      logger.With().Str("bucket", src.Bucket).Str("path_prefix", src.PathPrefix).Logger(),
+			spec:        srcSpec,
+			s3Client:    s3Client,
+			tablePrefix: src.TablePrefix,
+		})
+	}
+	return c, nil
+}
+
+// newS3Client creates an S3 client for a region with an optional named
+// profile, assumed role, custom endpoint and path-style addressing.
+func newS3Client(ctx context.Context, region, profile, roleARN, endpoint string, pathStyle bool) (*s3.Client, error) {
 	cfgOpts := []func(*config.LoadOptions) error{
-		config.WithRegion(spec.Region),
+		config.WithRegion(region),
 	}
-	if spec.LocalProfile != "" {
-		cfgOpts = append(cfgOpts, config.WithSharedConfigProfile(spec.LocalProfile))
+	if profile != "" {
+		cfgOpts = append(cfgOpts, config.WithSharedConfigProfile(profile))
 	}
 	cfg, err := config.LoadDefaultConfig(ctx, cfgOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	if roleARN != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN))
+	}
 	var s3Opts []func(*s3.Options)
-	if spec.Endpoint != "" {
+	if endpoint != "" {
 		s3Opts = append(s3Opts, func(o *s3.Options) {
-			o.BaseEndpoint = &spec.Endpoint
+			o.BaseEndpoint = &endpoint
 		})
 	}
-	if spec.PathStyle {
+	if pathStyle {
 		s3Opts = append(s3Opts, func(o *s3.Options) {
 			o.UsePathStyle = true
 		})
 	}
-	s3Client := s3.NewFromConfig(cfg, s3Opts...)
+	return s3.NewFromConfig(cfg, s3Opts...), nil
+}
 
-	return &Client{
-		logger:   logger,
-		spec:     spec,
-		s3Client: s3Client,
-	}, nil
+// sourceClients returns the clients of the buckets to sync.
+func (c *Client) sourceClients() []*Client {
+	if len(c.sources) == 0 {
+		return []*Client{c}
+	}
+	return c.sources
 }
 
 // ID returns a unique identifier for this client instance.
 func (c *Client) ID() string {
-	return "cq-source-s3:" + c.spec.Bucket
+	buckets := make([]string, 0, len(c.sources))
+	for _, src := range c.sourceClients() {
+		if !slices.Contains(buckets, src.spec.Bucket) {
+			buckets = append(buckets, src.spec.Bucket)
+		}
+	}
+	return "cq-source-s3:" + strings.Join(buckets, ",")
 }
 
 // Tables returns the list of tables discovered from S3 key prefixes.
@@ -2,10 +2,12 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"strings"
 	"testing"
 
+	"github.com/cloudquery/plugin-sdk/v4/plugin"
 	"github.com/rs/zerolog"
 )
 
@@ -78,5 +80,46 @@ func TestID(t *testing.T) {
 	}
 }
 
+func TestConfigure_Sources(t *testing.T) {
+	specBytes := []byte(`{
+		"region": "us-east-1",
+		"rows_per_record": 100,
+		"path_style": true,
+		"sources": [
+			{"bucket": "prod-exports", "path_prefix": "orders/", "table_prefix": "prod", "path_style": false},
+			{"bucket": "eu-exports", "region": "eu-west-1", "endpoint": "http://localhost:4566"},
+			{"bucket": "prod-exports", "path_prefix": "users/"}
+		]
+	}`)
+	pc, err := Configure(context.Background(), zerolog.Nop(), specBytes, plugin.NewClientOptions{})
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	c := pc.(*Client)
+
+	srcs := c.sourceClients()
+	if len(srcs) != 3 {
+		t.Fatalf("got %d sources, want 3", len(srcs))
+	}
+	if srcs[0].spec.Bucket != "prod-exports" || srcs[0].spec.PathPrefix != "orders/" || srcs[0].tablePrefix != "prod" {
+		t.Errorf("source 0 = %+v, prefix %q", srcs[0].spec, srcs[0].tablePrefix)
+	}
+	if srcs[0].spec.Region != "us-east-1" || srcs[1].spec.Region != "eu-west-1" {
+		t.Errorf("regions = %q, %q, want the top-level default and the override", srcs[0].spec.Region, srcs[1].spec.Region)
+	}
+	if !srcs[1].spec.PathStyle || srcs[1].spec.Endpoint != "http://localhost:4566" {
+		t.Errorf("source 1 connection = %+v", srcs[1].spec)
+	}
+	if srcs[0].spec.PathStyle {
+		t.Error("expected path_style false on source 0 to override the top-level value")
+	}
+	if srcs[2].spec.RowsPerRecord != 100 || srcs[2].spec.Sources != nil {
+		t.Errorf("source 2 = %+v, want top-level options without sources", srcs[2].spec)
+	}
+	if got, want := c.ID(), "cq-source-s3:prod-exports,eu-exports"; got != want {
+		t.Errorf("ID() = %q, want %q", got, want)
+	}
+}
+
 // Suppress unused import warning
 var _ = fmt.Sprintf
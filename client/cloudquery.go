@@ -0,0 +1,161 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+// destinationPathPlaceholders maps the placeholders of cq-destination-s3 paths
+// to the patterns matching their values. Both table placeholders capture the
+// table name, which is sanitized like other table names.
+var destinationPathPlaceholders = map[string]string{
+	"{{TABLE}}":        `(?P<table>[^/]+)`,
+	"{{TABLE_HYPHEN}}": `(?P<table>[^/]+)`,
+	"{{SYNC_ID}}":      `[^/]+`,
+	"{{FORMAT}}":       `[^/]+`,
+	"{{UUID}}":         `[^/]+`,
+	"{{YEAR}}":         `[0-9]{4}`,
+	"{{MONTH}}":        `[0-9]{2}`,
+	"{{DAY}}":          `[0-9]{2}`,
+	"{{HOUR}}":         `[0-9]{2}`,
+	"{{MINUTE}}":       `[0-9]{2}`,
+}
+
+// placeholderPattern matches the placeholders of a destination path.
+var placeholderPattern = regexp.MustCompile(`\{\{[A-Z_]+\}\}`)
+
+// newDestinationPathRule compiles the path of a cq-destination-s3 spec, such
+// as "{{TABLE}}/{{UUID}}.{{FORMAT}}", to a table rule naming each object
+// after the table it was written for. The rule matches keys that start with
+// the path, so compression extensions appended to it are allowed.
+func newDestinationPathRule(path string) (tableRule, error) {
+	var (
+		pattern strings.Builder
+		tables  int
+		last    int
+	)
+	pattern.WriteString("^")
+	for _, loc := range placeholderPattern.FindAllStringIndex(path, -1) {
+		placeholder := path[loc[0]:loc[1]]
+		sub, ok := destinationPathPlaceholders[placeholder]
+		if !ok {
+			return tableRule{}, fmt.Errorf("unsupported placeholder %s", placeholder)
+		}
+		if placeholder == "{{TABLE}}" || placeholder == "{{TABLE_HYPHEN}}" {
+			tables++
+		}
+		pattern.WriteString(regexp.QuoteMeta(path[last:loc[0]]))
+		pattern.WriteString(sub)
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(path[last:]))
+	if tables != 1 {
+		return tableRule{}, fmt.Errorf("path %q must contain exactly one {{TABLE}} or {{TABLE_HYPHEN}} placeholder", path)
+	}
+	re, err := regexp.Compile(pattern.String())
+	if err != nil {
+		return tableRule{}, err
+	}
+	return tableRule{pattern: re, name: "${table}"}, nil
+}
+
+// cloudQueryTableName returns the name of the table that a CloudQuery
+// destination wrote sc for, or "" if sc has no CloudQuery table metadata.
+func cloudQueryTableName(sc *arrow.Schema) string {
+	md := sc.Metadata()
+	name, _ := md.GetValue(schema.MetadataTableName)
+	return name
+}
+
+// cloudQueryNameMismatches returns the objects whose schema names another
+// CloudQuery table than most objects of the table, preferring the name seen
+// first on ties, as mismatches and clears their schemas. Objects that name no
+// table are counted like a name of their own, and nil schemas are skipped.
+func cloudQueryNameMismatches(objects []S3Object, schemas []*arrow.Schema) []schemaMismatch {
+	counts := make(map[string]int)
+	var (
+		name string
+		best int
+	)
+	for _, sc := range schemas {
+		if sc == nil {
+			continue
+		}
+		n := cloudQueryTableName(sc)
+		counts[n]++
+		if counts[n] > best {
+			name, best = n, counts[n]
+		}
+	}
+	describe := func(n string) string {
+		if n == "" {
+			return "no CloudQuery table"
+		}
+		return fmt.Sprintf("CloudQuery table %q", n)
+	}
+
+	var mismatches []schemaMismatch
+	for j, sc := range schemas {
+		if sc == nil {
+			continue
+		}
+		if n := cloudQueryTableName(sc); n != name {
+			mismatches = append(mismatches, schemaMismatch{
+				Object: objects[j],
+				Reason: fmt.Sprintf("written from %s, not %s like %d of %d files", describe(n), describe(name), best, len(schemas)),
+			})
+			schemas[j] = nil
+		}
+	}
+	return mismatches
+}
+
+// withCloudQueryTableMetadata copies the description, title, primary key
+// constraint name and parent table that a CloudQuery destination wrote to md
+// onto table. The parent is named like table, with tablePrefix. Column flags
+// such as primary and incremental keys are read with the columns themselves.
+func withCloudQueryTableMetadata(table *schema.Table, md arrow.Metadata, tablePrefix string) {
+	table.Description, _ = md.GetValue(schema.MetadataTableDescription)
+	table.Title, _ = md.GetValue(schema.MetadataTableTitle)
+	table.PkConstraintName, _ = md.GetValue(schema.MetadataConstraintName)
+	if parent, _ := md.GetValue(schema.MetadataTableDependsOn); parent != "" {
+		table.Parent = &schema.Table{Name: prefixedTableName(tablePrefix, naming.Sanitize(parent))}
+	}
+}
+
+// prefixedTableName returns name with the table_prefix of a source.
+func prefixedTableName(tablePrefix, name string) string {
+	if tablePrefix == "" {
+		return name
+	}
+	return tablePrefix + "_" + name
+}
+
+// withTableName returns a new Arrow RecordBatch whose "cq:table_name" schema
+// metadata is name, or rec itself if it already is. Records read from files
+// written by CloudQuery carry the original table name, which differs from the
+// synced table's name when a table_prefix is set or the file's metadata is
+// ignored.
+func withTableName(rec arrow.RecordBatch, name string) arrow.RecordBatch {
+	sc := rec.Schema()
+	md := sc.Metadata()
+	if v, ok := md.GetValue(schema.MetadataTableName); ok && v == name {
+		return rec
+	}
+	keys := make([]string, 0, md.Len()+1)
+	values := make([]string, 0, md.Len()+1)
+	for i, k := range md.Keys() {
+		if k != schema.MetadataTableName {
+			keys = append(keys, k)
+			values = append(values, md.Values()[i])
+		}
+	}
+	newMD := arrow.NewMetadata(append(keys, schema.MetadataTableName), append(values, name))
+	return array.NewRecordBatch(arrow.NewSchema(sc.Fields(), &newMD), rec.Columns(), rec.NumRows())
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+func TestDestinationPathRule(t *testing.T) {
+	rule, err := newDestinationPathRule("exports/{{TABLE}}/{{YEAR}}/{{MONTH}}/{{DAY}}/{{UUID}}.{{FORMAT}}")
+	if err != nil {
+		t.Fatalf("newDestinationPathRule: %v", err)
+	}
+	m := &tableMapping{rules: []tableRule{rule}, ignoreUnmatched: true}
+	tests := map[string]string{
+		"exports/aws_ec2_instances/2024/01/02/0f1e.parquet":    "aws_ec2_instances",
+		"exports/aws_ec2_instances/2024/01/02/0f1e.parquet.gz": "aws_ec2_instances",
+		"exports/aws_ec2_instances/24/01/02/0f1e.parquet":      "",
+		"other/aws_ec2_instances/2024/01/02/0f1e.parquet":      "",
+	}
+	for key, want := range tests {
+		if got := m.tableName(key, key); got != want {
+			t.Errorf("tableName(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	hyphen, err := newDestinationPathRule("{{TABLE_HYPHEN}}/{{UUID}}.{{FORMAT}}")
+	if err != nil {
+		t.Fatalf("newDestinationPathRule: %v", err)
+	}
+	m = &tableMapping{rules: []tableRule{hyphen}}
+	if got := m.tableName("aws-ec2-instances/0f1e.parquet", "aws-ec2-instances/0f1e.parquet"); got != "aws_ec2_instances" {
+		t.Errorf("tableName = %q, want aws_ec2_instances", got)
+	}
+
+	for _, path := range []string{
+		"data/{{UUID}}.parquet",
+		"{{TABLE}}/{{TABLE}}.parquet",
+		"{{TABLE}}/{{SECOND}}.parquet",
+	} {
+		if _, err := newDestinationPathRule(path); err == nil {
+			t.Errorf("expected error for path %q", path)
+		}
+	}
+}
+
+func TestWithCloudQueryTableMetadata(t *testing.T) {
+	original := &schema.Table{
+		Name:             "aws_ec2_instance_tags",
+		Description:      "Tags of EC2 instances",
+		Title:            "EC2 Instance Tags",
+		PkConstraintName: "tags_pk",
+		Parent:           &schema.Table{Name: "aws_ec2_instances"},
+		Columns: schema.ColumnList{
+			{Name: "arn", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "key", Type: arrow.BinaryTypes.String, Unique: true},
+			{Name: "updated_at", Type: arrow.FixedWidthTypes.Timestamp_us, IncrementalKey: true},
+		},
+	}
+	sc := original.ToArrowSchema()
+	if got := cloudQueryTableName(sc); got != original.Name {
+		t.Fatalf("cloudQueryTableName = %q, want %q", got, original.Name)
+	}
+	if got := cloudQueryTableName(arrow.NewSchema(sc.Fields(), nil)); got != "" {
+		t.Errorf("cloudQueryTableName without metadata = %q, want empty", got)
+	}
+
+	table := &schema.Table{Name: "eu_aws_ec2_instance_tags"}
+	for _, f := range sc.Fields() {
+		table.Columns = append(table.Columns, schema.NewColumnFromArrowField(f))
+	}
+	withCloudQueryTableMetadata(table, sc.Metadata(), "eu")
+	if table.Description != original.Description || table.Title != original.Title || table.PkConstraintName != original.PkConstraintName {
+		t.Errorf("table = %q, %q, %q; want the original description, title and constraint name", table.Description, table.Title, table.PkConstraintName)
+	}
+	if table.Parent == nil || table.Parent.Name != "eu_aws_ec2_instances" {
+		t.Errorf("Parent = %v, want eu_aws_ec2_instances", table.Parent)
+	}
+	if col := table.Columns.Get("arn"); !col.PrimaryKey || !col.NotNull {
+		t.Errorf("arn = %+v, want a non-null primary key", col)
+	}
+	if !table.Columns.Get("key").Unique || !table.Columns.Get("updated_at").IncrementalKey {
+		t.Error("expected unique and incremental key flags to be read from field metadata")
+	}
+}
+
+func TestCloudQueryNameMismatches(t *testing.T) {
+	named := func(name string) *arrow.Schema {
+		md := arrow.MetadataFrom(map[string]string{schema.MetadataTableName: name})
+		return arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, &md)
+	}
+	objects := []S3Object{{Key: "a"}, {Key: "b"}, {Key: "c"}, {Key: "d"}, {Key: "e"}}
+	schemas := []*arrow.Schema{
+		named("aws_s3_buckets"),
+		named("aws_ec2_instances"),
+		nil,
+		named("aws_ec2_instances"),
+		arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil),
+	}
+
+	mismatches := cloudQueryNameMismatches(objects, schemas)
+	var keys []string
+	for _, m := range mismatches {
+		keys = append(keys, m.Object.Key)
+	}
+	if strings.Join(keys, ",") != "a,e" {
+		t.Fatalf("mismatched objects = %v, want [a e]", keys)
+	}
+	if !strings.Contains(mismatches[0].Reason, `"aws_s3_buckets"`) || !strings.Contains(mismatches[1].Reason, "no CloudQuery table") {
+		t.Errorf("unexpected reasons: %q, %q", mismatches[0].Reason, mismatches[1].Reason)
+	}
+	if schemas[0] != nil || schemas[4] != nil || schemas[1] == nil || schemas[3] == nil {
+		t.Error("expected the schemas of mismatched objects to be cleared")
+	}
+}
+
+func TestWithTableName(t *testing.T) {
+	existing := arrow.MetadataFrom(map[string]string{
+		schema.MetadataTableName: "aws_ec2_instances",
+		"custom_key":             "custom_value",
+	})
+	rec := makeTestRecordBatch(&existing)
+	defer rec.Release()
+
+	if same := withTableName(rec, "aws_ec2_instances"); same != rec {
+		t.Error("expected a record with the right table name to be returned unchanged")
+	}
+	out := withTableName(rec, "eu_aws_ec2_instances")
+	defer out.Release()
+	md := out.Schema().Metadata()
+	if v, _ := md.GetValue(schema.MetadataTableName); v != "eu_aws_ec2_instances" {
+		t.Errorf("cq:table_name = %q, want eu_aws_ec2_instances", v)
+	}
+	if v, _ := md.GetValue("custom_key"); v != "custom_value" {
+		t.Errorf("custom_key = %q, want custom_value", v)
+	}
+}
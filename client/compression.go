@@ -0,0 +1,115 @@
+package client
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compression codecs.
+const (
+	codecNone   = ""
+	codecGzip   = "gzip"
+	codecZstd   = "zstd"
+	codecBzip2  = "bzip2"
+	codecSnappy = "snappy"
+)
+
+// compressionExtensions maps object key suffixes to the codec they imply.
+var compressionExtensions = map[string]string{
+	".gz":     codecGzip,
+	".gzip":   codecGzip,
+	".zst":    codecZstd,
+	".zstd":   codecZstd,
+	".bz2":    codecBzip2,
+	".sz":     codecSnappy,
+	".snappy": codecSnappy,
+}
+
+// splitCompressionExtension returns the key without a trailing compression
+// extension and the codec that extension implies. Keys without a compression
+// extension are returned unchanged with codecNone.
+func splitCompressionExtension(key string) (string, string) {
+	lower := strings.ToLower(key)
+	for ext, codec := range compressionExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return key[:len(key)-len(ext)], codec
+		}
+	}
+	return key, codecNone
+}
+
+// codecFromContentEncoding maps an HTTP Content-Encoding header to a codec.
+func codecFromContentEncoding(encoding string) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		return codecGzip
+	case "zstd":
+		return codecZstd
+	case "bzip2", "x-bzip2":
+		return codecBzip2
+	case "snappy", "x-snappy-framed":
+		return codecSnappy
+	default:
+		return codecNone
+	}
+}
+
+// objectCodec determines an object's codec from its key extension, falling
+// back to its Content-Encoding.
+func objectCodec(key, contentEncoding string) string {
+	if _, codec := splitCompressionExtension(key); codec != codecNone {
+		return codec
+	}
+	return codecFromContentEncoding(contentEncoding)
+}
+
+// decompress wraps r in a decompressing reader for codec. Closing the returned
+// reader closes r.
+func decompress(r io.ReadCloser, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case codecNone:
+		return r, nil
+	case codecGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid gzip stream: %v", errMalformedObject, err)
+		}
+		return &decompressReader{Reader: zr, closers: []io.Closer{zr, r}}, nil
+	case codecZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid zstd stream: %v", errMalformedObject, err)
+		}
+		rc := zr.IOReadCloser()
+		return &decompressReader{Reader: rc, closers: []io.Closer{rc, r}}, nil
+	case codecBzip2:
+		return &decompressReader{Reader: bzip2.NewReader(r), closers: []io.Closer{r}}, nil
+	case codecSnappy:
+		return &decompressReader{Reader: snappy.NewReader(r), closers: []io.Closer{r}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %q", codec)
+	}
+}
+
+// decompressReader reads decompressed bytes and closes both the decompressor
+// and the underlying object body.
+type decompressReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *decompressReader) Close() error {
+	var firstErr error
+	for _, c := range d.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestSplitCompressionExtension(t *testing.T) {
+	tests := []struct {
+		key       string
+		wantKey   string
+		wantCodec string
+	}{
+		{"data/file.csv.gz", "data/file.csv", codecGzip},
+		{"data/file.CSV.GZIP", "data/file.CSV", codecGzip},
+		{"data/file.json.zst", "data/file.json", codecZstd},
+		{"data/file.jsonl.zstd", "data/file.jsonl", codecZstd},
+		{"data/file.csv.bz2", "data/file.csv", codecBzip2},
+		{"data/file.jsonl.sz", "data/file.jsonl", codecSnappy},
+		{"data/file.parquet.snappy", "data/file.parquet", codecSnappy},
+		{"data/file.parquet", "data/file.parquet", codecNone},
+	}
+	for _, tc := range tests {
+		gotKey, gotCodec := splitCompressionExtension(tc.key)
+		if gotKey != tc.wantKey || gotCodec != tc.wantCodec {
+			t.Errorf("splitCompressionExtension(%q) = %q, %q, want %q, %q", tc.key, gotKey, gotCodec, tc.wantKey, tc.wantCodec)
+		}
+	}
+}
+
+func TestObjectCodec(t *testing.T) {
+	tests := []struct {
+		key, encoding, want string
+	}{
+		{"a.csv.gz", "", codecGzip},
+		{"a.csv", "gzip", codecGzip},
+		{"a.csv", "x-gzip", codecGzip},
+		{"a.csv", "zstd", codecZstd},
+		{"a.csv", "identity", codecNone},
+		{"a.csv.zst", "gzip", codecZstd},
+	}
+	for _, tc := range tests {
+		if got := objectCodec(tc.key, tc.encoding); got != tc.want {
+			t.Errorf("objectCodec(%q, %q) = %q, want %q", tc.key, tc.encoding, got, tc.want)
+		}
+	}
+}
+
+func TestHasFileExtension_Compressed(t *testing.T) {
+	if !hasFileExtension("exports/a.csv.gz", "csv") {
+		t.Error("expected .csv.gz to match csv")
+	}
+	if !hasFileExtension("logs/a.json.zst", "jsonl") {
+		t.Error("expected .json.zst to match jsonl")
+	}
+	if hasFileExtension("exports/a.gz", "csv") {
+		t.Error("did not expect a bare .gz to match csv")
+	}
+}
+
+func TestDecompress_RoundTrip(t *testing.T) {
+	payload := []byte("id,name\n1,alice\n2,bob\n")
+
+	compress := map[string]func(t *testing.T) []byte{
+		codecGzip: func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			w := gzip.NewWriter(&buf)
+			_, _ = w.Write(payload)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		codecZstd: func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			w, err := zstd.NewWriter(&buf)
+			if err != nil {
+				t.Fatalf("zstd.NewWriter: %v", err)
+			}
+			_, _ = w.Write(payload)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		codecSnappy: func(t *testing.T) []byte {
+			var buf bytes.Buffer
+			w := snappy.NewBufferedWriter(&buf)
+			_, _ = w.Write(payload)
+			_ = w.Close()
+			return buf.Bytes()
+		},
+		codecNone: func(t *testing.T) []byte { return payload },
+	}
+
+	for codec, fn := range compress {
+		t.Run(codec, func(t *testing.T) {
+			r, err := decompress(io.NopCloser(bytes.NewReader(fn(t))), codec)
+			if err != nil {
+				t.Fatalf("decompress: %v", err)
+			}
+			defer func() { _ = r.Close() }()
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Errorf("got %q, want %q", got, payload)
+			}
+		})
+	}
+}
+
+func TestDecompress_InvalidGzip(t *testing.T) {
+	_, err := decompress(io.NopCloser(bytes.NewReader([]byte("not gzip"))), codecGzip)
+	if !errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errMalformedObject, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+	"github.com/google/uuid"
+)
+
+// cqIDNamespace is the UUIDv5 namespace of deterministic _cq_id values.
+var cqIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/infobloxopen/cq-source-s3/cq_id"))
+
+// rowCqID returns the _cq_id of the row at position row of an object: a
+// UUIDv5 of the bucket, key and ETag of the object and the position, which
+// stays the same until the object is overwritten.
+func rowCqID(md objectMetadata, row int64) uuid.UUID {
+	name := strings.Join([]string{md.bucket, md.object.Key, md.object.ETag, strconv.FormatInt(row, 10)}, "\x00")
+	return uuid.NewSHA1(cqIDNamespace, []byte(name))
+}
+
+// keyCqID returns the _cq_id of a row of table whose key columns hold values
+// encoded by cqIDKeyValue: a UUIDv5 of the table name and the values, which
+// stays the same wherever the row is read from.
+func keyCqID(table string, values []string) uuid.UUID {
+	name := strings.Join(append([]string{table}, values...), "\x00")
+	return uuid.NewSHA1(cqIDNamespace, []byte(name))
+}
+
+// cqIDNull encodes a null key value. Other values are prefixed with their
+// length and a colon, so a null never collides with a value and a value
+// holding the separator never spans two columns.
+const cqIDNull = "null"
+
+// cqIDKeyValue encodes the value at position r of a key column. Values are
+// formatted independently of how Arrow prints them: floats in their shortest
+// form with negative zero as zero, decimals as unscaled integer and scale,
+// and timestamps as RFC 3339 UTC instants so that the unit and time zone of
+// the column do not matter.
+func cqIDKeyValue(arr arrow.Array, r int) (string, error) {
+	if arr.IsNull(r) {
+		return cqIDNull, nil
+	}
+	var v string
+	switch a := arr.(type) {
+	case *array.Dictionary:
+		return cqIDKeyValue(a.Dictionary(), a.GetValueIndex(r))
+	case *array.String:
+		v = a.Value(r)
+	case *array.LargeString:
+		v = a.Value(r)
+	case *array.Binary:
+		v = string(a.Value(r))
+	case *array.LargeBinary:
+		v = string(a.Value(r))
+	case *array.Boolean:
+		v = strconv.FormatBool(a.Value(r))
+	case *array.Int8:
+		v = strconv.FormatInt(int64(a.Value(r)), 10)
+	case *array.Int16:
+		v = strconv.FormatInt(int64(a.Value(r)), 10)
+	case *array.Int32:
+		v = strconv.FormatInt(int64(a.Value(r)), 10)
+	case *array.Int64:
+		v = strconv.FormatInt(a.Value(r), 10)
+	case *array.Uint8:
+		v = strconv.FormatUint(uint64(a.Value(r)), 10)
+	case *array.Uint16:
+		v = strconv.FormatUint(uint64(a.Value(r)), 10)
+	case *array.Uint32:
+		v = strconv.FormatUint(uint64(a.Value(r)), 10)
+	case *array.Uint64:
+		v = strconv.FormatUint(a.Value(r), 10)
+	case *array.Float16:
+		v = formatCqIDFloat(float64(a.Value(r).Float32()), 32)
+	case *array.Float32:
+		v = formatCqIDFloat(float64(a.Value(r)), 32)
+	case *array.Float64:
+		v = formatCqIDFloat(a.Value(r), 64)
+	case *array.Decimal128:
+		v = fmt.Sprintf("%se-%d", a.Value(r).BigInt(), a.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		v = fmt.Sprintf("%se-%d", a.Value(r).BigInt(), a.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.Date32:
+		v = a.Value(r).ToTime().Format(time.DateOnly)
+	case *array.Date64:
+		v = a.Value(r).ToTime().Format(time.DateOnly)
+	case *array.Timestamp:
+		v = a.Value(r).ToTime(a.DataType().(*arrow.TimestampType).Unit).UTC().Format(time.RFC3339Nano)
+	case *array.Time32:
+		v = a.Value(r).ToTime(a.DataType().(*arrow.Time32Type).Unit).Format("15:04:05.999999999")
+	case *array.Time64:
+		v = a.Value(r).ToTime(a.DataType().(*arrow.Time64Type).Unit).Format("15:04:05.999999999")
+	case *types.UUIDArray:
+		v = a.Value(r).String()
+	case *types.JSONArray:
+		v = string(a.Storage().(*array.Binary).Value(r))
+	default:
+		// Nested and other types are encoded as JSON, which sorts map keys.
+		b, err := json.Marshal(arr.GetOneForMarshal(r))
+		if err != nil {
+			return "", fmt.Errorf("failed to encode %s value: %w", arr.DataType(), err)
+		}
+		v = string(b)
+	}
+	return strconv.Itoa(len(v)) + ":" + v, nil
+}
+
+// formatCqIDFloat formats f in its shortest form for the given bit size.
+func formatCqIDFloat(f float64, bitSize int) string {
+	if f == 0 {
+		f = 0 // negative zero
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+// withCqIDColumn returns a new Arrow RecordBatch with a deterministic _cq_id
+// column and a null _cq_parent_id column prepended, in the order
+// schema.AddCqIDs adds them to the table. The ids are derived from keyColumns
+// of rec if any are given, and otherwise from the object and rows, the
+// position of each row of rec in the object.
+func withCqIDColumn(rec arrow.RecordBatch, table string, keyColumns []string, md objectMetadata, rows []int64) (arrow.RecordBatch, error) {
+	sc := rec.Schema()
+	keys := make([]arrow.Array, len(keyColumns))
+	for i, name := range keyColumns {
+		indices := sc.FieldIndices(name)
+		if len(indices) == 0 {
+			return nil, fmt.Errorf("record of table %s has no cq_id_columns column %s", table, name)
+		}
+		keys[i] = rec.Column(indices[0])
+	}
+
+	bldr := types.NewUUIDBuilder(memory.DefaultAllocator)
+	defer bldr.Release()
+	n := int(rec.NumRows())
+	bldr.Reserve(n)
+	values := make([]string, len(keys))
+	for r := 0; r < n; r++ {
+		if len(keys) == 0 {
+			bldr.Append(rowCqID(md, rows[r]))
+			continue
+		}
+		for i, arr := range keys {
+			v, err := cqIDKeyValue(arr, r)
+			if err != nil {
+				return nil, fmt.Errorf("cq_id_columns column %s of table %s: %w", keyColumns[i], table, err)
+			}
+			values[i] = v
+		}
+		bldr.Append(keyCqID(table, values))
+	}
+	ids := bldr.NewArray()
+	defer ids.Release()
+	bldr.AppendNulls(n)
+	parentIDs := bldr.NewArray()
+	defer parentIDs.Release()
+
+	smd := sc.Metadata()
+	fields := append([]arrow.Field{schema.CqIDColumn.ToArrowField(), schema.CqParentIDColumn.ToArrowField()}, sc.Fields()...)
+	cols := append([]arrow.Array{ids, parentIDs}, rec.Columns()...)
+	return array.NewRecordBatch(arrow.NewSchema(fields, &smd), cols, rec.NumRows()), nil
+}
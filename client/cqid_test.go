@@ -0,0 +1,192 @@
+package client
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/decimal128"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+)
+
+func TestWithCqIDColumn(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+
+	md := objectMetadata{bucket: "my-bucket", object: S3Object{Key: "data/file.parquet", ETag: `"abc"`}}
+	cqID := func(keyColumns []string, md objectMetadata, row int64) string {
+		t.Helper()
+		out, err := withCqIDColumn(rec, "users", keyColumns, md, []int64{row})
+		if err != nil {
+			t.Fatalf("withCqIDColumn: %v", err)
+		}
+		defer out.Release()
+		if out.NumCols() != rec.NumCols()+2 || out.Schema().Field(0).Name != "_cq_id" || out.Schema().Field(1).Name != "_cq_parent_id" {
+			t.Fatalf("schema = %v, want _cq_id and _cq_parent_id prepended", out.Schema())
+		}
+		if parent := out.Column(1); parent.NullN() != parent.Len() {
+			t.Errorf("_cq_parent_id = %v, want nulls", parent)
+		}
+		return out.Column(0).(*types.UUIDArray).ValueStr(0)
+	}
+
+	id := cqID(nil, md, 0)
+	if again := cqID(nil, md, 0); again != id {
+		t.Errorf("_cq_id = %s on a second read, want %s", again, id)
+	}
+	if other := cqID(nil, md, 1); other == id {
+		t.Error("expected rows at other positions to get other ids")
+	}
+	overwritten := md
+	overwritten.object.ETag = `"def"`
+	if other := cqID(nil, overwritten, 0); other == id {
+		t.Error("expected the rows of an overwritten object to get other ids")
+	}
+
+	byKey := cqID([]string{"id"}, md, 0)
+	moved := md
+	moved.object.Key = "data/other.parquet"
+	if again := cqID([]string{"id"}, moved, 5); again != byKey {
+		t.Errorf("_cq_id from cq_id_columns = %s in another object, want %s", again, byKey)
+	}
+	if byKey == id {
+		t.Error("expected ids from cq_id_columns to differ from ids from positions")
+	}
+
+	if _, err := withCqIDColumn(rec, "users", []string{"missing"}, md, []int64{0}); err == nil {
+		t.Error("expected error for a missing cq_id_columns column")
+	}
+}
+
+func TestWithCqIDColumn_TableSchema(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+
+	// Tables are built from the file's fields like discovery builds them.
+	table := &schema.Table{Name: "users"}
+	for _, f := range rec.Schema().Fields() {
+		table.Columns = append(table.Columns, schema.NewColumnFromArrowField(f))
+	}
+	schema.AddCqIDs(table)
+
+	out, err := withCqIDColumn(rec, "users", nil, objectMetadata{}, []int64{0})
+	if err != nil {
+		t.Fatalf("withCqIDColumn: %v", err)
+	}
+	defer out.Release()
+	got, want := out.Schema(), table.ToArrowSchema()
+	if got.NumFields() != want.NumFields() {
+		t.Fatalf("record schema %v, want the fields of %v", got, want)
+	}
+	for i, f := range want.Fields() {
+		if g := got.Field(i); g.Name != f.Name || !arrow.TypeEqual(g.Type, f.Type) || g.Nullable != f.Nullable {
+			t.Errorf("field %d = %s %v nullable %v, want %s %v nullable %v", i, g.Name, g.Type, g.Nullable, f.Name, f.Type, f.Nullable)
+		}
+	}
+}
+
+func TestWithCqIDColumn_KeyValues(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "note", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, sc, strings.NewReader(`[
+		{"id": "abc", "note": null},
+		{"id": "abc", "note": "(null)"},
+		{"id": "abc", "note": "null"},
+		{"id": "a\u0000b", "note": "c"},
+		{"id": "a", "note": "b\u0000c"}
+	]`))
+	if err != nil {
+		t.Fatalf("RecordFromJSON: %v", err)
+	}
+	defer rec.Release()
+
+	out, err := withCqIDColumn(rec, "users", []string{"id", "note"}, objectMetadata{}, nil)
+	if err != nil {
+		t.Fatalf("withCqIDColumn: %v", err)
+	}
+	defer out.Release()
+	ids := out.Column(0).(*types.UUIDArray)
+
+	// The UUIDv5 of "users\x003:abc\x00null" in the cq_id namespace; changing
+	// it changes the _cq_id of every synced row.
+	if got, want := ids.ValueStr(0), "de071882-720a-5d9a-a82a-65c9a102836c"; got != want {
+		t.Errorf("_cq_id = %s, want %s", got, want)
+	}
+	seen := make(map[string]int)
+	for r := 0; r < ids.Len(); r++ {
+		if prev, ok := seen[ids.ValueStr(r)]; ok {
+			t.Errorf("rows %d and %d have the same _cq_id", prev, r)
+		}
+		seen[ids.ValueStr(r)] = r
+	}
+}
+
+func TestCqIDKeyValue(t *testing.T) {
+	encode := func(dt arrow.DataType, values string) []string {
+		t.Helper()
+		arr, _, err := array.FromJSON(memory.DefaultAllocator, dt, strings.NewReader(values))
+		if err != nil {
+			t.Fatalf("FromJSON(%s): %v", dt, err)
+		}
+		defer arr.Release()
+		encoded := make([]string, arr.Len())
+		for i := range encoded {
+			if encoded[i], err = cqIDKeyValue(arr, i); err != nil {
+				t.Fatalf("cqIDKeyValue(%s, %d): %v", dt, i, err)
+			}
+		}
+		return encoded
+	}
+
+	for _, tc := range []struct {
+		dt     arrow.DataType
+		values string
+		want   string
+	}{
+		{arrow.PrimitiveTypes.Int64, `[-42, null]`, "3:-42,null"},
+		{arrow.PrimitiveTypes.Uint32, `[4294967295]`, "10:4294967295"},
+		{arrow.FixedWidthTypes.Boolean, `[true, false]`, "4:true,5:false"},
+		{arrow.PrimitiveTypes.Float64, `[0.1, -0.0, 1e21, 3]`, "3:0.1,1:0,5:1e+21,1:3"},
+		{arrow.PrimitiveTypes.Float32, `[0.1]`, "3:0.1"},
+		{&arrow.Decimal128Type{Precision: 10, Scale: 2}, `["-1.50"]`, "7:-150e-2"},
+		{arrow.FixedWidthTypes.Date32, `["2024-03-31"]`, "10:2024-03-31"},
+		{arrow.FixedWidthTypes.Time64us, `["13:04:05.5"]`, "10:13:04:05.5"},
+		{arrow.BinaryTypes.Binary, `["AAE="]`, "2:\x00\x01"},
+		{arrow.ListOf(arrow.PrimitiveTypes.Int32), `[[1, null]]`, "8:[1,null]"},
+	} {
+		if got := strings.Join(encode(tc.dt, tc.values), ","); got != tc.want {
+			t.Errorf("%s %s = %q, want %q", tc.dt, tc.values, got, tc.want)
+		}
+	}
+
+	// Timestamps are encoded as instants, whatever their unit and zone.
+	us := encode(arrow.FixedWidthTypes.Timestamp_us, `["2024-03-31T01:30:00.25Z"]`)
+	ms := encode(&arrow.TimestampType{Unit: arrow.Millisecond, TimeZone: "Europe/Berlin"}, `["2024-03-31T01:30:00.250Z"]`)
+	if us[0] != ms[0] || us[0] != "23:2024-03-31T01:30:00.25Z" {
+		t.Errorf("timestamps = %q and %q, want the same instant", us[0], ms[0])
+	}
+
+	b := array.NewFloat64Builder(memory.DefaultAllocator)
+	defer b.Release()
+	b.Append(math.NaN())
+	nan := b.NewArray()
+	defer nan.Release()
+	if got, _ := cqIDKeyValue(nan, 0); got != "3:NaN" {
+		t.Errorf("NaN = %q, want 3:NaN", got)
+	}
+
+	d := array.NewDecimal128Builder(memory.DefaultAllocator, &arrow.Decimal128Type{Precision: 38, Scale: 0})
+	defer d.Release()
+	d.Append(decimal128.New(1, 0))
+	big := d.NewArray()
+	defer big.Release()
+	if got, _ := cqIDKeyValue(big, 0); got != "23:18446744073709551616e-0" {
+		t.Errorf("decimal = %q, want 2^64", got)
+	}
+}
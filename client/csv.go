@@ -0,0 +1,493 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// csvTimestampLayouts are the layouts recognized as timestamps during CSV
+// type inference. Values without a zone are interpreted as UTC.
+var csvTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+}
+
+// readCSVSchema reads the header and the first InferRows rows of a CSV object
+// and infers an Arrow schema from them.
+func (c *Client) readCSVSchema(ctx context.Context, key string) (*arrow.Schema, error) {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	sc, err := inferCSVSchema(body, c.spec.CSV)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer csv schema for %s: %w", key, err)
+	}
+	return sc, nil
+}
+
+// streamCSVRecords streams a CSV object as Arrow record batches decoded with
+// the table's inferred schema. The version id of the object read is stored
+// in versionID if it is not nil.
+func (c *Client) streamCSVRecords(ctx context.Context, key string, sc *arrow.Schema, batchSize int, versionID *string, records chan<- arrow.RecordBatch) error {
+	body, err := c.openObjectVersion(ctx, key, versionID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := readCSVRecords(ctx, body, sc, c.spec.CSV, batchSize, records); err != nil {
+		return fmt.Errorf("error reading records from %s: %w", key, err)
+	}
+	return nil
+}
+
+// inferCSVSchema builds an Arrow schema from the header row (or positional
+// column names when there is no header) and sniffs each column's type over the
+// first opts.InferRows data rows. All columns are nullable.
+func inferCSVSchema(r io.Reader, opts CSVSpec) (*arrow.Schema, error) {
+	cr := newCSVReader(r, opts)
+
+	var names []string
+	var sniffers []csvTypeSniffer
+	observe := func(row []string) {
+		for len(sniffers) < len(row) {
+			sniffers = append(sniffers, newCSVTypeSniffer())
+		}
+		for i, v := range row {
+			if slices.Contains(opts.NullValues, v) {
+				continue
+			}
+			sniffers[i].observe(v)
+		}
+	}
+
+	first, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: csv object is empty", errMalformedObject)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows := 0
+	if opts.NoHeader {
+		observe(first)
+		rows++
+	} else {
+		names = first
+	}
+
+	for ; rows < opts.InferRows; rows++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		observe(row)
+	}
+
+	numCols := max(len(names), len(sniffers))
+	fields := make([]arrow.Field, numCols)
+	for i, name := range csvColumnNames(names, numCols) {
+		var dt arrow.DataType = arrow.BinaryTypes.String
+		if i < len(sniffers) {
+			dt = sniffers[i].dataType()
+		}
+		fields[i] = arrow.Field{Name: name, Type: dt, Nullable: true}
+	}
+
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// csvColumnNames derives n column names from a header row. Blank or missing
+// names become column_N, and repeated names are deduplicated so every column
+// is addressable.
+func csvColumnNames(header []string, n int) []string {
+	names := make([]string, n)
+	seen := make(map[string]int, n)
+	for i := range names {
+		name := ""
+		if i < len(header) {
+			name = strings.TrimSpace(header[i])
+		}
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if k := seen[name]; k > 0 {
+			seen[name] = k + 1
+			name = fmt.Sprintf("%s_%d", name, k+1)
+		} else {
+			seen[name] = 1
+		}
+		names[i] = name
+	}
+	return names
+}
+
+// csvFieldIndices maps the columns of a header row to the fields of sc by
+// name, for objects whose columns differ from the merged table schema. It
+// returns nil when the columns match sc positionally or a column is not in sc.
+func csvFieldIndices(header []string, sc *arrow.Schema) []int {
+	names := csvColumnNames(header, len(header))
+	indices := make([]int, len(names))
+	positional := len(names) == sc.NumFields()
+	for i, name := range names {
+		idx := sc.FieldIndices(name)
+		if len(idx) == 0 {
+			return nil
+		}
+		indices[i] = idx[0]
+		positional = positional && idx[0] == i
+	}
+	if positional {
+		return nil
+	}
+	return indices
+}
+
+// readCSVRecords decodes CSV rows into Arrow record batches of at most
+// batchSize rows using the given schema. Values that do not parse as their
+// column's type fail with errTypeMismatch, and malformed rows after the first
+// batch was sent fail like them.
+func readCSVRecords(ctx context.Context, r io.Reader, sc *arrow.Schema, opts CSVSpec, batchSize int, records chan<- arrow.RecordBatch) error {
+	cr := newCSVReader(r, opts)
+	var indices []int
+	if !opts.NoHeader {
+		header, err := cr.Read()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		indices = csvFieldIndices(header, sc)
+	}
+
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, sc)
+	defer bldr.Release()
+
+	emitted := false
+	flush := func(rows int) error {
+		if rows == 0 {
+			return nil
+		}
+		rec := bldr.NewRecordBatch()
+		select {
+		case records <- rec:
+			emitted = true
+			return nil
+		case <-ctx.Done():
+			rec.Release()
+			return ctx.Err()
+		}
+	}
+
+	rows := 0
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return partialObjectError(err, emitted)
+		}
+		if indices != nil {
+			if err := appendCSVRowByName(bldr, row, indices, opts); err != nil {
+				return partialObjectError(fmt.Errorf("line %d: %w", cr.line, err), emitted)
+			}
+		} else {
+			if len(row) != sc.NumFields() {
+				return partialObjectError(fmt.Errorf("%w: line %d has %d fields, want %d", errMalformedObject, cr.line, len(row), sc.NumFields()), emitted)
+			}
+			for i, v := range row {
+				if slices.Contains(opts.NullValues, v) {
+					bldr.Field(i).AppendNull()
+					continue
+				}
+				if err := appendCSVValue(bldr.Field(i), v); err != nil {
+					return fmt.Errorf("%w: line %d column %q: %v; raise csv.infer_rows to sample more rows", errTypeMismatch, cr.line, sc.Field(i).Name, err)
+				}
+			}
+		}
+		rows++
+		if rows == batchSize {
+			if err := flush(rows); err != nil {
+				return err
+			}
+			rows = 0
+		}
+	}
+	return flush(rows)
+}
+
+// appendCSVRowByName appends a row whose columns map to the builder's fields
+// through indices; fields without a column are null.
+func appendCSVRowByName(bldr *array.RecordBuilder, row []string, indices []int, opts CSVSpec) error {
+	if len(row) != len(indices) {
+		return fmt.Errorf("%w: has %d fields, want %d", errMalformedObject, len(row), len(indices))
+	}
+	set := make([]bool, len(bldr.Fields()))
+	for i, v := range row {
+		fi := indices[i]
+		set[fi] = true
+		if slices.Contains(opts.NullValues, v) {
+			bldr.Field(fi).AppendNull()
+			continue
+		}
+		if err := appendCSVValue(bldr.Field(fi), v); err != nil {
+			return fmt.Errorf("%w: column %q: %v; raise csv.infer_rows to sample more rows", errTypeMismatch, bldr.Schema().Field(fi).Name, err)
+		}
+	}
+	for fi, ok := range set {
+		if !ok {
+			bldr.Field(fi).AppendNull()
+		}
+	}
+	return nil
+}
+
+// appendCSVValue parses v according to the builder's type and appends it.
+func appendCSVValue(b array.Builder, v string) error {
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid int64 %q", v)
+		}
+		b.Append(n)
+	case *array.Float64Builder:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid float64 %q", v)
+		}
+		b.Append(f)
+	case *array.BooleanBuilder:
+		t, ok := parseCSVBool(v)
+		if !ok {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		b.Append(t)
+	case *array.TimestampBuilder:
+		t, ok := parseCSVTimestamp(v)
+		if !ok {
+			return fmt.Errorf("invalid timestamp %q", v)
+		}
+		b.Append(arrow.Timestamp(t.UnixMicro()))
+	case *array.StringBuilder:
+		b.Append(v)
+	default:
+		return fmt.Errorf("unsupported csv column type %s", b.Type())
+	}
+	return nil
+}
+
+func parseCSVBool(v string) (bool, bool) {
+	switch {
+	case strings.EqualFold(v, "true"):
+		return true, true
+	case strings.EqualFold(v, "false"):
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func parseCSVTimestamp(v string) (time.Time, bool) {
+	for _, layout := range csvTimestampLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// csvTypeSniffer tracks which Arrow types can still represent every non-null
+// value observed in a CSV column.
+type csvTypeSniffer struct {
+	seen                                bool
+	isInt, isFloat, isBool, isTimestamp bool
+}
+
+func newCSVTypeSniffer() csvTypeSniffer {
+	return csvTypeSniffer{isInt: true, isFloat: true, isBool: true, isTimestamp: true}
+}
+
+func (s *csvTypeSniffer) observe(v string) {
+	s.seen = true
+	if s.isInt {
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			s.isInt = false
+		}
+	}
+	if s.isFloat {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			s.isFloat = false
+		}
+	}
+	if s.isBool {
+		if _, ok := parseCSVBool(v); !ok {
+			s.isBool = false
+		}
+	}
+	if s.isTimestamp {
+		if _, ok := parseCSVTimestamp(v); !ok {
+			s.isTimestamp = false
+		}
+	}
+}
+
+// dataType returns the narrowest type for the column, falling back to string
+// for columns with no non-null sample values.
+func (s *csvTypeSniffer) dataType() arrow.DataType {
+	switch {
+	case !s.seen:
+		return arrow.BinaryTypes.String
+	case s.isInt:
+		return arrow.PrimitiveTypes.Int64
+	case s.isFloat:
+		return arrow.PrimitiveTypes.Float64
+	case s.isBool:
+		return arrow.FixedWidthTypes.Boolean
+	case s.isTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_us
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// csvReader splits CSV input into records. Unlike encoding/csv it supports a
+// configurable quote character. Quoted fields may contain delimiters, line
+// breaks and doubled quote characters; empty lines are skipped.
+type csvReader struct {
+	r     *bufio.Reader
+	comma rune
+	quote rune
+	line  int
+}
+
+func newCSVReader(r io.Reader, opts CSVSpec) *csvReader {
+	br := bufio.NewReader(r)
+	// Skip a UTF-8 byte order mark, which spreadsheet exports often include.
+	if bom, err := br.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		_, _ = br.Discard(3)
+	}
+	comma, _ := utf8.DecodeRuneInString(opts.Delimiter)
+	quote, _ := utf8.DecodeRuneInString(opts.QuoteChar)
+	return &csvReader{r: br, comma: comma, quote: quote}
+}
+
+// Read returns the fields of the next non-empty record, or io.EOF.
+func (r *csvReader) Read() ([]string, error) {
+	for {
+		record, err := r.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			return record, nil
+		}
+	}
+}
+
+// readRecord reads one line (or several, for quoted line breaks). It returns
+// a nil record for empty lines.
+func (r *csvReader) readRecord() ([]string, error) {
+	var (
+		fields      []string
+		field       strings.Builder
+		inQuotes    bool
+		fieldQuoted bool
+		sawAny      bool
+	)
+	r.line++
+	startLine := r.line
+
+	endField := func() {
+		fields = append(fields, field.String())
+		field.Reset()
+		fieldQuoted = false
+	}
+
+	for {
+		ch, _, err := r.r.ReadRune()
+		if err == io.EOF {
+			if inQuotes {
+				return nil, fmt.Errorf("%w: unterminated quoted field starting on line %d", errMalformedObject, startLine)
+			}
+			if !sawAny {
+				return nil, io.EOF
+			}
+			value := strings.TrimSuffix(field.String(), "\r")
+			if fields == nil && value == "" && !fieldQuoted {
+				return nil, io.EOF
+			}
+			field.Reset()
+			field.WriteString(value)
+			endField()
+			return fields, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		sawAny = true
+
+		if inQuotes {
+			if ch == r.quote {
+				next, _, err := r.r.ReadRune()
+				if err == nil && next == r.quote {
+					field.WriteRune(r.quote)
+					continue
+				}
+				if err == nil {
+					_ = r.r.UnreadRune()
+				}
+				inQuotes = false
+				continue
+			}
+			if ch == '\n' {
+				r.line++
+			}
+			field.WriteRune(ch)
+			continue
+		}
+
+		switch ch {
+		case r.quote:
+			if field.Len() == 0 && !fieldQuoted {
+				inQuotes = true
+				fieldQuoted = true
+				continue
+			}
+			field.WriteRune(ch)
+		case r.comma:
+			endField()
+		case '\n':
+			value := strings.TrimSuffix(field.String(), "\r")
+			if fields == nil && value == "" && !fieldQuoted {
+				return nil, nil
+			}
+			field.Reset()
+			field.WriteString(value)
+			endField()
+			return fields, nil
+		default:
+			field.WriteRune(ch)
+		}
+	}
+}
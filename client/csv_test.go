@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+func defaultCSVSpec() CSVSpec {
+	s := Spec{}
+	s.SetDefaults()
+	return s.CSV
+}
+
+func TestInferCSVSchema(t *testing.T) {
+	input := "id,score,active,created_at,name,empty\n" +
+		"1,1.5,true,2024-01-01T00:00:00Z,alice,\n" +
+		"2,2,FALSE,2024-01-02 10:30:00,bob,\n" +
+		",3.25,,,,\n"
+
+	sc, err := inferCSVSchema(strings.NewReader(input), defaultCSVSpec())
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+
+	want := []struct {
+		name string
+		typ  arrow.DataType
+	}{
+		{"id", arrow.PrimitiveTypes.Int64},
+		{"score", arrow.PrimitiveTypes.Float64},
+		{"active", arrow.FixedWidthTypes.Boolean},
+		{"created_at", arrow.FixedWidthTypes.Timestamp_us},
+		{"name", arrow.BinaryTypes.String},
+		{"empty", arrow.BinaryTypes.String},
+	}
+	if sc.NumFields() != len(want) {
+		t.Fatalf("NumFields = %d, want %d", sc.NumFields(), len(want))
+	}
+	for i, w := range want {
+		f := sc.Field(i)
+		if f.Name != w.name {
+			t.Errorf("field[%d].Name = %q, want %q", i, f.Name, w.name)
+		}
+		if !arrow.TypeEqual(f.Type, w.typ) {
+			t.Errorf("field[%d] %s type = %v, want %v", i, f.Name, f.Type, w.typ)
+		}
+		if !f.Nullable {
+			t.Errorf("field[%d] should be nullable", i)
+		}
+	}
+}
+
+func TestInferCSVSchema_InferRowsLimit(t *testing.T) {
+	opts := defaultCSVSpec()
+	opts.InferRows = 2
+	input := "v\n1\n2\nnot-a-number\n"
+
+	sc, err := inferCSVSchema(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+	if !arrow.TypeEqual(sc.Field(0).Type, arrow.PrimitiveTypes.Int64) {
+		t.Errorf("type = %v, want int64 (rows past infer_rows are not sampled)", sc.Field(0).Type)
+	}
+}
+
+func TestInferCSVSchema_NoHeaderAndOptions(t *testing.T) {
+	opts := defaultCSVSpec()
+	opts.NoHeader = true
+	opts.Delimiter = ";"
+	opts.QuoteChar = "'"
+	opts.NullValues = []string{"NA"}
+	input := "1;'a;b'\nNA;'it''s'\n"
+
+	sc, err := inferCSVSchema(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+	if sc.NumFields() != 2 {
+		t.Fatalf("NumFields = %d, want 2", sc.NumFields())
+	}
+	if sc.Field(0).Name != "column_1" || sc.Field(1).Name != "column_2" {
+		t.Errorf("names = %q, %q, want column_1, column_2", sc.Field(0).Name, sc.Field(1).Name)
+	}
+	if !arrow.TypeEqual(sc.Field(0).Type, arrow.PrimitiveTypes.Int64) {
+		t.Errorf("column_1 type = %v, want int64", sc.Field(0).Type)
+	}
+}
+
+func TestInferCSVSchema_DuplicateAndEmptyHeaders(t *testing.T) {
+	sc, err := inferCSVSchema(strings.NewReader("a,a,\n1,2,3\n"), defaultCSVSpec())
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+	got := []string{sc.Field(0).Name, sc.Field(1).Name, sc.Field(2).Name}
+	want := []string{"a", "a_2", "column_3"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("field[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestInferCSVSchema_Empty(t *testing.T) {
+	_, err := inferCSVSchema(strings.NewReader(""), defaultCSVSpec())
+	if !errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errMalformedObject, got %v", err)
+	}
+}
+
+func TestReadCSVRecords_BatchSize(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("id,name\n")
+	for i := 0; i < 25; i++ {
+		sb.WriteString("7,row\n")
+	}
+	opts := defaultCSVSpec()
+	sc, err := inferCSVSchema(strings.NewReader(sb.String()), opts)
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+
+	records := make(chan arrow.RecordBatch, 10)
+	if err := readCSVRecords(context.Background(), strings.NewReader(sb.String()), sc, opts, 10, records); err != nil {
+		t.Fatalf("readCSVRecords: %v", err)
+	}
+	close(records)
+
+	var sizes []int64
+	for rec := range records {
+		sizes = append(sizes, rec.NumRows())
+		if got := rec.Column(0).(*array.Int64).Value(0); got != 7 {
+			t.Errorf("id = %d, want 7", got)
+		}
+		rec.Release()
+	}
+	if len(sizes) != 3 || sizes[0] != 10 || sizes[1] != 10 || sizes[2] != 5 {
+		t.Errorf("batch sizes = %v, want [10 10 5]", sizes)
+	}
+}
+
+func TestReadCSVRecords_NullsAndQuotes(t *testing.T) {
+	input := "id,note\r\n1,\"multi\nline, with \"\"quotes\"\"\"\r\n\r\n,plain\r\n"
+	opts := defaultCSVSpec()
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "note", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	records := make(chan arrow.RecordBatch, 1)
+	if err := readCSVRecords(context.Background(), strings.NewReader(input), sc, opts, 100, records); err != nil {
+		t.Fatalf("readCSVRecords: %v", err)
+	}
+	close(records)
+
+	rec := <-records
+	defer rec.Release()
+	if rec.NumRows() != 2 {
+		t.Fatalf("NumRows = %d, want 2", rec.NumRows())
+	}
+	notes := rec.Column(1).(*array.String)
+	if got, want := notes.Value(0), "multi\nline, with \"quotes\""; got != want {
+		t.Errorf("note[0] = %q, want %q", got, want)
+	}
+	if got := notes.Value(1); got != "plain" {
+		t.Errorf("note[1] = %q, want %q", got, "plain")
+	}
+	if !rec.Column(0).IsNull(1) {
+		t.Error("id[1] should be null")
+	}
+}
+
+func TestReadCSVRecords_MergedSchema(t *testing.T) {
+	// An older object without the email column, with its columns reordered
+	// relative to the merged table schema.
+	input := "name,id\nalice,1\n"
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+
+	records := make(chan arrow.RecordBatch, 1)
+	if err := readCSVRecords(context.Background(), strings.NewReader(input), sc, defaultCSVSpec(), 100, records); err != nil {
+		t.Fatalf("readCSVRecords: %v", err)
+	}
+	close(records)
+
+	rec := <-records
+	defer rec.Release()
+	if id := rec.Column(0).(*array.Int64).Value(0); id != 1 {
+		t.Errorf("id = %d, want 1", id)
+	}
+	if name := rec.Column(1).(*array.String).Value(0); name != "alice" {
+		t.Errorf("name = %q, want alice", name)
+	}
+	if !rec.Column(2).IsNull(0) {
+		t.Error("email should be null")
+	}
+}
+
+func TestReadCSVRecords_Malformed(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"wrong field count", "id\n1,2\n"},
+		{"unterminated quote", "id\n\"1\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			records := make(chan arrow.RecordBatch, 1)
+			err := readCSVRecords(context.Background(), strings.NewReader(tc.input), sc, defaultCSVSpec(), 100, records)
+			if !errors.Is(err, errMalformedObject) {
+				t.Errorf("expected errMalformedObject, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadCSVRecords_MalformedAfterFirstBatch(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+	for _, tc := range []struct {
+		name  string
+		input string
+		opts  func(*CSVSpec)
+	}{
+		{"wrong field count", "id\n1\n2\n3,4\n", nil},
+		{"wrong field count without header", "1\n2\n3,4\n", func(o *CSVSpec) { o.NoHeader = true }},
+		{"unterminated quote", "id\n1\n2\n\"3\n", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := defaultCSVSpec()
+			if tc.opts != nil {
+				tc.opts(&opts)
+			}
+			records := make(chan arrow.RecordBatch, 10)
+			err := readCSVRecords(context.Background(), strings.NewReader(tc.input), sc, opts, 2, records)
+			close(records)
+			for rec := range records {
+				rec.Release()
+			}
+			// The first batch was emitted, so the object cannot be skipped.
+			if err == nil || errors.Is(err, errMalformedObject) {
+				t.Errorf("expected an error that is not errMalformedObject, got %v", err)
+			}
+		})
+	}
+}
+
+func TestReadCSVRecords_TypeMissAfterInferRows(t *testing.T) {
+	opts := defaultCSVSpec()
+	opts.InferRows = 2
+	input := "id,name\n1,a\n2,b\n3,c\nn/a,d\n"
+
+	sc, err := inferCSVSchema(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatalf("inferCSVSchema: %v", err)
+	}
+	for _, tc := range []struct {
+		name  string
+		input string
+	}{
+		{"header order", input},
+		{"reordered header", "name,id\na,1\nb,2\nc,3\nd,n/a\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			records := make(chan arrow.RecordBatch, 10)
+			err := readCSVRecords(context.Background(), strings.NewReader(tc.input), sc, opts, 2, records)
+			close(records)
+			if !errors.Is(err, errTypeMismatch) || errors.Is(err, errMalformedObject) {
+				t.Errorf("expected errTypeMismatch and not errMalformedObject, got %v", err)
+			}
+			n := 0
+			for rec := range records {
+				n += int(rec.NumRows())
+				rec.Release()
+			}
+			if n != 2 {
+				t.Errorf("emitted %d rows before the type miss, want 2", n)
+			}
+		})
+	}
+}
+
+func TestCSVReader_ByteOrderMark(t *testing.T) {
+	cr := newCSVReader(strings.NewReader("\xef\xbb\xbfid\n1"), defaultCSVSpec())
+	row, err := cr.Read()
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if row[0] != "id" {
+		t.Errorf("header = %q, want %q", row[0], "id")
+	}
+	row, err = cr.Read()
+	if err != nil || row[0] != "1" {
+		t.Fatalf("Read = %q, %v, want [1]", row, err)
+	}
+	if _, err := cr.Read(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
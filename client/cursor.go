@@ -3,21 +3,91 @@ package client
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/cloudquery/plugin-sdk/v4/state"
 )
 
+// StateScope identifies the source whose tables a state backend key belongs
+// to, so that specs reading different prefixes of one bucket, or the same
+// prefix under different state namespaces, keep separate cursors.
+type StateScope struct {
+	Namespace  string
+	Bucket     string
+	PathPrefix string
+}
+
+// stateScope returns the scope of the client's state backend keys.
+func (c *Client) stateScope() StateScope {
+	return StateScope{
+		Namespace:  c.spec.StateNamespace,
+		Bucket:     c.spec.Bucket,
+		PathPrefix: c.spec.PathPrefix,
+	}
+}
+
+// key returns the state backend key of a table's value called name:
+// s3/[{namespace}/]{bucket}/[prefix={path_prefix}/]{table}/{name}. The path
+// prefix is escaped so its slashes do not add segments. Without a namespace
+// and prefix the key is the one used before keys were scoped.
+func (s StateScope) key(tableName, name string) string {
+	var b strings.Builder
+	b.WriteString("s3/")
+	if s.Namespace != "" {
+		b.WriteString(s.Namespace + "/")
+	}
+	b.WriteString(s.Bucket + "/")
+	if s.PathPrefix != "" {
+		b.WriteString("prefix=" + url.PathEscape(s.PathPrefix) + "/")
+	}
+	b.WriteString(tableName + "/" + name)
+	return b.String()
+}
+
+// legacyKey returns the unscoped key of a table's value called name.
+func (s StateScope) legacyKey(tableName, name string) string {
+	return fmt.Sprintf("s3/%s/%s/%s", s.Bucket, tableName, name)
+}
+
+// getStateValue reads a table's value called name. A value found only under
+// the unscoped key of earlier releases is moved to the scoped key, so the
+// first sync after an upgrade continues from it and later specs with other
+// prefixes do not.
+func getStateValue(ctx context.Context, sc state.Client, scope StateScope, tableName, name string) (string, error) {
+	key := scope.key(tableName, name)
+	val, err := sc.GetKey(ctx, key)
+	if err != nil || val != "" {
+		return val, err
+	}
+	legacy := scope.legacyKey(tableName, name)
+	if legacy == key {
+		return "", nil
+	}
+	val, err = sc.GetKey(ctx, legacy)
+	if err != nil || val == "" {
+		return val, err
+	}
+	if err := sc.SetKey(ctx, key, val); err != nil {
+		return "", fmt.Errorf("failed to migrate %s to %s: %w", legacy, key, err)
+	}
+	if err := sc.SetKey(ctx, legacy, ""); err != nil {
+		return "", fmt.Errorf("failed to migrate %s to %s: %w", legacy, key, err)
+	}
+	return val, nil
+}
+
 // CursorKey returns the state backend key for a table's incremental cursor.
-func CursorKey(bucket, tableName string) string {
-	return fmt.Sprintf("s3/%s/%s/last_modified_cursor", bucket, tableName)
+func CursorKey(scope StateScope, tableName string) string {
+	return scope.key(tableName, "last_modified_cursor")
 }
 
 // GetCursor retrieves the stored cursor timestamp for a table.
 // Returns zero-time if no cursor exists or the value cannot be parsed.
-func GetCursor(ctx context.Context, sc state.Client, bucket, tableName string) (time.Time, error) {
-	key := CursorKey(bucket, tableName)
-	val, err := sc.GetKey(ctx, key)
+func GetCursor(ctx context.Context, sc state.Client, scope StateScope, tableName string) (time.Time, error) {
+	val, err := getStateValue(ctx, sc, scope, tableName, "last_modified_cursor")
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to get cursor for %s: %w", tableName, err)
 	}
@@ -33,7 +103,62 @@ func GetCursor(ctx context.Context, sc state.Client, bucket, tableName string) (
 }
 
 // SetCursor stores the cursor timestamp for a table.
-func SetCursor(ctx context.Context, sc state.Client, bucket, tableName string, cursor time.Time) error {
-	key := CursorKey(bucket, tableName)
-	return sc.SetKey(ctx, key, cursor.Format(time.RFC3339Nano))
+func SetCursor(ctx context.Context, sc state.Client, scope StateScope, tableName string, cursor time.Time) error {
+	return sc.SetKey(ctx, CursorKey(scope, tableName), cursor.Format(time.RFC3339Nano))
+}
+
+// DeltaVersionKey returns the state backend key for the last synced version
+// of a Delta table.
+func DeltaVersionKey(scope StateScope, tableName string) string {
+	return scope.key(tableName, "delta_version")
+}
+
+// GetDeltaVersion retrieves the last synced version of a Delta table.
+// Returns -1 if no version is stored or the value cannot be parsed.
+func GetDeltaVersion(ctx context.Context, sc state.Client, scope StateScope, tableName string) (int64, error) {
+	val, err := getStateValue(ctx, sc, scope, tableName, "delta_version")
+	if err != nil {
+		return -1, fmt.Errorf("failed to get delta version for %s: %w", tableName, err)
+	}
+	if val == "" {
+		return -1, nil
+	}
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return -1, nil
+	}
+	return v, nil
+}
+
+// SetDeltaVersion stores the last synced version of a Delta table.
+func SetDeltaVersion(ctx context.Context, sc state.Client, scope StateScope, tableName string, version int64) error {
+	return sc.SetKey(ctx, DeltaVersionKey(scope, tableName), strconv.FormatInt(version, 10))
+}
+
+// IcebergSnapshotKey returns the state backend key for the last synced
+// snapshot of an Iceberg table.
+func IcebergSnapshotKey(scope StateScope, tableName string) string {
+	return scope.key(tableName, "iceberg_snapshot_id")
+}
+
+// GetIcebergSnapshot retrieves the last synced snapshot id of an Iceberg
+// table. Returns -1 if no snapshot is stored or the value cannot be parsed.
+func GetIcebergSnapshot(ctx context.Context, sc state.Client, scope StateScope, tableName string) (int64, error) {
+	val, err := getStateValue(ctx, sc, scope, tableName, "iceberg_snapshot_id")
+	if err != nil {
+		return -1, fmt.Errorf("failed to get iceberg snapshot for %s: %w", tableName, err)
+	}
+	if val == "" {
+		return -1, nil
+	}
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return -1, nil
+	}
+	return v, nil
+}
+
+// SetIcebergSnapshot stores the last synced snapshot id of an Iceberg table.
+func SetIcebergSnapshot(ctx context.Context, sc state.Client, scope StateScope, tableName string, snapshotID int64) error {
+	return sc.SetKey(ctx, IcebergSnapshotKey(scope, tableName), strconv.FormatInt(snapshotID, 10))
 }
@@ -8,11 +8,39 @@ import (
 	"github.com/cloudquery/plugin-sdk/v4/state"
 )
 
+// memState is an in-memory state.Client for tests.
+type memState map[string]string
+
+func (m memState) SetKey(_ context.Context, key, value string) error {
+	m[key] = value
+	return nil
+}
+
+func (m memState) GetKey(_ context.Context, key string) (string, error) {
+	return m[key], nil
+}
+
+func (memState) Flush(context.Context) error { return nil }
+
+func (memState) Close() error { return nil }
+
 func TestCursorKey(t *testing.T) {
-	key := CursorKey("my-bucket", "data_2024")
-	want := "s3/my-bucket/data_2024/last_modified_cursor"
-	if key != want {
-		t.Errorf("CursorKey = %q, want %q", key, want)
+	tests := []struct {
+		name  string
+		scope StateScope
+		want  string
+	}{
+		{"bucket only", StateScope{Bucket: "my-bucket"}, "s3/my-bucket/data_2024/last_modified_cursor"},
+		{"path prefix", StateScope{Bucket: "my-bucket", PathPrefix: "data/2024/"}, "s3/my-bucket/prefix=data%2F2024%2F/data_2024/last_modified_cursor"},
+		{"namespace", StateScope{Namespace: "prod", Bucket: "my-bucket"}, "s3/prod/my-bucket/data_2024/last_modified_cursor"},
+		{"namespace and prefix", StateScope{Namespace: "prod", Bucket: "my-bucket", PathPrefix: "data/"}, "s3/prod/my-bucket/prefix=data%2F/data_2024/last_modified_cursor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key := CursorKey(tt.scope, "data_2024"); key != tt.want {
+				t.Errorf("CursorKey = %q, want %q", key, tt.want)
+			}
+		})
 	}
 }
 
@@ -20,7 +48,7 @@ func TestGetCursor_Empty(t *testing.T) {
 	ctx := context.Background()
 	sc := &state.NoOpClient{}
 
-	cursor, err := GetCursor(ctx, sc, "bucket", "table")
+	cursor, err := GetCursor(ctx, sc, StateScope{Bucket: "bucket"}, "table")
 	if err != nil {
 		t.Fatalf("GetCursor: %v", err)
 	}
@@ -41,3 +69,79 @@ func TestCursor_Roundtrip(t *testing.T) {
 		t.Errorf("roundtrip failed: %v != %v", now, parsed)
 	}
 }
+
+func TestCursor_ScopedByPrefix(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	a := StateScope{Bucket: "bucket", PathPrefix: "a/"}
+	b := StateScope{Bucket: "bucket", PathPrefix: "b/"}
+	cursor := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	if err := SetCursor(ctx, sc, a, "events", cursor); err != nil {
+		t.Fatalf("SetCursor: %v", err)
+	}
+	got, err := GetCursor(ctx, sc, b, "events")
+	if err != nil {
+		t.Fatalf("GetCursor: %v", err)
+	}
+	if !got.IsZero() {
+		t.Errorf("cursor of prefix b/ = %v, want zero", got)
+	}
+	if got, _ := GetCursor(ctx, sc, a, "events"); !got.Equal(cursor) {
+		t.Errorf("cursor of prefix a/ = %v, want %v", got, cursor)
+	}
+}
+
+func TestCursor_MigratesLegacyKey(t *testing.T) {
+	ctx := context.Background()
+	cursor := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	legacy := "s3/bucket/events/last_modified_cursor"
+	sc := memState{legacy: cursor.Format(time.RFC3339Nano)}
+	scope := StateScope{Namespace: "prod", Bucket: "bucket", PathPrefix: "data/"}
+
+	got, err := GetCursor(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetCursor: %v", err)
+	}
+	if !got.Equal(cursor) {
+		t.Errorf("migrated cursor = %v, want %v", got, cursor)
+	}
+	if sc[CursorKey(scope, "events")] != cursor.Format(time.RFC3339Nano) {
+		t.Errorf("cursor not stored under %s: %v", CursorKey(scope, "events"), sc)
+	}
+	if sc[legacy] != "" {
+		t.Errorf("legacy cursor not cleared: %q", sc[legacy])
+	}
+
+	// Another prefix does not pick up the migrated cursor.
+	other := StateScope{Bucket: "bucket", PathPrefix: "other/"}
+	if got, _ := GetCursor(ctx, sc, other, "events"); !got.IsZero() {
+		t.Errorf("cursor of another prefix = %v, want zero", got)
+	}
+}
+
+func TestDeltaVersionKey(t *testing.T) {
+	key := DeltaVersionKey(StateScope{Bucket: "my-bucket"}, "warehouse_events")
+	want := "s3/my-bucket/warehouse_events/delta_version"
+	if key != want {
+		t.Errorf("DeltaVersionKey = %q, want %q", key, want)
+	}
+}
+
+func TestGetDeltaVersion_Empty(t *testing.T) {
+	v, err := GetDeltaVersion(context.Background(), &state.NoOpClient{}, StateScope{Bucket: "bucket"}, "table")
+	if err != nil {
+		t.Fatalf("GetDeltaVersion: %v", err)
+	}
+	if v != -1 {
+		t.Errorf("expected -1, got %d", v)
+	}
+}
+
+func TestIcebergSnapshotKey(t *testing.T) {
+	key := IcebergSnapshotKey(StateScope{Bucket: "my-bucket"}, "warehouse_events")
+	want := "s3/my-bucket/warehouse_events/iceberg_snapshot_id"
+	if key != want {
+		t.Errorf("IcebergSnapshotKey = %q, want %q", key, want)
+	}
+}
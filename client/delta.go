@@ -0,0 +1,710 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/state"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+// deltaLogDir is the directory under a Delta table root holding its
+// transaction log.
+const deltaLogDir = "_delta_log/"
+
+// deltaReaderFeatures are the Delta reader table features that do not change
+// how data files are read and are therefore safe to ignore.
+var deltaReaderFeatures = []string{"timestampNtz", "vacuumProtocolCheck"}
+
+// deltaTable is the state of a Delta table's transaction log at discovery.
+type deltaTable struct {
+	// Root is the key prefix of the table, ending in "/" unless the table
+	// lives at the bucket root.
+	Root string
+	// Version is the latest committed version.
+	Version int64
+	// Commits maps log versions to the keys of their JSON commit files.
+	Commits map[int64]string
+	// PartitionColumns are the table's partition columns in declared order.
+	PartitionColumns []string
+}
+
+// deltaLogListing collects the log files of one Delta table found in a listing.
+type deltaLogListing struct {
+	root    string
+	commits map[int64]string
+	// checkpoints maps checkpoint versions to their part keys, indexed by
+	// part number starting at 0.
+	checkpoints map[int64][]string
+}
+
+// deltaAction is one line of a Delta commit file or one row of a checkpoint.
+// Exactly one field is set.
+type deltaAction struct {
+	Add      *deltaAdd      `json:"add,omitempty"`
+	Remove   *deltaRemove   `json:"remove,omitempty"`
+	MetaData *deltaMetaData `json:"metaData,omitempty"`
+	Protocol *deltaProtocol `json:"protocol,omitempty"`
+}
+
+type deltaAdd struct {
+	Path             string          `json:"path"`
+	PartitionValues  deltaStringMap  `json:"partitionValues"`
+	Size             int64           `json:"size"`
+	ModificationTime int64           `json:"modificationTime"`
+	DataChange       bool            `json:"dataChange"`
+	DeletionVector   json.RawMessage `json:"deletionVector,omitempty"`
+}
+
+type deltaRemove struct {
+	Path       string `json:"path"`
+	DataChange bool   `json:"dataChange"`
+}
+
+type deltaMetaData struct {
+	SchemaString     string         `json:"schemaString"`
+	PartitionColumns []string       `json:"partitionColumns"`
+	Configuration    deltaStringMap `json:"configuration"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int      `json:"minReaderVersion"`
+	ReaderFeatures   []string `json:"readerFeatures"`
+}
+
+// deltaStringMap is a map of nullable strings. Commit files encode it as a
+// JSON object; checkpoints store it as a Parquet map, which Arrow marshals as
+// a list of key/value objects.
+type deltaStringMap map[string]*string
+
+func (m *deltaStringMap) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var entries []struct {
+			Key   string  `json:"key"`
+			Value *string `json:"value"`
+		}
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return err
+		}
+		*m = make(deltaStringMap, len(entries))
+		for _, e := range entries {
+			(*m)[e.Key] = e.Value
+		}
+		return nil
+	}
+	var obj map[string]*string
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	*m = obj
+	return nil
+}
+
+// deltaSnapshot is the result of replaying a Delta log up to a version.
+type deltaSnapshot struct {
+	version  int64
+	metaData *deltaMetaData
+	protocol *deltaProtocol
+	// files maps the path of every live data file to its add action.
+	files map[string]*deltaAdd
+}
+
+func newDeltaSnapshot() *deltaSnapshot {
+	return &deltaSnapshot{version: -1, files: make(map[string]*deltaAdd)}
+}
+
+// apply replays actions in log order.
+func (s *deltaSnapshot) apply(actions []deltaAction) {
+	for _, a := range actions {
+		switch {
+		case a.Add != nil:
+			s.files[a.Add.Path] = a.Add
+		case a.Remove != nil:
+			delete(s.files, a.Remove.Path)
+		case a.MetaData != nil:
+			s.metaData = a.MetaData
+		case a.Protocol != nil:
+			s.protocol = a.Protocol
+		}
+	}
+}
+
+// validate checks that the snapshot can be read without support for reader
+// features that change how data files are interpreted.
+func (s *deltaSnapshot) validate() error {
+	if s.metaData == nil {
+		return fmt.Errorf("delta log has no metaData action")
+	}
+	if p := s.protocol; p != nil {
+		switch {
+		case p.MinReaderVersion <= 1:
+		case p.MinReaderVersion == 2:
+			return fmt.Errorf("delta reader version 2 (column mapping) is not supported")
+		default:
+			for _, f := range p.ReaderFeatures {
+				if !slices.Contains(deltaReaderFeatures, f) {
+					return fmt.Errorf("delta reader feature %q is not supported", f)
+				}
+			}
+		}
+	}
+	if mode := s.metaData.Configuration["delta.columnMapping.mode"]; mode != nil && *mode != "none" {
+		return fmt.Errorf("delta column mapping mode %q is not supported", *mode)
+	}
+	for p, add := range s.files {
+		if len(add.DeletionVector) > 0 && string(add.DeletionVector) != "null" {
+			return fmt.Errorf("data file %s has a deletion vector, which is not supported", p)
+		}
+	}
+	return nil
+}
+
+// discoverDeltaTables finds Delta table roots by their _delta_log directories
+// and returns one table per root whose objects are the live data files.
+func (c *Client) discoverDeltaTables(ctx context.Context) ([]DiscoveredTable, error) {
+	logObjects, err := c.listObjectsMatching(ctx, isDeltaLogKey)
+	if err != nil {
+		return nil, err
+	}
+
+	listings := findDeltaLogs(logObjects)
+	roots := make([]string, 0, len(listings))
+	for root := range listings {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	tables := make([]DiscoveredTable, 0, len(roots))
+	for _, root := range roots {
+		l := listings[root]
+		snap, err := c.loadDeltaSnapshot(ctx, l)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delta log of %s: %w", root, err)
+		}
+		dt, err := c.deltaDiscoveredTable(l, snap)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delta table %s: %w", root, err)
+		}
+		if len(dt.Objects) == 0 {
+			c.logger.Info().Str("root", root).Int64("version", snap.version).Msg("delta table has no data files, skipping")
+			continue
+		}
+		tables = append(tables, dt)
+	}
+	return tables, nil
+}
+
+// deltaDiscoveredTable builds a discovered table from a replayed snapshot.
+func (c *Client) deltaDiscoveredTable(l *deltaLogListing, snap *deltaSnapshot) (DiscoveredTable, error) {
+	name := naming.Normalize(l.root)
+	if l.root == "" {
+		name = naming.Normalize(c.spec.Bucket + "/")
+	}
+
+	partitionFields, err := deltaPartitionFields(snap.metaData)
+	if err != nil {
+		return DiscoveredTable{}, err
+	}
+
+	paths := make([]string, 0, len(snap.files))
+	for p := range snap.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	objects := make([]S3Object, 0, len(paths))
+	for _, p := range paths {
+		obj, err := c.deltaObject(l.root, snap.metaData.PartitionColumns, snap.files[p])
+		if err != nil {
+			return DiscoveredTable{}, err
+		}
+		objects = append(objects, obj)
+	}
+
+	return DiscoveredTable{
+		Name:       name,
+		Prefix:     l.root,
+		Objects:    objects,
+		Partitions: partitionFields,
+		delta: &deltaTable{
+			Root:             l.root,
+			Version:          snap.version,
+			Commits:          l.commits,
+			PartitionColumns: snap.metaData.PartitionColumns,
+		},
+	}, nil
+}
+
+// deltaObject converts an add action into the S3 object of its data file.
+func (c *Client) deltaObject(root string, partitionColumns []string, add *deltaAdd) (S3Object, error) {
+	key, err := deltaObjectKey(c.spec.Bucket, root, add.Path)
+	if err != nil {
+		return S3Object{}, err
+	}
+	partitions := make([]naming.Partition, 0, len(partitionColumns))
+	for _, col := range partitionColumns {
+		p := naming.Partition{Key: col}
+		if v := add.PartitionValues[col]; v != nil {
+			p.Value = *v
+		}
+		partitions = append(partitions, p)
+	}
+	return S3Object{
+		Key:          key,
+		Size:         add.Size,
+		LastModified: time.UnixMilli(add.ModificationTime).UTC().Format(time.RFC3339Nano),
+		Partitions:   partitions,
+	}, nil
+}
+
+// deltaObjectKey resolves an add action path, which is either a URL-encoded
+// path relative to the table root or an absolute s3:// URI, to an object key.
+func deltaObjectKey(bucket, root, p string) (string, error) {
+	u, err := url.Parse(p)
+	if err != nil {
+		return "", fmt.Errorf("invalid data file path %q: %w", p, err)
+	}
+	if u.Scheme == "" {
+		return root + u.Path, nil
+	}
+	return s3URIKey(bucket, p)
+}
+
+// deltaPartitionFields returns the Arrow fields of the partition columns,
+// typed from the table schema. Integer columns become int64, date columns
+// date32 and all other types strings, matching Hive-style partitions.
+func deltaPartitionFields(md *deltaMetaData) ([]arrow.Field, error) {
+	if len(md.PartitionColumns) == 0 {
+		return nil, nil
+	}
+	var sc struct {
+		Fields []struct {
+			Name string          `json:"name"`
+			Type json.RawMessage `json:"type"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal([]byte(md.SchemaString), &sc); err != nil {
+		return nil, fmt.Errorf("invalid delta schemaString: %w", err)
+	}
+	colTypes := make(map[string]string, len(sc.Fields))
+	for _, f := range sc.Fields {
+		var t string
+		// Nested types are JSON objects and stay unset.
+		_ = json.Unmarshal(f.Type, &t)
+		colTypes[f.Name] = t
+	}
+
+	fields := make([]arrow.Field, 0, len(md.PartitionColumns))
+	for _, col := range md.PartitionColumns {
+		var dt arrow.DataType = arrow.BinaryTypes.String
+		switch colTypes[col] {
+		case "byte", "short", "integer", "long":
+			dt = arrow.PrimitiveTypes.Int64
+		case "date":
+			dt = arrow.FixedWidthTypes.Date32
+		}
+		fields = append(fields, arrow.Field{Name: col, Type: dt, Nullable: true})
+	}
+	return fields, nil
+}
+
+// isDeltaLogKey reports whether key is inside a Delta transaction log.
+func isDeltaLogKey(key string) bool {
+	return strings.HasPrefix(key, deltaLogDir) || strings.Contains(key, "/"+deltaLogDir)
+}
+
+// findDeltaLogs groups _delta_log objects by table root and classifies them
+// as commits or checkpoint parts. Other log files are ignored.
+func findDeltaLogs(objects []S3Object) map[string]*deltaLogListing {
+	listings := make(map[string]*deltaLogListing)
+	for _, obj := range objects {
+		idx := strings.LastIndex(obj.Key, deltaLogDir)
+		if idx < 0 || (idx > 0 && obj.Key[idx-1] != '/') {
+			continue
+		}
+		root, name := obj.Key[:idx], obj.Key[idx+len(deltaLogDir):]
+		if strings.Contains(name, "/") {
+			continue
+		}
+		l, ok := listings[root]
+		if !ok {
+			l = &deltaLogListing{
+				root:        root,
+				commits:     make(map[int64]string),
+				checkpoints: make(map[int64][]string),
+			}
+			listings[root] = l
+		}
+		l.add(obj.Key, name)
+	}
+	return listings
+}
+
+// add classifies one log file by name:
+//
+//	00000000000000000010.json                                  commit
+//	00000000000000000010.checkpoint.parquet                    single-part checkpoint
+//	00000000000000000010.checkpoint.0000000001.0000000002.parquet  multi-part checkpoint
+func (l *deltaLogListing) add(key, name string) {
+	versionStr, rest, ok := strings.Cut(name, ".")
+	if !ok || len(versionStr) != 20 {
+		return
+	}
+	version, err := strconv.ParseInt(versionStr, 10, 64)
+	if err != nil {
+		return
+	}
+	switch {
+	case rest == "json":
+		l.commits[version] = key
+	case rest == "checkpoint.parquet":
+		l.checkpoints[version] = []string{key}
+	case strings.HasPrefix(rest, "checkpoint.") && strings.HasSuffix(rest, ".parquet"):
+		parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(rest, "checkpoint."), ".parquet"), ".")
+		if len(parts) != 2 {
+			return
+		}
+		part, err1 := strconv.Atoi(parts[0])
+		total, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || part < 1 || part > total {
+			return
+		}
+		keys := l.checkpoints[version]
+		if len(keys) != total {
+			keys = make([]string, total)
+			l.checkpoints[version] = keys
+		}
+		keys[part-1] = key
+	}
+}
+
+// latestCheckpoint returns the highest checkpoint version whose parts are all
+// present, or -1 if there is none.
+func (l *deltaLogListing) latestCheckpoint() int64 {
+	latest := int64(-1)
+	for version, keys := range l.checkpoints {
+		if version > latest && !slices.Contains(keys, "") {
+			latest = version
+		}
+	}
+	return latest
+}
+
+// latestVersion returns the highest committed version, or -1 if the log has
+// no commits or checkpoints.
+func (l *deltaLogListing) latestVersion() int64 {
+	latest := l.latestCheckpoint()
+	for version := range l.commits {
+		latest = max(latest, version)
+	}
+	return latest
+}
+
+// loadDeltaSnapshot replays the latest checkpoint and every later commit.
+func (c *Client) loadDeltaSnapshot(ctx context.Context, l *deltaLogListing) (*deltaSnapshot, error) {
+	snap := newDeltaSnapshot()
+	checkpoint := l.latestCheckpoint()
+	for _, key := range l.checkpoints[checkpoint] {
+		actions, err := c.readDeltaCheckpoint(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		snap.apply(actions)
+	}
+
+	latest := l.latestVersion()
+	if latest < 0 {
+		return nil, fmt.Errorf("no commits found")
+	}
+	actions, err := c.readDeltaCommits(ctx, l.commits, checkpoint+1, latest)
+	if err != nil {
+		return nil, err
+	}
+	snap.apply(actions)
+	snap.version = latest
+
+	if err := snap.validate(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// readDeltaCommits reads the actions of commits from through to, in order.
+// Every commit in the range must be present in commits.
+func (c *Client) readDeltaCommits(ctx context.Context, commits map[int64]string, from, to int64) ([]deltaAction, error) {
+	var actions []deltaAction
+	for version := from; version <= to; version++ {
+		key, ok := commits[version]
+		if !ok {
+			return nil, fmt.Errorf("commit %d is missing from the delta log", version)
+		}
+		body, err := c.openObject(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		commitActions, err := readDeltaActions(body)
+		_ = body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delta commit %s: %w", key, err)
+		}
+		actions = append(actions, commitActions...)
+	}
+	return actions, nil
+}
+
+// readDeltaActions decodes a newline-delimited JSON commit file.
+func readDeltaActions(r io.Reader) ([]deltaAction, error) {
+	var actions []deltaAction
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var a deltaAction
+			if jsonErr := json.Unmarshal(line, &a); jsonErr != nil {
+				return nil, jsonErr
+			}
+			actions = append(actions, a)
+		}
+		if err == io.EOF {
+			return actions, nil
+		}
+	}
+}
+
+// readDeltaCheckpoint reads one checkpoint part and returns its actions.
+func (c *Client) readDeltaCheckpoint(ctx context.Context, key string) ([]deltaAction, error) {
+	src, cleanup, err := c.parquetSource(ctx, key, c.spec.ReadMode == "stream", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	actions, err := readDeltaCheckpointFile(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta checkpoint %s: %w", key, err)
+	}
+	return actions, nil
+}
+
+// readDeltaCheckpointFile reads the add, remove, metaData and protocol
+// actions from a checkpoint Parquet file. Each row holds one action in the
+// column named after it; rows are converted through JSON so checkpoints and
+// commits share a decoder.
+func readDeltaCheckpointFile(ctx context.Context, src parquet.ReaderAtSeeker) ([]deltaAction, error) {
+	pf, err := file.NewParquetReader(src)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = pf.Close() }()
+
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := reader.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Release()
+
+	var actions []deltaAction
+	for rr.Next() {
+		rec := rr.RecordBatch()
+		for _, name := range []string{"protocol", "metaData", "add", "remove"} {
+			idx := rec.Schema().FieldIndices(name)
+			if len(idx) == 0 {
+				continue
+			}
+			col, ok := rec.Column(idx[0]).(*array.Struct)
+			if !ok {
+				continue
+			}
+			for i := 0; i < col.Len(); i++ {
+				if col.IsNull(i) {
+					continue
+				}
+				data, err := json.Marshal(map[string]any{name: col.GetOneForMarshal(i)})
+				if err != nil {
+					return nil, err
+				}
+				var a deltaAction
+				if err := json.Unmarshal(data, &a); err != nil {
+					return nil, fmt.Errorf("invalid %s action: %w", name, err)
+				}
+				actions = append(actions, a)
+			}
+		}
+	}
+	if err := rr.Err(); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// deltaChanges are the data changes of a range of Delta commits.
+type deltaChanges struct {
+	// added are the add actions with data changes whose files were not
+	// removed by a later data change in the range.
+	added []*deltaAdd
+	// removed are the paths of files added before the range and removed by a
+	// data change in it, such as by DELETE, UPDATE, MERGE or OVERWRITE.
+	removed []string
+}
+
+// deltaChangesSince returns the data changes among the given commit actions.
+// Unless rewrites is set, files rewritten without data changes (OPTIMIZE,
+// compaction) are neither added nor removed because their rows were already
+// synced from the files they replace. Syncs that delete rows by _s3_key set
+// it, so that synced rows always carry the key of a live file and a later
+// change removing the rewritten file deletes them.
+func deltaChangesSince(actions []deltaAction, rewrites bool) deltaChanges {
+	var order, removedOrder []string
+	added := make(map[string]*deltaAdd)
+	removed := make(map[string]bool)
+	for _, a := range actions {
+		switch {
+		case a.Add != nil && (a.Add.DataChange || rewrites):
+			if _, ok := added[a.Add.Path]; !ok {
+				order = append(order, a.Add.Path)
+			}
+			added[a.Add.Path] = a.Add
+		case a.Remove != nil && (a.Remove.DataChange || rewrites):
+			if _, ok := added[a.Remove.Path]; ok {
+				// Added and removed in the range, so never synced.
+				delete(added, a.Remove.Path)
+				continue
+			}
+			if !removed[a.Remove.Path] {
+				removed[a.Remove.Path] = true
+				removedOrder = append(removedOrder, a.Remove.Path)
+			}
+		}
+	}
+	changes := deltaChanges{added: make([]*deltaAdd, 0, len(added)), removed: removedOrder}
+	for _, p := range order {
+		if add, ok := added[p]; ok {
+			changes.added = append(changes.added, add)
+		}
+	}
+	return changes
+}
+
+// deltaObjectsSince returns the objects to sync for a Delta table whose
+// rows up to version since were already synced, and the keys of the objects
+// whose synced rows were removed since. With keyed set, the table's rows are
+// deleted by _s3_key and files rewritten without data changes are included.
+// A negative since selects every live data file. If commits after since have
+// been cleaned up from the log, the files removed since are unknown, so
+// neither their rows can be deleted nor the live files synced again without
+// duplicating rows, and an error asks for a full refresh instead.
+func (c *Client) deltaObjectsSince(ctx context.Context, dt *DiscoveredTable, since int64, keyed bool) ([]S3Object, []string, error) {
+	d := dt.delta
+	if since < 0 {
+		return dt.Objects, nil, nil
+	}
+	if since >= d.Version {
+		return nil, nil, nil
+	}
+
+	for version := since + 1; version <= d.Version; version++ {
+		if _, ok := d.Commits[version]; !ok {
+			return nil, nil, fmt.Errorf("delta commit %d after the synced version %d has been cleaned up from the log, so the rows changed since cannot be determined; list the table in full_refresh to sync it in full", version, since)
+		}
+	}
+	actions, err := c.readDeltaCommits(ctx, d.Commits, since+1, d.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := deltaChangesSince(actions, keyed)
+	objects := make([]S3Object, 0, len(changes.added))
+	for _, add := range changes.added {
+		if len(add.DeletionVector) > 0 && string(add.DeletionVector) != "null" {
+			return nil, nil, fmt.Errorf("data file %s has a deletion vector, which is not supported", add.Path)
+		}
+		obj, err := c.deltaObject(d.Root, d.PartitionColumns, add)
+		if err != nil {
+			return nil, nil, err
+		}
+		objects = append(objects, obj)
+	}
+	removed := make([]string, 0, len(changes.removed))
+	for _, p := range changes.removed {
+		key, err := deltaObjectKey(c.spec.Bucket, d.Root, p)
+		if err != nil {
+			return nil, nil, err
+		}
+		removed = append(removed, key)
+	}
+	return objects, removed, nil
+}
+
+// syncDeltaTable syncs the data files of a Delta table added since the
+// version recorded in the state backend and records the new version. The
+// rows of data files removed since, by commits that update or delete rows or
+// compact files, are deleted by their _s3_key before the files rewriting them
+// are synced.
+func (c *Client) syncDeltaTable(ctx context.Context, stateClient state.Client, table *schema.Table, dt *DiscoveredTable, res chan<- message.SyncMessage) error {
+	since, err := GetDeltaVersion(ctx, stateClient, c.stateScope(), table.Name)
+	if err != nil {
+		return err
+	}
+
+	keyed := table.Columns.Get(sourceKeyColumn) != nil
+	objects, removed, err := c.deltaObjectsSince(ctx, dt, since, keyed)
+	if err != nil {
+		return err
+	}
+	deletes, err := deleteRemovedObjects(table, removed, fmt.Sprintf("delta commits after version %d", since))
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info().
+		Str("table", table.Name).
+		Int64("delta_version", dt.delta.Version).
+		Int64("synced_version", since).
+		Int("total_objects", len(dt.Objects)).
+		Int("new_objects", len(objects)).
+		Int("removed_objects", len(removed)).
+		Bool("incremental", since >= 0).
+		Msg("syncing table")
+
+	res <- &message.SyncMigrateTable{Table: table}
+	for _, msg := range deletes {
+		res <- msg
+	}
+
+	if len(objects) > 0 {
+		if err := c.syncTableObjects(ctx, dt, objects, res, nil); err != nil {
+			return err
+		}
+	}
+
+	if dt.delta.Version != since {
+		if err := SetDeltaVersion(ctx, stateClient, c.stateScope(), table.Name, dt.delta.Version); err != nil {
+			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to set delta version")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+const testDeltaSchemaString = `{"type":"struct","fields":[` +
+	`{"name":"id","type":"long","nullable":true,"metadata":{}},` +
+	`{"name":"day","type":"date","nullable":true,"metadata":{}},` +
+	`{"name":"region","type":"string","nullable":true,"metadata":{}},` +
+	`{"name":"shard","type":"integer","nullable":true,"metadata":{}}]}`
+
+func TestFindDeltaLogs(t *testing.T) {
+	objects := []S3Object{
+		{Key: "warehouse/events/_delta_log/00000000000000000000.json"},
+		{Key: "warehouse/events/_delta_log/00000000000000000001.json"},
+		{Key: "warehouse/events/_delta_log/00000000000000000001.checkpoint.parquet"},
+		{Key: "warehouse/events/_delta_log/00000000000000000002.json"},
+		{Key: "warehouse/events/_delta_log/00000000000000000002.checkpoint.0000000001.0000000002.parquet"},
+		{Key: "warehouse/events/_delta_log/_last_checkpoint"},
+		{Key: "warehouse/events/_delta_log/00000000000000000000.crc"},
+		{Key: "_delta_log/00000000000000000000.json"},
+		{Key: "warehouse/not_delta_log/00000000000000000000.json"},
+	}
+
+	listings := findDeltaLogs(objects)
+	if len(listings) != 2 {
+		t.Fatalf("got %d roots, want 2: %v", len(listings), listings)
+	}
+	l := listings["warehouse/events/"]
+	if l == nil {
+		t.Fatalf("missing warehouse/events/ root in %v", listings)
+	}
+	if len(l.commits) != 3 {
+		t.Errorf("commits = %v, want versions 0-2", l.commits)
+	}
+	// Version 2's multi-part checkpoint is missing its second part.
+	if got := l.latestCheckpoint(); got != 1 {
+		t.Errorf("latestCheckpoint = %d, want 1", got)
+	}
+	if got := l.latestVersion(); got != 2 {
+		t.Errorf("latestVersion = %d, want 2", got)
+	}
+	if _, ok := listings[""]; !ok {
+		t.Error("missing bucket root table")
+	}
+}
+
+func TestDeltaSnapshot_Replay(t *testing.T) {
+	commits := []string{
+		`{"protocol":{"minReaderVersion":1,"minWriterVersion":2}}
+{"metaData":{"id":"x","format":{"provider":"parquet","options":{}},"schemaString":` + jsonQuote(testDeltaSchemaString) + `,"partitionColumns":["day","region"],"configuration":{}}}
+{"add":{"path":"day=2024-01-01/region=us/a.parquet","partitionValues":{"day":"2024-01-01","region":"us"},"size":10,"modificationTime":1704067200000,"dataChange":true}}
+`,
+		`{"commitInfo":{"operation":"WRITE"}}
+{"add":{"path":"day=2024-01-02/region=__HIVE_DEFAULT_PARTITION__/b%20c.parquet","partitionValues":{"day":"2024-01-02","region":null},"size":20,"modificationTime":1704153600000,"dataChange":true}}
+`,
+		`{"remove":{"path":"day=2024-01-01/region=us/a.parquet","dataChange":false}}
+{"add":{"path":"day=2024-01-01/region=us/compacted.parquet","partitionValues":{"day":"2024-01-01","region":"us"},"size":10,"modificationTime":1704240000000,"dataChange":false}}
+`,
+	}
+
+	snap := newDeltaSnapshot()
+	var all []deltaAction
+	for _, commit := range commits {
+		actions, err := readDeltaActions(strings.NewReader(commit))
+		if err != nil {
+			t.Fatalf("readDeltaActions: %v", err)
+		}
+		snap.apply(actions)
+		all = append(all, actions...)
+	}
+	if err := snap.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if len(snap.files) != 2 {
+		t.Fatalf("live files = %v, want 2", snap.files)
+	}
+	if _, ok := snap.files["day=2024-01-01/region=us/a.parquet"]; ok {
+		t.Error("removed file is still live")
+	}
+
+	c := &Client{spec: Spec{Bucket: "b"}}
+	obj, err := c.deltaObject("warehouse/events/", snap.metaData.PartitionColumns, snap.files["day=2024-01-02/region=__HIVE_DEFAULT_PARTITION__/b%20c.parquet"])
+	if err != nil {
+		t.Fatalf("deltaObject: %v", err)
+	}
+	if obj.Key != "warehouse/events/day=2024-01-02/region=__HIVE_DEFAULT_PARTITION__/b c.parquet" {
+		t.Errorf("Key = %q", obj.Key)
+	}
+	if obj.LastModified != "2024-01-02T00:00:00Z" {
+		t.Errorf("LastModified = %q", obj.LastModified)
+	}
+	if len(obj.Partitions) != 2 || obj.Partitions[0].Value != "2024-01-02" || obj.Partitions[1].Value != "" {
+		t.Errorf("Partitions = %v, want day=2024-01-02 and null region", obj.Partitions)
+	}
+
+	// Incremental sync from version 0 only picks up the append in version 1;
+	// the compaction in version 2 rewrites rows that were already synced.
+	changes := deltaChangesSince(all[3:], false)
+	if len(changes.added) != 1 || !strings.HasSuffix(changes.added[0].Path, "b%20c.parquet") {
+		t.Errorf("added = %v, want only the version 1 append", changes.added)
+	}
+	if len(changes.removed) != 0 {
+		t.Errorf("removed = %v, want none for a compaction", changes.removed)
+	}
+
+	// Deleting rows by _s3_key replays the compaction so that rows carry the
+	// key of the compacted file.
+	changes = deltaChangesSince(all[3:], true)
+	if len(changes.added) != 2 || changes.added[1].Path != "day=2024-01-01/region=us/compacted.parquet" {
+		t.Errorf("added = %v, want the append and the compacted file", changes.added)
+	}
+	if got := strings.Join(changes.removed, ","); got != "day=2024-01-01/region=us/a.parquet" {
+		t.Errorf("removed = %s, want the compacted-away file", got)
+	}
+}
+
+func TestDeltaChangesSince_RewritesAndDeletes(t *testing.T) {
+	// An UPDATE rewrites a.parquet, a DELETE drops b.parquet, and a file
+	// added and deleted within the range is neither synced nor deleted.
+	commits := `{"commitInfo":{"operation":"UPDATE"}}
+{"remove":{"path":"a.parquet","dataChange":true}}
+{"add":{"path":"a-rewritten.parquet","partitionValues":{},"size":1,"modificationTime":1,"dataChange":true}}
+{"commitInfo":{"operation":"DELETE"}}
+{"remove":{"path":"b.parquet","dataChange":true}}
+{"add":{"path":"c.parquet","partitionValues":{},"size":1,"modificationTime":2,"dataChange":true}}
+{"remove":{"path":"c.parquet","dataChange":true}}
+`
+	actions, err := readDeltaActions(strings.NewReader(commits))
+	if err != nil {
+		t.Fatalf("readDeltaActions: %v", err)
+	}
+	changes := deltaChangesSince(actions, false)
+	if len(changes.added) != 1 || changes.added[0].Path != "a-rewritten.parquet" {
+		t.Errorf("added = %v, want a-rewritten.parquet", changes.added)
+	}
+	if got := strings.Join(changes.removed, ","); got != "a.parquet,b.parquet" {
+		t.Errorf("removed = %s, want a.parquet,b.parquet", got)
+	}
+}
+
+func TestDeltaObjectsSince_CleanedUpCommits(t *testing.T) {
+	// Version 2 was cleaned up from the log, so the files it removed are
+	// unknown and syncing the live files again would duplicate their rows.
+	dt := &DiscoveredTable{
+		Name:    "events",
+		Objects: []S3Object{{Key: "events/a.parquet"}},
+		delta:   &deltaTable{Root: "events/", Version: 3, Commits: map[int64]string{3: "events/_delta_log/00000000000000000003.json"}},
+	}
+	for _, keyed := range []bool{false, true} {
+		objects, removed, err := (&Client{}).deltaObjectsSince(context.Background(), dt, 1, keyed)
+		if err == nil || !strings.Contains(err.Error(), "full_refresh") {
+			t.Errorf("keyed %v: expected an error asking for full_refresh, got %v", keyed, err)
+		}
+		if len(objects) != 0 || len(removed) != 0 {
+			t.Errorf("keyed %v: got %d objects and %d removed keys, want none", keyed, len(objects), len(removed))
+		}
+	}
+}
+
+func TestDeltaSnapshot_Unsupported(t *testing.T) {
+	for name, commit := range map[string]string{
+		"column mapping":   `{"protocol":{"minReaderVersion":2,"minWriterVersion":5}}`,
+		"deletion vectors": `{"protocol":{"minReaderVersion":3,"minWriterVersion":7,"readerFeatures":["deletionVectors"]}}`,
+		"no metadata":      `{"protocol":{"minReaderVersion":1,"minWriterVersion":2}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			actions, err := readDeltaActions(strings.NewReader(commit))
+			if err != nil {
+				t.Fatalf("readDeltaActions: %v", err)
+			}
+			snap := newDeltaSnapshot()
+			snap.apply(actions)
+			if name != "no metadata" {
+				snap.metaData = &deltaMetaData{SchemaString: testDeltaSchemaString}
+			}
+			if err := snap.validate(); err == nil {
+				t.Error("expected validate to fail")
+			}
+		})
+	}
+}
+
+func TestDeltaPartitionFields(t *testing.T) {
+	fields, err := deltaPartitionFields(&deltaMetaData{
+		SchemaString:     testDeltaSchemaString,
+		PartitionColumns: []string{"day", "region", "shard"},
+	})
+	if err != nil {
+		t.Fatalf("deltaPartitionFields: %v", err)
+	}
+	want := []arrow.DataType{arrow.FixedWidthTypes.Date32, arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int64}
+	if len(fields) != len(want) {
+		t.Fatalf("got %d fields, want %d", len(fields), len(want))
+	}
+	for i, w := range want {
+		if !arrow.TypeEqual(fields[i].Type, w) {
+			t.Errorf("field %s type = %v, want %v", fields[i].Name, fields[i].Type, w)
+		}
+	}
+}
+
+func TestDeltaObjectKey(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"part-0.parquet", "root/part-0.parquet", false},
+		{"d=2024-01-01%2010%3A00/part-0.parquet", "root/d=2024-01-01 10:00/part-0.parquet", false},
+		{"s3://b/elsewhere/part-0.parquet", "elsewhere/part-0.parquet", false},
+		{"s3a://other/part-0.parquet", "", true},
+		{"abfss://c@acct/part-0.parquet", "", true},
+	}
+	for _, tc := range tests {
+		got, err := deltaObjectKey("b", "root/", tc.path)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("deltaObjectKey(%q) error = %v, wantErr %v", tc.path, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("deltaObjectKey(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestReadDeltaCheckpointFile(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "protocol", Type: arrow.StructOf(
+			arrow.Field{Name: "minReaderVersion", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		), Nullable: true},
+		{Name: "metaData", Type: arrow.StructOf(
+			arrow.Field{Name: "schemaString", Type: arrow.BinaryTypes.String, Nullable: true},
+			arrow.Field{Name: "partitionColumns", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+			arrow.Field{Name: "configuration", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.BinaryTypes.String), Nullable: true},
+		), Nullable: true},
+		{Name: "add", Type: arrow.StructOf(
+			arrow.Field{Name: "path", Type: arrow.BinaryTypes.String, Nullable: true},
+			arrow.Field{Name: "partitionValues", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.BinaryTypes.String), Nullable: true},
+			arrow.Field{Name: "size", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+			arrow.Field{Name: "modificationTime", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+			arrow.Field{Name: "dataChange", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+		), Nullable: true},
+	}, nil)
+
+	rows := `[
+{"protocol": {"minReaderVersion": 1}},
+{"metaData": {"schemaString": ` + jsonQuote(testDeltaSchemaString) + `, "partitionColumns": ["region"], "configuration": []}},
+{"add": {"path": "region=us/a.parquet", "partitionValues": [{"key": "region", "value": "us"}], "size": 5, "modificationTime": 1704067200000, "dataChange": false}}
+]`
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, sc, strings.NewReader(rows))
+	if err != nil {
+		t.Fatalf("RecordFromJSON: %v", err)
+	}
+	defer rec.Release()
+
+	name := filepath.Join(t.TempDir(), "00000000000000000010.checkpoint.parquet")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := pqarrow.NewFileWriter(sc, f, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("NewFileWriter: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions, err := readDeltaCheckpointFile(context.Background(), src)
+	if err != nil {
+		t.Fatalf("readDeltaCheckpointFile: %v", err)
+	}
+	snap := newDeltaSnapshot()
+	snap.apply(actions)
+	if err := snap.validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	add := snap.files["region=us/a.parquet"]
+	if add == nil {
+		t.Fatalf("checkpoint add missing from %v", snap.files)
+	}
+	if v := add.PartitionValues["region"]; v == nil || *v != "us" || add.Size != 5 {
+		t.Errorf("add = %+v, want region=us size=5", add)
+	}
+	if len(snap.metaData.PartitionColumns) != 1 || snap.metaData.PartitionColumns[0] != "region" {
+		t.Errorf("partitionColumns = %v", snap.metaData.PartitionColumns)
+	}
+}
+
+func jsonQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
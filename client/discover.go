@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
@@ -20,6 +21,9 @@ type S3Object struct {
 	Key          string
 	Size         int64
 	LastModified string // RFC3339Nano
+	ETag         string
+	// Partitions holds the Hive-style key=value segments parsed from Key.
+	Partitions []naming.Partition
 }
 
 // DiscoveredTable represents a logical table derived from S3 key prefixes.
@@ -28,56 +32,182 @@ type DiscoveredTable struct {
 	Prefix      string
 	Objects     []S3Object
 	ArrowSchema *arrow.Schema
-	Table       *schema.Table
+	// Partitions are the columns derived from Hive-style key=value path
+	// segments that are appended to every record of the table.
+	Partitions []arrow.Field
+	Table      *schema.Table
+
+	// delta is set for tables discovered from a Delta Lake transaction log.
+	delta *deltaTable
+	// iceberg is set for tables discovered from Iceberg metadata files.
+	iceberg *icebergTable
+	// mismatches are the objects excluded from the table by the
+	// schema_mismatch policy.
+	mismatches []schemaMismatch
+	// deterministicCqID is set when the plugin adds _cq_id to the rows of the
+	// table, deriving it from each row with cq_id "deterministic".
+	deterministicCqID bool
+	// cqIDColumns are the columns deterministic ids are derived from; ids
+	// are derived from each row's object and position if empty.
+	cqIDColumns []string
+	// cloudQueryName is the original name of a table whose objects were
+	// written by a CloudQuery destination, if its metadata is honored.
+	cloudQueryName string
+	// quarantine is set for the table listing quarantined objects.
+	quarantine []quarantinedObject
+	// source is the client of the bucket the table was discovered in.
+	source *Client
 }
 
-// discover lists S3 objects, groups them by prefix into tables, reads schemas,
-// validates schema consistency, and builds CQ tables.
+// discover discovers the tables of every source. Table names must be unique
+// across sources; sources sharing table names need a table_prefix.
 func (c *Client) discover(ctx context.Context) ([]DiscoveredTable, error) {
-	objects, err := c.listObjects(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list objects: %w", err)
+	var (
+		tables      []DiscoveredTable
+		quarantined []quarantinedObject
+	)
+	sourceOf := make(map[string]*Client)
+	for _, src := range c.sourceClients() {
+		srcTables, srcQuarantined, err := src.discoverSource(ctx)
+		if err != nil {
+			if len(c.sources) > 0 {
+				return nil, fmt.Errorf("source s3://%s/%s: %w", src.spec.Bucket, src.spec.PathPrefix, err)
+			}
+			return nil, err
+		}
+		for i := range srcTables {
+			name := srcTables[i].Name
+			if other, ok := sourceOf[name]; ok {
+				return nil, fmt.Errorf("table %s is discovered in both s3://%s/%s and s3://%s/%s; set a table_prefix on one of the sources",
+					name, other.spec.Bucket, other.spec.PathPrefix, src.spec.Bucket, src.spec.PathPrefix)
+			}
+			sourceOf[name] = src
+			srcTables[i].source = src
+		}
+		tables = append(tables, srcTables...)
+		quarantined = append(quarantined, srcQuarantined...)
+	}
+
+	if c.spec.SchemaMismatch == "quarantine" {
+		if _, ok := sourceOf[quarantineTableName]; ok {
+			return nil, fmt.Errorf("table %s is reserved for quarantined objects", quarantineTableName)
+		}
+		tables = append(tables, quarantineTable(quarantined))
+	}
+	return tables, nil
+}
+
+// discoverSource lists the S3 objects of the client's bucket, groups them by
+// prefix into tables, reads schemas, validates schema consistency, and builds
+// CQ tables. It also returns the objects quarantined by the schema_mismatch
+// policy.
+func (c *Client) discoverSource(ctx context.Context) ([]DiscoveredTable, []quarantinedObject, error) {
+	var tables []DiscoveredTable
+	switch c.spec.TableFormat {
+	case "delta":
+		var err error
+		tables, err = c.discoverDeltaTables(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover delta tables: %w", err)
+		}
+	case "iceberg":
+		var err error
+		tables, err = c.discoverIcebergTables(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover iceberg tables: %w", err)
+		}
+	default:
+		objects, err := c.listObjects(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list objects: %w", err)
+		}
+		mapping, err := newTableMapping(c.spec.Tables)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid tables: %w", err)
+		}
+		if c.spec.DestinationPath != "" {
+			rule, err := newDestinationPathRule(c.spec.DestinationPath)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid destination_path: %w", err)
+			}
+			mapping.rules = append(mapping.rules, rule)
+		}
+		tables = groupByPrefix(objects, mapping)
+		for _, dt := range tables {
+			if err := checkPartitionKeys(dt.Objects); err != nil {
+				return nil, nil, fmt.Errorf("table %s: %w", dt.Name, err)
+			}
+		}
 	}
 
-	tables := groupByPrefix(objects)
+	fullRefresh, err := newTableMatcher("full_refresh", c.spec.FullRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	primaryKeys, err := newPrimaryKeyRules(c.spec.PrimaryKeys)
+	if err != nil {
+		return nil, nil, err
+	}
 
+	kept := tables[:0]
+	var quarantined []quarantinedObject
 	for i := range tables {
 		if len(tables[i].Objects) == 0 {
 			continue
 		}
+		tables[i].Name = prefixedTableName(c.tablePrefix, tables[i].Name)
 
-		// Read schema from first file
-		sc, err := c.readParquetSchema(ctx, tables[i].Objects[0].Key)
+		sc, mismatches, err := c.tableSchema(ctx, &tables[i])
 		if err != nil {
-			return nil, fmt.Errorf("failed to read schema from %s: %w", tables[i].Objects[0].Key, err)
+			return nil, nil, err
 		}
-		tables[i].ArrowSchema = sc
-
-		// Validate all files have the same schema
-		for j := 1; j < len(tables[i].Objects); j++ {
-			sc2, err := c.readParquetSchema(ctx, tables[i].Objects[j].Key)
+		if len(mismatches) > 0 {
+			ok, err := c.applyMismatchPolicy(&tables[i], mismatches)
 			if err != nil {
-				return nil, fmt.Errorf("failed to read schema from %s: %w", tables[i].Objects[j].Key, err)
+				return nil, nil, err
 			}
-			if !sc.Equal(sc2) {
-				return nil, fmt.Errorf(
-					"schema mismatch in table %s: file %s has %v, file %s has %v",
-					tables[i].Name,
-					tables[i].Objects[0].Key, sc.Fields(),
-					tables[i].Objects[j].Key, sc2.Fields(),
-				)
+			if c.spec.SchemaMismatch == "quarantine" {
+				for _, m := range mismatches {
+					quarantined = append(quarantined, quarantinedObject{Table: tables[i].Name, schemaMismatch: m})
+				}
 			}
+			if !ok {
+				continue
+			}
+		}
+		tables[i].ArrowSchema = sc
+		honorCloudQuery := c.spec.CloudQueryMetadata == "honor" && cloudQueryTableName(sc) != ""
+		if honorCloudQuery {
+			tables[i].cloudQueryName = cloudQueryTableName(sc)
+			tables[i].Name = prefixedTableName(c.tablePrefix, naming.Sanitize(tables[i].cloudQueryName))
 		}
 
-		// Build CQ table from Arrow schema fields
-		columns := make(schema.ColumnList, sc.NumFields())
+		// Build CQ table from Arrow schema fields followed by partition and
+		// metadata columns
+		tables[i].Partitions = withoutFileColumns(tables[i].Partitions, sc)
+		columns := make(schema.ColumnList, 0, sc.NumFields()+len(tables[i].Partitions))
 		for fi := 0; fi < sc.NumFields(); fi++ {
-			columns[fi] = schema.NewColumnFromArrowField(sc.Field(fi))
+			columns = append(columns, schema.NewColumnFromArrowField(sc.Field(fi)))
+		}
+		for _, f := range tables[i].Partitions {
+			columns = append(columns, schema.NewColumnFromArrowField(f))
+		}
+		for _, f := range c.spec.metadataColumns() {
+			if columns.Get(f.Name) != nil {
+				return nil, nil, fmt.Errorf("table %s already has a column named %s, which is added as a metadata column", tables[i].Name, f.Name)
+			}
+			columns = append(columns, schema.NewColumnFromArrowField(f))
 		}
 		table := &schema.Table{
 			Name:          tables[i].Name,
 			Columns:       columns,
-			IsIncremental: true,
+			IsIncremental: !fullRefresh.match(tables[i].Name),
+		}
+		if honorCloudQuery {
+			withCloudQueryTableMetadata(table, sc.Metadata(), c.tablePrefix)
+		}
+		if err := primaryKeys.apply(table); err != nil {
+			return nil, nil, err
 		}
 		// Only add CQ ID columns if they don't already exist in the Parquet schema.
 		// Parquet files written by other CQ source plugins (e.g., ibcq-source-k8s
@@ -90,16 +220,151 @@ func (c *Client) discover(ctx context.Context) ([]DiscoveredTable, error) {
 			}
 		}
 		if !hasCqID {
+			// Deterministic ids are derived from cq_id_columns, or else from
+			// the primary key. AddCqIDs makes _cq_id the primary key of
+			// tables without primary_keys.
+			keyColumns := c.spec.CqIDColumns
+			if len(keyColumns) == 0 {
+				keyColumns = table.PrimaryKeys()
+			}
 			schema.AddCqIDs(table)
+			if c.spec.CqID == "deterministic" {
+				for _, name := range keyColumns {
+					if table.Columns.Get(name) == nil {
+						return nil, nil, fmt.Errorf("table %s has no cq_id_columns column %s", tables[i].Name, name)
+					}
+				}
+				tables[i].deterministicCqID = true
+				tables[i].cqIDColumns = keyColumns
+			}
 		}
 		tables[i].Table = table
+		kept = append(kept, tables[i])
 	}
 
-	return tables, nil
+	// Tables named after their CloudQuery metadata may hold objects that were
+	// grouped apart by their keys.
+	prefixes := make(map[string]string, len(kept))
+	for _, dt := range kept {
+		if prefix, ok := prefixes[dt.Name]; ok {
+			return nil, nil, fmt.Errorf("objects under %q and %q both hold table %s; set destination_path to the path they were written with", prefix, dt.Prefix, dt.Name)
+		}
+		prefixes[dt.Name] = dt.Prefix
+	}
+
+	return kept, quarantined, nil
+}
+
+// tableSchema determines the Arrow schema of a discovered table. Schemas of
+// self-describing formats are read from every object and must match exactly,
+// or are merged with schema_evolution "merge"; newline-delimited JSON schemas
+// are inferred by sampling the table's objects. Objects whose schema is
+// malformed or does not fit are returned as mismatches for the
+// schema_mismatch policy; the schema is nil if no object fits.
+func (c *Client) tableSchema(ctx context.Context, dt *DiscoveredTable) (*arrow.Schema, []schemaMismatch, error) {
+	if isJSONFileType(c.spec.FileType) {
+		return c.inferJSONTableSchema(ctx, dt.Objects)
+	}
+
+	var mismatches []schemaMismatch
+	schemas := make([]*arrow.Schema, len(dt.Objects))
+	for j, obj := range dt.Objects {
+		sc, err := c.readSchema(ctx, obj.Key)
+		if err != nil {
+			if !errors.Is(err, errMalformedObject) && !isMalformedParquetError(err) {
+				return nil, nil, fmt.Errorf("failed to read schema from %s: %w", obj.Key, err)
+			}
+			mismatches = append(mismatches, schemaMismatch{Object: obj, Reason: err.Error()})
+			continue
+		}
+		schemas[j] = sc
+	}
+	if c.spec.CloudQueryMetadata == "honor" {
+		// The table is named after the CloudQuery table of its schema, so
+		// objects written from other tables cannot be synced with it.
+		mismatches = append(mismatches, cloudQueryNameMismatches(dt.Objects, schemas)...)
+	}
+
+	if c.spec.SchemaEvolution == "merge" {
+		sc, rest := mergedTableSchema(dt.Objects, schemas)
+		return sc, append(mismatches, rest...), nil
+	}
+	sc, rest := strictTableSchema(dt.Objects, schemas)
+	return sc, append(mismatches, rest...), nil
 }
 
-// listObjects uses ListObjectsV2 pagination to list all .parquet objects in the bucket.
+// mergedTableSchema merges the schemas of objects in order. Objects whose
+// schema cannot be merged are mismatches. Nil schemas are skipped.
+func mergedTableSchema(objects []S3Object, schemas []*arrow.Schema) (*arrow.Schema, []schemaMismatch) {
+	var merged *arrow.Schema
+	var mismatches []schemaMismatch
+	for j, sc := range schemas {
+		if sc == nil {
+			continue
+		}
+		if merged == nil {
+			merged = sc
+			continue
+		}
+		next, err := mergeSchemas(merged, sc)
+		if err != nil {
+			mismatches = append(mismatches, schemaMismatch{Object: objects[j], Reason: err.Error()})
+			continue
+		}
+		merged = next
+	}
+	return merged, mismatches
+}
+
+// strictTableSchema picks the schema shared by the most objects as the table
+// schema, preferring the one seen first on ties. Objects with any other schema
+// are mismatches. Nil schemas are skipped.
+func strictTableSchema(objects []S3Object, schemas []*arrow.Schema) (*arrow.Schema, []schemaMismatch) {
+	var sc *arrow.Schema
+	var best int
+	for _, candidate := range schemas {
+		if candidate == nil || (sc != nil && candidate.Equal(sc)) {
+			continue
+		}
+		n := 0
+		for _, other := range schemas {
+			if other != nil && other.Equal(candidate) {
+				n++
+			}
+		}
+		if n > best {
+			sc, best = candidate, n
+		}
+	}
+
+	var mismatches []schemaMismatch
+	for j, other := range schemas {
+		if other != nil && !other.Equal(sc) {
+			mismatches = append(mismatches, schemaMismatch{
+				Object: objects[j],
+				Reason: fmt.Sprintf("schema %v differs from table schema %v shared by %d of %d files", other.Fields(), sc.Fields(), best, len(schemas)),
+			})
+		}
+	}
+	return sc, mismatches
+}
+
+// listObjects uses ListObjectsV2 pagination to list all objects in the bucket
+// with the configured file type's extension that are selected by the include
+// and exclude patterns.
 func (c *Client) listObjects(ctx context.Context) ([]S3Object, error) {
+	filter, err := newKeyFilter(c.spec.Include, c.spec.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	return c.listObjectsMatching(ctx, func(key string) bool {
+		return hasFileExtension(key, c.spec.FileType) && filter.match(key)
+	})
+}
+
+// listObjectsMatching lists all objects under the configured path prefix
+// whose key satisfies match.
+func (c *Client) listObjectsMatching(ctx context.Context, match func(key string) bool) ([]S3Object, error) {
 	input := &s3.ListObjectsV2Input{
 		Bucket: aws.String(c.spec.Bucket),
 	}
@@ -116,13 +381,14 @@ func (c *Client) listObjects(ctx context.Context) ([]S3Object, error) {
 		}
 		for _, obj := range page.Contents {
 			key := aws.ToString(obj.Key)
-			if !strings.HasSuffix(strings.ToLower(key), "."+c.spec.FileType) {
+			if !match(key) {
 				continue
 			}
 			objects = append(objects, S3Object{
 				Key:          key,
 				Size:         aws.ToInt64(obj.Size),
 				LastModified: obj.LastModified.Format("2006-01-02T15:04:05.999999999Z07:00"),
+				ETag:         aws.ToString(obj.ETag),
 			})
 		}
 	}
@@ -130,18 +396,26 @@ func (c *Client) listObjects(ctx context.Context) ([]S3Object, error) {
 	return objects, nil
 }
 
-// groupByPrefix groups S3 objects by their normalized table name.
-func groupByPrefix(objects []S3Object) []DiscoveredTable {
+// groupByPrefix groups S3 objects by their table name. Objects matching a rule
+// of mapping take the rule's name; other objects take their normalized name,
+// or are dropped if mapping ignores unmatched keys. Compression extensions and
+// Hive-style key=value path segments are stripped before normalizing, so all
+// partitions of a dataset land in the same table, and partition values are
+// recorded on the object. A nil mapping normalizes every key.
+func groupByPrefix(objects []S3Object, mapping *tableMapping) []DiscoveredTable {
 	byName := make(map[string]*DiscoveredTable)
 	for _, obj := range objects {
-		name := naming.Normalize(obj.Key)
+		key, _ := splitCompressionExtension(obj.Key)
+		key, partitions := naming.SplitPartitions(key)
+		name := mapping.tableName(obj.Key, key)
 		if name == "" {
 			continue
 		}
+		obj.Partitions = partitions
 		dt, ok := byName[name]
 		if !ok {
 			prefix := ""
-			dir := filepath.Dir(obj.Key)
+			dir := filepath.Dir(key)
 			if dir != "." {
 				prefix = dir + "/"
 			}
@@ -156,6 +430,7 @@ func groupByPrefix(objects []S3Object) []DiscoveredTable {
 
 	tables := make([]DiscoveredTable, 0, len(byName))
 	for _, dt := range byName {
+		dt.Partitions = inferPartitionFields(dt.Objects)
 		tables = append(tables, *dt)
 	}
 	sort.Slice(tables, func(i, j int) bool {
@@ -16,7 +16,7 @@ func TestGroupByPrefix(t *testing.T) {
 		{Key: "root_file.parquet", Size: 400},
 	}
 
-	tables := groupByPrefix(objects)
+	tables := groupByPrefix(objects, nil)
 
 	if len(tables) != 3 {
 		t.Fatalf("expected 3 tables, got %d", len(tables))
@@ -49,7 +49,7 @@ func TestGroupByPrefix_ParquetFilter(t *testing.T) {
 		{Key: "data/2024/file.parquet", Size: 100},
 	}
 
-	tables := groupByPrefix(objects)
+	tables := groupByPrefix(objects, nil)
 	if len(tables) != 1 {
 		t.Fatalf("expected 1 table, got %d", len(tables))
 	}
@@ -66,7 +66,7 @@ func TestGroupByPrefix_PathPrefix(t *testing.T) {
 		{Key: "data/region/eu-west/file1.parquet", Size: 300},
 	}
 
-	tables := groupByPrefix(objects)
+	tables := groupByPrefix(objects, nil)
 
 	if len(tables) != 2 {
 		t.Fatalf("expected 2 tables, got %d", len(tables))
@@ -81,6 +81,45 @@ func TestGroupByPrefix_PathPrefix(t *testing.T) {
 	}
 }
 
+func TestGroupByPrefix_HivePartitions(t *testing.T) {
+	objects := []S3Object{
+		{Key: "events/dt=2024-01-01/part-0.parquet", Size: 100},
+		{Key: "events/dt=2024-01-02/part-0.parquet", Size: 200},
+		{Key: "events/dt=2024-01-02/part-1.parquet", Size: 300},
+	}
+
+	tables := groupByPrefix(objects, nil)
+
+	if len(tables) != 1 {
+		t.Fatalf("expected 1 table, got %d", len(tables))
+	}
+	if tables[0].Name != "events" {
+		t.Errorf("Name = %q, want %q", tables[0].Name, "events")
+	}
+	if tables[0].Prefix != "events/" {
+		t.Errorf("Prefix = %q, want %q", tables[0].Prefix, "events/")
+	}
+	if len(tables[0].Objects) != 3 {
+		t.Fatalf("expected 3 objects, got %d", len(tables[0].Objects))
+	}
+	if got := tables[0].Objects[1].Partitions; len(got) != 1 || got[0].Value != "2024-01-02" {
+		t.Errorf("object partitions = %v, want dt=2024-01-02", got)
+	}
+	if len(tables[0].Partitions) != 1 || tables[0].Partitions[0].Name != "dt" {
+		t.Fatalf("Partitions = %v, want [dt]", tables[0].Partitions)
+	}
+	if !arrow.TypeEqual(tables[0].Partitions[0].Type, arrow.FixedWidthTypes.Date32) {
+		t.Errorf("dt type = %v, want date32", tables[0].Partitions[0].Type)
+	}
+}
+
+func TestGroupByPrefix_CompressedRootFile(t *testing.T) {
+	tables := groupByPrefix([]S3Object{{Key: "events.csv.gz", Size: 100}}, nil)
+	if len(tables) != 1 || tables[0].Name != "events" {
+		t.Fatalf("expected table events, got %v", tables)
+	}
+}
+
 func TestFilterObjectsByCursor(t *testing.T) {
 	objects := []S3Object{
 		{Key: "data/old.parquet", LastModified: "2024-01-01T00:00:00Z"},
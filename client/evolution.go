@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/compute"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// mergeSchemas returns the union of two object schemas for schema_evolution
+// "merge". Fields are matched by name and keep the order they first appear in;
+// fields missing from either schema become nullable, and fields whose types
+// differ are widened to a type that holds both, such as int32 and int64 to
+// int64. Types that cannot be widened losslessly are an error.
+func mergeSchemas(a, b *arrow.Schema) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, 0, a.NumFields()+b.NumFields())
+	for _, fa := range a.Fields() {
+		idx := b.FieldIndices(fa.Name)
+		if len(idx) == 0 {
+			fa.Nullable = true
+			fields = append(fields, fa)
+			continue
+		}
+		fb := b.Field(idx[0])
+		dt, ok := widenType(fa.Type, fb.Type)
+		if !ok {
+			return nil, fmt.Errorf("column %q has incompatible types %s and %s", fa.Name, fa.Type, fb.Type)
+		}
+		fa.Type = dt
+		fa.Nullable = fa.Nullable || fb.Nullable
+		fields = append(fields, fa)
+	}
+	for _, fb := range b.Fields() {
+		if !a.HasField(fb.Name) {
+			fb.Nullable = true
+			fields = append(fields, fb)
+		}
+	}
+	md := a.Metadata()
+	return arrow.NewSchema(fields, &md), nil
+}
+
+// widenType returns the narrowest type that losslessly holds values of both
+// a and b, and false if there is none.
+func widenType(a, b arrow.DataType) (arrow.DataType, bool) {
+	if arrow.TypeEqual(a, b) {
+		return a, true
+	}
+	wa, wb := integerWidth(a), integerWidth(b)
+	switch {
+	case wa != 0 && wb != 0:
+		return widenInteger(a, b)
+	case isFloat(a) && isFloat(b):
+		return arrow.PrimitiveTypes.Float64, true
+	case isFloat(a) && wb != 0 && wb <= 32, isFloat(b) && wa != 0 && wa <= 32:
+		// float64 represents every integer of up to 32 bits exactly.
+		return arrow.PrimitiveTypes.Float64, true
+	}
+	switch {
+	case isStringType(a) && isStringType(b):
+		return arrow.BinaryTypes.LargeString, true
+	case isBinaryType(a) && isBinaryType(b):
+		return arrow.BinaryTypes.LargeBinary, true
+	}
+	return nil, false
+}
+
+// widenInteger widens two integer types. Mixing signed and unsigned needs a
+// signed type wider than the unsigned one, so uint64 only widens with itself.
+func widenInteger(a, b arrow.DataType) (arrow.DataType, bool) {
+	sa, sb := isSignedInteger(a), isSignedInteger(b)
+	wa, wb := integerWidth(a), integerWidth(b)
+	width := max(wa, wb)
+	if sa != sb {
+		unsigned := wa
+		if sa {
+			unsigned = wb
+		}
+		width = max(width, unsigned*2)
+		if width > 64 {
+			return nil, false
+		}
+		return signedInteger(width), true
+	}
+	if sa {
+		return signedInteger(width), true
+	}
+	return unsignedInteger(width), true
+}
+
+func integerWidth(dt arrow.DataType) int {
+	switch dt.ID() {
+	case arrow.INT8, arrow.UINT8:
+		return 8
+	case arrow.INT16, arrow.UINT16:
+		return 16
+	case arrow.INT32, arrow.UINT32:
+		return 32
+	case arrow.INT64, arrow.UINT64:
+		return 64
+	}
+	return 0
+}
+
+func isSignedInteger(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64:
+		return true
+	}
+	return false
+}
+
+func signedInteger(width int) arrow.DataType {
+	switch width {
+	case 8:
+		return arrow.PrimitiveTypes.Int8
+	case 16:
+		return arrow.PrimitiveTypes.Int16
+	case 32:
+		return arrow.PrimitiveTypes.Int32
+	}
+	return arrow.PrimitiveTypes.Int64
+}
+
+func unsignedInteger(width int) arrow.DataType {
+	switch width {
+	case 8:
+		return arrow.PrimitiveTypes.Uint8
+	case 16:
+		return arrow.PrimitiveTypes.Uint16
+	case 32:
+		return arrow.PrimitiveTypes.Uint32
+	}
+	return arrow.PrimitiveTypes.Uint64
+}
+
+func isFloat(dt arrow.DataType) bool {
+	return dt.ID() == arrow.FLOAT32 || dt.ID() == arrow.FLOAT64
+}
+
+func isStringType(dt arrow.DataType) bool {
+	return dt.ID() == arrow.STRING || dt.ID() == arrow.LARGE_STRING
+}
+
+func isBinaryType(dt arrow.DataType) bool {
+	return dt.ID() == arrow.BINARY || dt.ID() == arrow.LARGE_BINARY
+}
+
+// projectRecord conforms a record read from one object to the merged table
+// schema: columns are reordered by name, widened to the table's types, and
+// columns the object lacks are filled with nulls. Records that already match
+// are returned unchanged.
+func projectRecord(rec arrow.RecordBatch, sc *arrow.Schema) (arrow.RecordBatch, error) {
+	if rec.Schema().Equal(sc) {
+		return rec, nil
+	}
+	n := rec.NumRows()
+	cols := make([]arrow.Array, sc.NumFields())
+	defer func() {
+		for _, col := range cols {
+			if col != nil {
+				col.Release()
+			}
+		}
+	}()
+	for i, f := range sc.Fields() {
+		idx := rec.Schema().FieldIndices(f.Name)
+		if len(idx) == 0 {
+			cols[i] = array.MakeArrayOfNull(memory.DefaultAllocator, f.Type, int(n))
+			continue
+		}
+		col := rec.Column(idx[0])
+		if arrow.TypeEqual(col.DataType(), f.Type) {
+			col.Retain()
+			cols[i] = col
+			continue
+		}
+		cast, err := compute.CastArray(context.Background(), col, compute.SafeCastOptions(f.Type))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert column %q from %s to %s: %w", f.Name, col.DataType(), f.Type, err)
+		}
+		cols[i] = cast
+	}
+	return array.NewRecordBatch(sc, cols, n), nil
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+func TestMergeSchemas(t *testing.T) {
+	older := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+	newer := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "email", Type: arrow.BinaryTypes.String},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil)
+
+	merged, err := mergeSchemas(older, newer)
+	if err != nil {
+		t.Fatalf("mergeSchemas: %v", err)
+	}
+	want := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	if !merged.Equal(want) {
+		t.Errorf("merged = %v, want %v", merged, want)
+	}
+
+	incompatible := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.BinaryTypes.String}}, nil)
+	if _, err := mergeSchemas(older, incompatible); err == nil {
+		t.Error("expected error merging int32 and string")
+	}
+}
+
+func TestWidenType(t *testing.T) {
+	tests := []struct {
+		a, b arrow.DataType
+		want arrow.DataType
+	}{
+		{arrow.PrimitiveTypes.Int32, arrow.PrimitiveTypes.Int64, arrow.PrimitiveTypes.Int64},
+		{arrow.PrimitiveTypes.Int8, arrow.PrimitiveTypes.Int16, arrow.PrimitiveTypes.Int16},
+		{arrow.PrimitiveTypes.Uint16, arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Uint32},
+		{arrow.PrimitiveTypes.Uint32, arrow.PrimitiveTypes.Int32, arrow.PrimitiveTypes.Int64},
+		{arrow.PrimitiveTypes.Uint8, arrow.PrimitiveTypes.Int8, arrow.PrimitiveTypes.Int16},
+		{arrow.PrimitiveTypes.Float32, arrow.PrimitiveTypes.Float64, arrow.PrimitiveTypes.Float64},
+		{arrow.PrimitiveTypes.Int32, arrow.PrimitiveTypes.Float32, arrow.PrimitiveTypes.Float64},
+		{arrow.BinaryTypes.String, arrow.BinaryTypes.LargeString, arrow.BinaryTypes.LargeString},
+		{arrow.PrimitiveTypes.Uint64, arrow.PrimitiveTypes.Int64, nil},
+		{arrow.PrimitiveTypes.Int64, arrow.PrimitiveTypes.Float64, nil},
+		{arrow.FixedWidthTypes.Boolean, arrow.PrimitiveTypes.Int64, nil},
+	}
+	for _, tc := range tests {
+		got, ok := widenType(tc.a, tc.b)
+		if tc.want == nil {
+			if ok {
+				t.Errorf("widenType(%s, %s) = %s, want no common type", tc.a, tc.b, got)
+			}
+			continue
+		}
+		if !ok || !arrow.TypeEqual(got, tc.want) {
+			t.Errorf("widenType(%s, %s) = %v, %v, want %s", tc.a, tc.b, got, ok, tc.want)
+		}
+	}
+}
+
+func TestProjectRecord(t *testing.T) {
+	fileSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+	}, nil)
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, fileSchema,
+		strings.NewReader(`[{"name": "a", "id": 1}, {"name": "b", "id": 2}]`))
+	if err != nil {
+		t.Fatalf("RecordFromJSON: %v", err)
+	}
+	defer rec.Release()
+
+	tableSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	got, err := projectRecord(rec, tableSchema)
+	if err != nil {
+		t.Fatalf("projectRecord: %v", err)
+	}
+	defer got.Release()
+
+	if !got.Schema().Equal(tableSchema) {
+		t.Fatalf("schema = %v, want %v", got.Schema(), tableSchema)
+	}
+	ids := got.Column(0).(*array.Int64)
+	if ids.Value(0) != 1 || ids.Value(1) != 2 {
+		t.Errorf("ids = %v, want [1 2]", ids)
+	}
+	if got.Column(1).(*array.String).Value(1) != "b" {
+		t.Errorf("names = %v", got.Column(1))
+	}
+	if got.Column(2).NullN() != 2 {
+		t.Errorf("email = %v, want all nulls", got.Column(2))
+	}
+
+	if same, err := projectRecord(rec, fileSchema); err != nil || same != rec {
+		t.Errorf("projectRecord with matching schema = %v, %v, want the record unchanged", same, err)
+	}
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/infobloxopen/cq-source-s3/internal/glob"
+)
+
+// keyFilter selects listed objects with the include and exclude options. A
+// key is selected if it matches any include pattern, or there are none, and
+// matches no exclude pattern.
+type keyFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// newKeyFilter compiles the include and exclude glob patterns.
+func newKeyFilter(include, exclude []string) (*keyFilter, error) {
+	f := &keyFilter{}
+	for _, p := range include {
+		re, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %w", err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, p := range exclude {
+		re, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %w", err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+// match reports whether key is selected.
+func (f *keyFilter) match(key string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableMatcher matches table names against glob patterns, such as those of
+// the full_refresh option.
+type tableMatcher []*regexp.Regexp
+
+// newTableMatcher compiles the glob patterns of option.
+func newTableMatcher(option string, patterns []string) (tableMatcher, error) {
+	m := make(tableMatcher, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := glob.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern: %w", option, err)
+		}
+		m = append(m, re)
+	}
+	return m, nil
+}
+
+// match reports whether name matches any pattern.
+func (m tableMatcher) match(name string) bool {
+	for _, re := range m {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestKeyFilter(t *testing.T) {
+	f, err := newKeyFilter(
+		[]string{"data/**/*.parquet", "exports/*.parquet"},
+		[]string{"**/_temporary/**", "data/backup/**"},
+	)
+	if err != nil {
+		t.Fatalf("newKeyFilter: %v", err)
+	}
+	tests := map[string]bool{
+		"data/a.parquet":                   true,
+		"data/2024/01/a.parquet":           true,
+		"exports/a.parquet":                true,
+		"exports/nested/a.parquet":         false,
+		"other/a.parquet":                  false,
+		"data/_temporary/0/a.parquet":      false,
+		"data/2024/_temporary/a.parquet":   false,
+		"data/backup/2023/a.parquet":       false,
+		"data/backups/a.parquet":           true,
+		"exports/_temporary/0/a.parquet":   false,
+		"data/2024/_temporary_x/a.parquet": true,
+	}
+	for key, want := range tests {
+		if got := f.match(key); got != want {
+			t.Errorf("match(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	all, err := newKeyFilter(nil, nil)
+	if err != nil {
+		t.Fatalf("newKeyFilter: %v", err)
+	}
+	if !all.match("anything/a.parquet") {
+		t.Error("expected an empty filter to select every key")
+	}
+}
+
+func TestTableMatcher(t *testing.T) {
+	m, err := newTableMatcher("full_refresh", []string{"dim_*", "users"})
+	if err != nil {
+		t.Fatalf("newTableMatcher: %v", err)
+	}
+	tests := map[string]bool{
+		"dim_customers": true,
+		"users":         true,
+		"users_archive": false,
+		"orders":        false,
+	}
+	for name, want := range tests {
+		if got := m.match(name); got != want {
+			t.Errorf("match(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	none, err := newTableMatcher("full_refresh", nil)
+	if err != nil {
+		t.Fatalf("newTableMatcher: %v", err)
+	}
+	if none.match("users") {
+		t.Error("expected an empty matcher to match no table")
+	}
+	if _, err := newTableMatcher("full_refresh", []string{"dim_[a"}); err == nil {
+		t.Error("expected error for an invalid pattern")
+	}
+}
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow-go/v18/arrow"
+)
+
+// errMalformedObject marks errors caused by object contents that cannot be
+// decoded in the configured file format. Such objects are skipped during sync
+// unless some of their records were already emitted (see partialObjectError).
+var errMalformedObject = errors.New("malformed object")
+
+// errTypeMismatch marks values that do not fit the type inferred for their
+// column from sampled rows. Part of the object may already have been emitted,
+// so unlike malformed objects they fail the sync instead of being skipped.
+var errTypeMismatch = errors.New("value does not fit the inferred column type")
+
+// partialObjectError returns the error err of a reader, which emitted
+// reports to have sent records of the object already. Skipping such an object
+// would keep the records sent before the malformed content and drop the rest,
+// so once records were emitted err no longer wraps errMalformedObject and
+// fails the sync.
+func partialObjectError(err error, emitted bool) error {
+	if !emitted || !errors.Is(err, errMalformedObject) {
+		return err
+	}
+	return fmt.Errorf("%v; earlier records of the object were already emitted", err)
+}
+
+// isJSONFileType reports whether fileType selects newline-delimited JSON.
+func isJSONFileType(fileType string) bool {
+	return fileType == "jsonl" || fileType == "ndjson"
+}
+
+// fileExtensions returns the object key extensions listed for a file type.
+func fileExtensions(fileType string) []string {
+	switch {
+	case isJSONFileType(fileType):
+		return []string{".jsonl", ".ndjson", ".json"}
+	case fileType == "arrow":
+		return []string{".arrow", ".feather", ".arrows"}
+	}
+	return []string{"." + fileType}
+}
+
+// hasFileExtension reports whether key ends with one of the file type's
+// extensions, optionally followed by a compression extension (".csv.gz").
+func hasFileExtension(key, fileType string) bool {
+	key, _ = splitCompressionExtension(key)
+	lower := strings.ToLower(key)
+	for _, ext := range fileExtensions(fileType) {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSchema reads the Arrow schema of an S3 object in the configured file format.
+func (c *Client) readSchema(ctx context.Context, key string) (*arrow.Schema, error) {
+	switch c.spec.FileType {
+	case "csv":
+		return c.readCSVSchema(ctx, key)
+	case "avro":
+		return c.readAvroSchema(ctx, key)
+	case "arrow":
+		return c.readIPCSchema(ctx, key)
+	default:
+		return c.readParquetSchema(ctx, key)
+	}
+}
+
+// streamObject streams Arrow record batches of at most RowsPerRecord rows from
+// an S3 object in the configured file format. sc is the table's discovered
+// schema, used by formats that need a schema to decode values. The version id
+// of the object read is stored in versionID, if it is not nil, before the
+// first record is sent.
+func (c *Client) streamObject(ctx context.Context, key string, sc *arrow.Schema, versionID *string, records chan<- arrow.RecordBatch) error {
+	switch {
+	case c.spec.FileType == "csv":
+		return c.streamCSVRecords(ctx, key, sc, c.spec.RowsPerRecord, versionID, records)
+	case isJSONFileType(c.spec.FileType):
+		return c.streamJSONRecords(ctx, key, sc, c.spec.RowsPerRecord, versionID, records)
+	case c.spec.FileType == "avro":
+		return c.streamAvroRecords(ctx, key, c.spec.RowsPerRecord, versionID, records)
+	case c.spec.FileType == "arrow":
+		return c.streamIPCRecords(ctx, key, c.spec.RowsPerRecord, versionID, records)
+	default:
+		return c.streamRecords(ctx, key, c.spec.RowsPerRecord, versionID, records)
+	}
+}
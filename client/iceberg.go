@@ -0,0 +1,1022 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/state"
+	"github.com/hamba/avro/v2/ocf"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+// icebergMetadataDir is the directory under an Iceberg table root holding its
+// metadata files.
+const icebergMetadataDir = "metadata/"
+
+// icebergVersionHint is the file Hadoop catalogs write next to the metadata
+// files to point at the current version.
+const icebergVersionHint = "version-hint.text"
+
+// Manifest entry status of files removed by the snapshot.
+const icebergStatusDeleted = 2
+
+// Content types of data and delete files.
+const (
+	icebergContentData            = 0
+	icebergContentPositionDeletes = 1
+	icebergContentEqualityDeletes = 2
+)
+
+// icebergOperationReplace is the operation of snapshots that rewrite files
+// without changing the table's rows, such as compaction.
+const icebergOperationReplace = "replace"
+
+// Columns of position delete files.
+const (
+	icebergPositionDeletePathField = "file_path"
+	icebergPositionDeletePosField  = "pos"
+)
+
+// icebergTable is the state of an Iceberg table at discovery.
+type icebergTable struct {
+	// Root is the key prefix of the table.
+	Root string
+	// SnapshotID is the current snapshot.
+	SnapshotID int64
+	metadata   *icebergMetadata
+	// dataFiles are the live data files of the current snapshot by key.
+	dataFiles map[string]icebergFile
+	// deletes are the live delete files of the current snapshot.
+	deletes []icebergFile
+
+	mu sync.Mutex
+	// positionDeletes caches the deleted row positions of each data file
+	// path, loaded from a position delete file, by delete file key.
+	positionDeletes map[string]map[string][]int64
+	// equalityDeletes caches the deleted keys of an equality delete file.
+	equalityDeletes map[string]*icebergEqualityDeletes
+}
+
+// icebergMetadata is the subset of a table metadata file used for reading.
+type icebergMetadata struct {
+	FormatVersion     int                    `json:"format-version"`
+	Location          string                 `json:"location"`
+	CurrentSnapshotID *int64                 `json:"current-snapshot-id"`
+	Snapshots         []icebergSnapshot      `json:"snapshots"`
+	CurrentSchemaID   int                    `json:"current-schema-id"`
+	Schemas           []icebergSchema        `json:"schemas"`
+	Schema            *icebergSchema         `json:"schema"` // format version 1
+	PartitionSpecs    []icebergPartitionSpec `json:"partition-specs"`
+}
+
+type icebergSnapshot struct {
+	SnapshotID       int64             `json:"snapshot-id"`
+	ParentSnapshotID *int64            `json:"parent-snapshot-id"`
+	SequenceNumber   int64             `json:"sequence-number"`
+	TimestampMs      int64             `json:"timestamp-ms"`
+	ManifestList     string            `json:"manifest-list"`
+	Summary          map[string]string `json:"summary"`
+}
+
+type icebergSchema struct {
+	SchemaID int `json:"schema-id"`
+	Fields   []struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"fields"`
+}
+
+type icebergPartitionSpec struct {
+	SpecID int               `json:"spec-id"`
+	Fields []json.RawMessage `json:"fields"`
+}
+
+// icebergManifestFile is an entry of a manifest list. Fields that are
+// optional or absent in format version 1 are decoded as any.
+type icebergManifestFile struct {
+	ManifestPath    string `avro:"manifest_path"`
+	PartitionSpecID int32  `avro:"partition_spec_id"`
+	SequenceNumber  any    `avro:"sequence_number"`
+	AddedSnapshotID any    `avro:"added_snapshot_id"`
+}
+
+// icebergManifestEntry is an entry of a manifest file.
+type icebergManifestEntry struct {
+	Status         int32           `avro:"status"`
+	SnapshotID     any             `avro:"snapshot_id"`
+	SequenceNumber any             `avro:"sequence_number"`
+	DataFile       icebergDataFile `avro:"data_file"`
+}
+
+type icebergDataFile struct {
+	Content         any            `avro:"content"`
+	FilePath        string         `avro:"file_path"`
+	FileFormat      string         `avro:"file_format"`
+	Partition       map[string]any `avro:"partition"`
+	RecordCount     int64          `avro:"record_count"`
+	FileSizeInBytes int64          `avro:"file_size_in_bytes"`
+	EqualityIDs     any            `avro:"equality_ids"`
+}
+
+// icebergFile is a live data or delete file with inherited manifest values
+// resolved.
+type icebergFile struct {
+	Key            string
+	Content        int
+	SpecID         int
+	Partition      string // canonical JSON of the partition tuple
+	SequenceNumber int64
+	SnapshotID     int64
+	Size           int64
+	EqualityIDs    []int
+	// Deleted is set for entries of files removed by SnapshotID.
+	Deleted bool
+}
+
+// icebergEqualityDeletes holds the deleted value tuples of one equality
+// delete file.
+type icebergEqualityDeletes struct {
+	columns []string
+	keys    map[string]struct{}
+}
+
+// avroLong returns the value of an Avro int or long decoded into an any,
+// which may be absent from the writer schema.
+func avroLong(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case map[string]any:
+		for _, inner := range n {
+			return avroLong(inner)
+		}
+	}
+	return 0, false
+}
+
+// avroIntList returns the values of an optional Avro array of ints.
+func avroIntList(v any) []int {
+	if m, ok := v.(map[string]any); ok {
+		v = m["array"]
+	}
+	items, _ := v.([]any)
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		if n, ok := avroLong(item); ok {
+			ids = append(ids, int(n))
+		}
+	}
+	return ids
+}
+
+// isIcebergMetadataKey reports whether key is an Iceberg table metadata file
+// or version hint.
+func isIcebergMetadataKey(key string) bool {
+	dir, name := path.Split(key)
+	if dir != icebergMetadataDir && !strings.HasSuffix(dir, "/"+icebergMetadataDir) {
+		return false
+	}
+	return name == icebergVersionHint ||
+		strings.HasSuffix(name, ".metadata.json") ||
+		strings.HasSuffix(name, ".metadata.json.gz")
+}
+
+// icebergMetadataVersion parses the version of a metadata file name, written
+// as v<N>.metadata.json by Hadoop catalogs and <N>-<uuid>.metadata.json by
+// other catalogs.
+func icebergMetadataVersion(name string) (int64, bool) {
+	name = strings.TrimPrefix(name, "v")
+	end := strings.IndexFunc(name, func(r rune) bool { return r < '0' || r > '9' })
+	if end <= 0 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(name[:end], 10, 64)
+	return v, err == nil
+}
+
+// findIcebergTables groups metadata objects by table root.
+func findIcebergTables(objects []S3Object) map[string][]S3Object {
+	roots := make(map[string][]S3Object)
+	for _, obj := range objects {
+		dir := path.Dir(obj.Key) + "/"
+		if dir == "./" {
+			dir = ""
+		}
+		root := strings.TrimSuffix(dir, icebergMetadataDir)
+		roots[root] = append(roots[root], obj)
+	}
+	return roots
+}
+
+// currentIcebergMetadata picks the current metadata file of a table: the one
+// named by the version hint if present, otherwise the highest version, using
+// the most recent modification time to break ties between catalogs.
+func (c *Client) currentIcebergMetadata(ctx context.Context, root string, objects []S3Object) (string, error) {
+	var hint int64 = -1
+	candidates := make([]S3Object, 0, len(objects))
+	for _, obj := range objects {
+		if path.Base(obj.Key) == icebergVersionHint {
+			if v, err := c.readIcebergVersionHint(ctx, obj.Key); err == nil {
+				hint = v
+			} else {
+				c.logger.Warn().Err(err).Str("key", obj.Key).Msg("ignoring unreadable iceberg version hint")
+			}
+			continue
+		}
+		if _, ok := icebergMetadataVersion(path.Base(obj.Key)); ok {
+			candidates = append(candidates, obj)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no metadata files found under %s%s", root, icebergMetadataDir)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		vi, _ := icebergMetadataVersion(path.Base(candidates[i].Key))
+		vj, _ := icebergMetadataVersion(path.Base(candidates[j].Key))
+		if vi != vj {
+			return vi > vj
+		}
+		return candidates[i].LastModified > candidates[j].LastModified
+	})
+	if hint >= 0 {
+		for _, obj := range candidates {
+			if v, _ := icebergMetadataVersion(path.Base(obj.Key)); v == hint {
+				return obj.Key, nil
+			}
+		}
+	}
+	return candidates[0].Key, nil
+}
+
+func (c *Client) readIcebergVersionHint(ctx context.Context, key string) (int64, error) {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(body, 64))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readIcebergMetadata reads a table metadata file. Files named
+// *.gz.metadata.json are gzip-compressed by Iceberg's metadata codec; the
+// .metadata.json.gz form is decompressed by openObject.
+func (c *Client) readIcebergMetadata(ctx context.Context, key string) (*icebergMetadata, error) {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	var r io.Reader = body
+	if strings.HasSuffix(key, ".gz.metadata.json") {
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip metadata file %s: %w", key, err)
+		}
+		defer func() { _ = zr.Close() }()
+		r = zr
+	}
+
+	var md icebergMetadata
+	if err := json.NewDecoder(r).Decode(&md); err != nil {
+		return nil, fmt.Errorf("invalid metadata file %s: %w", key, err)
+	}
+	return &md, nil
+}
+
+// snapshot returns the snapshot with the given id.
+func (md *icebergMetadata) snapshot(id int64) (icebergSnapshot, bool) {
+	for _, s := range md.Snapshots {
+		if s.SnapshotID == id {
+			return s, true
+		}
+	}
+	return icebergSnapshot{}, false
+}
+
+// unpartitioned reports whether the partition spec with the given id has no
+// fields. Equality deletes of unpartitioned specs apply to every data file.
+func (md *icebergMetadata) unpartitioned(specID int) bool {
+	for _, spec := range md.PartitionSpecs {
+		if spec.SpecID == specID {
+			return len(spec.Fields) == 0
+		}
+	}
+	return false
+}
+
+// columnNames maps field ids of the current schema to column names.
+func (md *icebergMetadata) columnNames() map[int]string {
+	sc := md.Schema
+	for i := range md.Schemas {
+		if md.Schemas[i].SchemaID == md.CurrentSchemaID {
+			sc = &md.Schemas[i]
+		}
+	}
+	names := make(map[int]string)
+	if sc != nil {
+		for _, f := range sc.Fields {
+			names[f.ID] = f.Name
+		}
+	}
+	return names
+}
+
+// newSnapshots returns the snapshots after since up to and including the
+// current snapshot, oldest first, by following parent links back from the
+// current snapshot. It reports false if since is not an ancestor, for example
+// because it was expired or the table was rolled back.
+func (md *icebergMetadata) newSnapshots(since, current int64) ([]icebergSnapshot, bool) {
+	var chain []icebergSnapshot
+	id := current
+	for id != since {
+		s, ok := md.snapshot(id)
+		if !ok {
+			return nil, false
+		}
+		chain = append(chain, s)
+		if s.ParentSnapshotID == nil {
+			return nil, false
+		}
+		id = *s.ParentSnapshotID
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, true
+}
+
+// discoverIcebergTables finds Iceberg tables by their metadata directories and
+// returns one table per root whose objects are the live data files of the
+// current snapshot.
+func (c *Client) discoverIcebergTables(ctx context.Context) ([]DiscoveredTable, error) {
+	metadataObjects, err := c.listObjectsMatching(ctx, isIcebergMetadataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	byRoot := findIcebergTables(metadataObjects)
+	roots := make([]string, 0, len(byRoot))
+	for root := range byRoot {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+
+	tables := make([]DiscoveredTable, 0, len(roots))
+	for _, root := range roots {
+		dt, err := c.icebergDiscoveredTable(ctx, root, byRoot[root])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read iceberg table %s: %w", root, err)
+		}
+		if len(dt.Objects) == 0 {
+			c.logger.Info().Str("root", root).Msg("iceberg table has no data files, skipping")
+			continue
+		}
+		tables = append(tables, dt)
+	}
+	return tables, nil
+}
+
+func (c *Client) icebergDiscoveredTable(ctx context.Context, root string, metadataObjects []S3Object) (DiscoveredTable, error) {
+	key, err := c.currentIcebergMetadata(ctx, root, metadataObjects)
+	if err != nil {
+		return DiscoveredTable{}, err
+	}
+	md, err := c.readIcebergMetadata(ctx, key)
+	if err != nil {
+		return DiscoveredTable{}, err
+	}
+	if md.FormatVersion > 3 {
+		return DiscoveredTable{}, fmt.Errorf("iceberg format version %d is not supported", md.FormatVersion)
+	}
+
+	name := naming.Normalize(root)
+	if root == "" {
+		name = naming.Normalize(c.spec.Bucket + "/")
+	}
+	dt := DiscoveredTable{Name: name, Prefix: root}
+	if md.CurrentSnapshotID == nil || *md.CurrentSnapshotID < 0 {
+		return dt, nil
+	}
+	current, ok := md.snapshot(*md.CurrentSnapshotID)
+	if !ok {
+		return DiscoveredTable{}, fmt.Errorf("current snapshot %d not found in %s", *md.CurrentSnapshotID, key)
+	}
+
+	files, err := c.readIcebergManifests(ctx, current, nil)
+	if err != nil {
+		return DiscoveredTable{}, err
+	}
+	it := &icebergTable{
+		Root:            root,
+		SnapshotID:      current.SnapshotID,
+		metadata:        md,
+		dataFiles:       make(map[string]icebergFile),
+		positionDeletes: make(map[string]map[string][]int64),
+		equalityDeletes: make(map[string]*icebergEqualityDeletes),
+	}
+	for _, f := range files {
+		if f.Content == icebergContentData {
+			it.dataFiles[f.Key] = f
+			dt.Objects = append(dt.Objects, it.object(f))
+		} else {
+			it.deletes = append(it.deletes, f)
+		}
+	}
+	sort.Slice(dt.Objects, func(i, j int) bool { return dt.Objects[i].Key < dt.Objects[j].Key })
+	dt.iceberg = it
+	return dt, nil
+}
+
+// object converts a data file into an S3 object. Its LastModified is the
+// commit time of the snapshot that added it.
+func (it *icebergTable) object(f icebergFile) S3Object {
+	obj := S3Object{Key: f.Key, Size: f.Size}
+	if s, ok := it.metadata.snapshot(f.SnapshotID); ok {
+		obj.LastModified = time.UnixMilli(s.TimestampMs).UTC().Format(time.RFC3339Nano)
+	}
+	return obj
+}
+
+// readIcebergManifests reads the live files of a snapshot. If match is not
+// nil, only manifests and entries it accepts are returned, including the
+// entries of files the snapshot removed, which have Deleted set.
+func (c *Client) readIcebergManifests(ctx context.Context, snap icebergSnapshot, match func(icebergManifestFile, icebergFile) bool) ([]icebergFile, error) {
+	listKey, err := s3URIKey(c.spec.Bucket, snap.ManifestList)
+	if err != nil {
+		return nil, err
+	}
+	var manifests []icebergManifestFile
+	if err := c.decodeAvroObject(ctx, listKey, func(dec *ocf.Decoder) error {
+		var mf icebergManifestFile
+		if err := dec.Decode(&mf); err != nil {
+			return err
+		}
+		manifests = append(manifests, mf)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to read manifest list %s: %w", listKey, err)
+	}
+
+	var files []icebergFile
+	for _, mf := range manifests {
+		manifestKey, err := s3URIKey(c.spec.Bucket, mf.ManifestPath)
+		if err != nil {
+			return nil, err
+		}
+		manifestSeq, _ := avroLong(mf.SequenceNumber)
+		manifestSnapshot, _ := avroLong(mf.AddedSnapshotID)
+		if err := c.decodeAvroObject(ctx, manifestKey, func(dec *ocf.Decoder) error {
+			var e icebergManifestEntry
+			if err := dec.Decode(&e); err != nil {
+				return err
+			}
+			if e.Status == icebergStatusDeleted && match == nil {
+				return nil
+			}
+			f, err := c.icebergFile(e, mf, manifestSeq, manifestSnapshot)
+			if err != nil {
+				return err
+			}
+			f.Deleted = e.Status == icebergStatusDeleted
+			if match == nil || match(mf, f) {
+				files = append(files, f)
+			}
+			return nil
+		}); err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %w", manifestKey, err)
+		}
+	}
+	return files, nil
+}
+
+// icebergFile resolves a manifest entry, inheriting its snapshot id and
+// sequence number from the manifest when they are not set.
+func (c *Client) icebergFile(e icebergManifestEntry, mf icebergManifestFile, manifestSeq, manifestSnapshot int64) (icebergFile, error) {
+	content, _ := avroLong(e.DataFile.Content)
+	if !strings.EqualFold(e.DataFile.FileFormat, "parquet") {
+		// Format version 3 deletion vectors are stored in PUFFIN files.
+		return icebergFile{}, fmt.Errorf("file %s has unsupported format %s; only parquet data and delete files are supported", e.DataFile.FilePath, e.DataFile.FileFormat)
+	}
+	key, err := s3URIKey(c.spec.Bucket, e.DataFile.FilePath)
+	if err != nil {
+		return icebergFile{}, err
+	}
+	partition, err := json.Marshal(e.DataFile.Partition)
+	if err != nil {
+		return icebergFile{}, fmt.Errorf("invalid partition of %s: %w", e.DataFile.FilePath, err)
+	}
+
+	f := icebergFile{
+		Key:         key,
+		Content:     int(content),
+		SpecID:      int(mf.PartitionSpecID),
+		Partition:   string(partition),
+		Size:        e.DataFile.FileSizeInBytes,
+		EqualityIDs: avroIntList(e.DataFile.EqualityIDs),
+	}
+	var ok bool
+	if f.SnapshotID, ok = avroLong(e.SnapshotID); !ok {
+		f.SnapshotID = manifestSnapshot
+	}
+	if f.SequenceNumber, ok = avroLong(e.SequenceNumber); !ok {
+		f.SequenceNumber = manifestSeq
+	}
+	return f, nil
+}
+
+// decodeAvroObject opens an Avro object container file and calls decode for
+// every datum.
+func (c *Client) decodeAvroObject(ctx context.Context, key string, decode func(*ocf.Decoder) error) error {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	return decodeAvro(body, decode)
+}
+
+// decodeAvro calls decode for every datum of an Avro object container file.
+func decodeAvro(r io.Reader, decode func(*ocf.Decoder) error) error {
+	dec, err := ocf.NewDecoder(r)
+	if err != nil {
+		return err
+	}
+	for dec.HasNext() {
+		if err := decode(dec); err != nil {
+			return err
+		}
+	}
+	return dec.Error()
+}
+
+// icebergObjectsSince returns the objects to sync for an Iceberg table whose
+// rows up to snapshot since were already synced, and the keys of the objects
+// whose synced rows were removed or changed since. A negative since selects
+// every live data file. Otherwise the data files added by each newer snapshot
+// are returned, and data files removed by them or synced before since that
+// their new delete files apply to are returned as removed; the latter are
+// synced again with the deletes applied. With keyed set, the table's rows are
+// deleted by _s3_key and replace snapshots (compaction) are replayed like
+// other snapshots; otherwise they are skipped because they rewrite rows that
+// were already synced. If since has expired or is no longer an ancestor of
+// the current snapshot, the data files removed since are unknown, so an error
+// asks for a full refresh instead of syncing the live files a second time.
+func (c *Client) icebergObjectsSince(ctx context.Context, dt *DiscoveredTable, since int64, keyed bool) ([]S3Object, []string, error) {
+	it := dt.iceberg
+	if since < 0 {
+		return dt.Objects, nil, nil
+	}
+	snapshots, ok := it.metadata.newSnapshots(since, it.SnapshotID)
+	if !ok {
+		return nil, nil, fmt.Errorf("the synced iceberg snapshot %d has expired or is no longer an ancestor of the current snapshot %d, so the rows changed since cannot be determined; list the table in full_refresh to sync it in full", since, it.SnapshotID)
+	}
+
+	var (
+		addedKeys, removed []string
+		deletes            []icebergFile
+	)
+	added := make(map[string]bool)
+	removedSet := make(map[string]bool)
+	for _, snap := range snapshots {
+		if !keyed && snap.Summary["operation"] == icebergOperationReplace {
+			continue
+		}
+		id := snap.SnapshotID
+		files, err := c.readIcebergManifests(ctx, snap, func(mf icebergManifestFile, f icebergFile) bool {
+			if added, ok := avroLong(mf.AddedSnapshotID); ok && added != id {
+				return false
+			}
+			return f.SnapshotID == id
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, f := range files {
+			switch {
+			case f.Content != icebergContentData:
+				if !f.Deleted {
+					deletes = append(deletes, f)
+				}
+			case f.Deleted:
+				// Files added since are not synced yet and are dropped
+				// below if no longer live.
+				if !added[f.Key] && !removedSet[f.Key] {
+					removedSet[f.Key] = true
+					removed = append(removed, f.Key)
+				}
+			case !added[f.Key]:
+				added[f.Key] = true
+				addedKeys = append(addedKeys, f.Key)
+			}
+		}
+	}
+
+	changed, err := c.icebergChangedFiles(ctx, it, deletes, added)
+	if err != nil {
+		return nil, nil, err
+	}
+	removed = append(removed, changed...)
+
+	var objects []S3Object
+	for _, key := range append(addedKeys, changed...) {
+		if f, ok := it.dataFiles[key]; ok {
+			objects = append(objects, it.object(f))
+		}
+	}
+	return objects, removed, nil
+}
+
+// icebergChangedFiles returns the keys of the live data files, other than
+// those in added, that the given delete files remove rows from, sorted.
+func (c *Client) icebergChangedFiles(ctx context.Context, it *icebergTable, deletes []icebergFile, added map[string]bool) ([]string, error) {
+	changed := make(map[string]bool)
+	for _, d := range deletes {
+		var positions map[string][]int64
+		if d.Content == icebergContentPositionDeletes {
+			var err error
+			if positions, err = c.loadPositionDeletes(ctx, it, d.Key); err != nil {
+				return nil, err
+			}
+		}
+		for key, data := range it.dataFiles {
+			if added[key] || changed[key] || !it.deleteApplies(d, data) {
+				continue
+			}
+			if positions != nil && len(positions[key]) == 0 {
+				continue
+			}
+			changed[key] = true
+		}
+	}
+	keys := make([]string, 0, len(changed))
+	for key := range changed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// syncIcebergTable syncs the data files added since the snapshot recorded in
+// the state backend and records the current snapshot. The rows of data files
+// removed since, or changed by new delete files, are deleted by their _s3_key
+// before the files rewriting them are synced.
+func (c *Client) syncIcebergTable(ctx context.Context, stateClient state.Client, table *schema.Table, dt *DiscoveredTable, res chan<- message.SyncMessage) error {
+	since, err := GetIcebergSnapshot(ctx, stateClient, c.stateScope(), table.Name)
+	if err != nil {
+		return err
+	}
+
+	keyed := table.Columns.Get(sourceKeyColumn) != nil
+	objects, removed, err := c.icebergObjectsSince(ctx, dt, since, keyed)
+	if err != nil {
+		return err
+	}
+	deletes, err := deleteRemovedObjects(table, removed, fmt.Sprintf("iceberg snapshots after %d", since))
+	if err != nil {
+		return err
+	}
+
+	c.logger.Info().
+		Str("table", table.Name).
+		Int64("snapshot_id", dt.iceberg.SnapshotID).
+		Int64("synced_snapshot", since).
+		Int("total_objects", len(dt.Objects)).
+		Int("new_objects", len(objects)).
+		Int("removed_objects", len(removed)).
+		Int("delete_files", len(dt.iceberg.deletes)).
+		Bool("incremental", since >= 0).
+		Msg("syncing table")
+
+	res <- &message.SyncMigrateTable{Table: table}
+	for _, msg := range deletes {
+		res <- msg
+	}
+
+	if len(objects) > 0 {
+		if err := c.syncTableObjects(ctx, dt, objects, res, nil); err != nil {
+			return err
+		}
+	}
+
+	if dt.iceberg.SnapshotID != since {
+		if err := SetIcebergSnapshot(ctx, stateClient, c.stateScope(), table.Name, dt.iceberg.SnapshotID); err != nil {
+			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to set iceberg snapshot")
+		}
+	}
+	return nil
+}
+
+// applicableDeletes returns the delete files of the current snapshot that
+// apply to a data file.
+func (it *icebergTable) applicableDeletes(data icebergFile) []icebergFile {
+	var deletes []icebergFile
+	for _, d := range it.deletes {
+		if it.deleteApplies(d, data) {
+			deletes = append(deletes, d)
+		}
+	}
+	return deletes
+}
+
+// deleteApplies reports whether delete file d applies to a data file with
+// the given sequence number, spec and partition. Position deletes apply to
+// data files with a sequence number no greater than their own; equality
+// deletes only to strictly older data files in the same partition, or to all
+// older files if their spec is unpartitioned.
+func (it *icebergTable) deleteApplies(d, data icebergFile) bool {
+	switch d.Content {
+	case icebergContentPositionDeletes:
+		return data.SequenceNumber <= d.SequenceNumber
+	case icebergContentEqualityDeletes:
+		if data.SequenceNumber >= d.SequenceNumber {
+			return false
+		}
+		return it.metadata.unpartitioned(d.SpecID) || (d.SpecID == data.SpecID && d.Partition == data.Partition)
+	}
+	return false
+}
+
+// icebergRowFilter drops deleted rows from the record batches of one data
+// file, in file order.
+type icebergRowFilter struct {
+	positions map[int64]struct{}
+	equality  []*icebergEqualityDeletes
+	offset    int64
+	// kept holds the positions in the data file of the rows kept by the
+	// last call to apply.
+	kept []int64
+}
+
+// icebergRowFilter returns the filter for a data file of the current
+// snapshot, or nil if no deletes apply to it.
+func (c *Client) icebergRowFilter(ctx context.Context, it *icebergTable, obj S3Object) (*icebergRowFilter, error) {
+	if len(it.deletes) == 0 {
+		return nil, nil
+	}
+	data, ok := it.dataFiles[obj.Key]
+	if !ok {
+		return nil, fmt.Errorf("data file %s is not live in snapshot %d", obj.Key, it.SnapshotID)
+	}
+
+	f := &icebergRowFilter{}
+	for _, d := range it.applicableDeletes(data) {
+		switch d.Content {
+		case icebergContentPositionDeletes:
+			positions, err := c.loadPositionDeletes(ctx, it, d.Key)
+			if err != nil {
+				return nil, err
+			}
+			for _, pos := range positions[obj.Key] {
+				if f.positions == nil {
+					f.positions = make(map[int64]struct{})
+				}
+				f.positions[pos] = struct{}{}
+			}
+		case icebergContentEqualityDeletes:
+			eq, err := c.loadEqualityDeletes(ctx, it, d)
+			if err != nil {
+				return nil, err
+			}
+			f.equality = append(f.equality, eq)
+		}
+	}
+	if f.positions == nil && len(f.equality) == 0 {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// loadPositionDeletes reads a position delete file once and caches its
+// positions by data file key.
+func (c *Client) loadPositionDeletes(ctx context.Context, it *icebergTable, key string) (map[string][]int64, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if positions, ok := it.positionDeletes[key]; ok {
+		return positions, nil
+	}
+
+	positions := make(map[string][]int64)
+	err := c.forEachParquetRecord(ctx, key, func(rec arrow.RecordBatch) error {
+		pathIdx := rec.Schema().FieldIndices(icebergPositionDeletePathField)
+		posIdx := rec.Schema().FieldIndices(icebergPositionDeletePosField)
+		if len(pathIdx) == 0 || len(posIdx) == 0 {
+			return fmt.Errorf("position delete file %s has no file_path and pos columns", key)
+		}
+		paths, ok1 := rec.Column(pathIdx[0]).(*array.String)
+		pos, ok2 := rec.Column(posIdx[0]).(*array.Int64)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("position delete file %s has unexpected column types", key)
+		}
+		for i := 0; i < paths.Len(); i++ {
+			dataKey, err := s3URIKey(c.spec.Bucket, paths.Value(i))
+			if err != nil {
+				return err
+			}
+			positions[dataKey] = append(positions[dataKey], pos.Value(i))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read position deletes %s: %w", key, err)
+	}
+	it.positionDeletes[key] = positions
+	return positions, nil
+}
+
+// loadEqualityDeletes reads an equality delete file once and caches the
+// deleted value tuples of its equality columns.
+func (c *Client) loadEqualityDeletes(ctx context.Context, it *icebergTable, d icebergFile) (*icebergEqualityDeletes, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	if eq, ok := it.equalityDeletes[d.Key]; ok {
+		return eq, nil
+	}
+
+	names := it.metadata.columnNames()
+	eq := &icebergEqualityDeletes{keys: make(map[string]struct{})}
+	for _, id := range d.EqualityIDs {
+		name, ok := names[id]
+		if !ok {
+			return nil, fmt.Errorf("equality delete file %s references unknown field id %d", d.Key, id)
+		}
+		eq.columns = append(eq.columns, name)
+	}
+	if len(eq.columns) == 0 {
+		return nil, fmt.Errorf("equality delete file %s has no equality field ids", d.Key)
+	}
+
+	err := c.forEachParquetRecord(ctx, d.Key, func(rec arrow.RecordBatch) error {
+		cols, err := equalityColumns(rec, eq.columns)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			eq.keys[equalityKey(cols, i)] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read equality deletes %s: %w", d.Key, err)
+	}
+	it.equalityDeletes[d.Key] = eq
+	return eq, nil
+}
+
+// equalityColumns returns the columns of rec with the given names.
+func equalityColumns(rec arrow.RecordBatch, names []string) ([]arrow.Array, error) {
+	cols := make([]arrow.Array, len(names))
+	for i, name := range names {
+		idx := rec.Schema().FieldIndices(name)
+		if len(idx) == 0 {
+			return nil, fmt.Errorf("equality delete column %q not found", name)
+		}
+		cols[i] = rec.Column(idx[0])
+	}
+	return cols, nil
+}
+
+// equalityKey encodes the values of row i as a comparable string.
+func equalityKey(cols []arrow.Array, i int) string {
+	var sb strings.Builder
+	for _, col := range cols {
+		if col.IsNull(i) {
+			sb.WriteString("\x01")
+		} else {
+			sb.WriteString(col.ValueStr(i))
+		}
+		sb.WriteString("\x00")
+	}
+	return sb.String()
+}
+
+// apply returns rec without its deleted rows, or nil if every row is deleted.
+func (f *icebergRowFilter) apply(rec arrow.RecordBatch) (arrow.RecordBatch, error) {
+	n := int(rec.NumRows())
+	keep := make([]bool, n)
+	for i := range keep {
+		keep[i] = true
+	}
+	for i := 0; i < n; i++ {
+		if _, deleted := f.positions[f.offset+int64(i)]; deleted {
+			keep[i] = false
+		}
+	}
+	f.offset += int64(n)
+
+	for _, eq := range f.equality {
+		cols, err := equalityColumns(rec, eq.columns)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			if !keep[i] {
+				continue
+			}
+			if _, deleted := eq.keys[equalityKey(cols, i)]; deleted {
+				keep[i] = false
+			}
+		}
+	}
+	f.kept = f.kept[:0]
+	for i, k := range keep {
+		if k {
+			f.kept = append(f.kept, f.offset-int64(n)+int64(i))
+		}
+	}
+	return filterRecord(rec, keep)
+}
+
+// filterRecord returns the rows of rec for which keep is true, or nil if none
+// are kept. Runs of kept rows are sliced and concatenated per column.
+func filterRecord(rec arrow.RecordBatch, keep []bool) (arrow.RecordBatch, error) {
+	type run struct{ start, end int64 }
+	var runs []run
+	var kept int64
+	for i := 0; i < len(keep); i++ {
+		if !keep[i] {
+			continue
+		}
+		start := i
+		for i < len(keep) && keep[i] {
+			i++
+		}
+		runs = append(runs, run{int64(start), int64(i)})
+		kept += int64(i - start)
+	}
+	switch {
+	case kept == rec.NumRows():
+		return rec, nil
+	case kept == 0:
+		return nil, nil
+	}
+
+	cols := make([]arrow.Array, rec.NumCols())
+	for c := range cols {
+		slices := make([]arrow.Array, len(runs))
+		for r, rn := range runs {
+			slices[r] = array.NewSlice(rec.Column(c), rn.start, rn.end)
+		}
+		col, err := array.Concatenate(slices, memory.DefaultAllocator)
+		for _, s := range slices {
+			s.Release()
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer col.Release()
+		cols[c] = col
+	}
+	return array.NewRecordBatch(rec.Schema(), cols, kept), nil
+}
+
+// forEachParquetRecord calls fn for every record batch of a Parquet object.
+func (c *Client) forEachParquetRecord(ctx context.Context, key string, fn func(arrow.RecordBatch) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	records := make(chan arrow.RecordBatch, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(records)
+		errCh <- c.streamRecords(ctx, key, c.spec.RowsPerRecord, nil, records)
+	}()
+
+	var fnErr error
+	for rec := range records {
+		if fnErr == nil {
+			if fnErr = fn(rec); fnErr != nil {
+				cancel()
+			}
+		}
+		rec.Release()
+	}
+	if err := <-errCh; fnErr == nil && err != nil {
+		return err
+	}
+	return fnErr
+}
@@ -0,0 +1,351 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/hamba/avro/v2/ocf"
+)
+
+// testIcebergManifestSchema is a trimmed format version 2 manifest entry
+// schema with the optional fields Iceberg writers leave null for inheritance.
+const testIcebergManifestSchema = `{"type":"record","name":"manifest_entry","fields":[
+{"name":"status","type":"int"},
+{"name":"snapshot_id","type":["null","long"],"default":null},
+{"name":"sequence_number","type":["null","long"],"default":null},
+{"name":"data_file","type":{"type":"record","name":"r2","fields":[
+  {"name":"content","type":"int"},
+  {"name":"file_path","type":"string"},
+  {"name":"file_format","type":"string"},
+  {"name":"partition","type":{"type":"record","name":"r102","fields":[
+    {"name":"day","type":["null","int"],"default":null}]}},
+  {"name":"record_count","type":"long"},
+  {"name":"file_size_in_bytes","type":"long"},
+  {"name":"equality_ids","type":["null",{"type":"array","items":"int"}],"default":null}]}}]}`
+
+func TestIsIcebergMetadataKey(t *testing.T) {
+	tests := map[string]bool{
+		"warehouse/events/metadata/v3.metadata.json":                true,
+		"warehouse/events/metadata/00002-4a5b.metadata.json":        true,
+		"warehouse/events/metadata/00002-4a5b.gz.metadata.json":     true,
+		"warehouse/events/metadata/version-hint.text":               true,
+		"metadata/v1.metadata.json":                                 true,
+		"warehouse/events/metadata/snap-1-1-4a5b.avro":              false,
+		"warehouse/events/data/metadata.json":                       false,
+		"warehouse/events/metadata/nested/v1.metadata.json":         false,
+		"warehouse/events/notmetadata/v1.metadata.json":             false,
+		"warehouse/events/data/day=2024-01-01/00000-0-4a5b.parquet": false,
+		"warehouse/events/metadata/4a5b-m0.avro":                    false,
+		"warehouse/events/metadata/00002-4a5b.metadata.json.tmp":    false,
+		"warehouse/events/metadata/version-hint.text.bak":           false,
+		"warehouse/events/metadata/00002-4a5b.metadata.json.gz":     true,
+	}
+	for key, want := range tests {
+		if got := isIcebergMetadataKey(key); got != want {
+			t.Errorf("isIcebergMetadataKey(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestIcebergMetadataVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		want int64
+		ok   bool
+	}{
+		{"v12.metadata.json", 12, true},
+		{"00007-4a5b-9c.metadata.json", 7, true},
+		{"00007-4a5b.gz.metadata.json", 7, true},
+		{"version-hint.text", 0, false},
+		{"metadata.json", 0, false},
+	}
+	for _, tc := range tests {
+		got, ok := icebergMetadataVersion(tc.name)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("icebergMetadataVersion(%q) = %d, %v, want %d, %v", tc.name, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestFindIcebergTables(t *testing.T) {
+	roots := findIcebergTables([]S3Object{
+		{Key: "warehouse/events/metadata/v1.metadata.json"},
+		{Key: "warehouse/events/metadata/v2.metadata.json"},
+		{Key: "warehouse/users/metadata/00000-a.metadata.json"},
+		{Key: "metadata/v1.metadata.json"},
+	})
+	if len(roots) != 3 {
+		t.Fatalf("got roots %v, want 3", roots)
+	}
+	if len(roots["warehouse/events/"]) != 2 || len(roots["warehouse/users/"]) != 1 || len(roots[""]) != 1 {
+		t.Errorf("unexpected grouping: %v", roots)
+	}
+}
+
+func TestIcebergNewSnapshots(t *testing.T) {
+	parent := func(id int64) *int64 { return &id }
+	md := &icebergMetadata{Snapshots: []icebergSnapshot{
+		{SnapshotID: 1},
+		{SnapshotID: 2, ParentSnapshotID: parent(1)},
+		{SnapshotID: 3, ParentSnapshotID: parent(2)},
+		// 4 was rolled back; 5 branches off 3.
+		{SnapshotID: 4, ParentSnapshotID: parent(3)},
+		{SnapshotID: 5, ParentSnapshotID: parent(3)},
+	}}
+
+	got, ok := md.newSnapshots(1, 5)
+	if !ok {
+		t.Fatal("expected snapshot 1 to be an ancestor of 5")
+	}
+	var ids []int64
+	for _, s := range got {
+		ids = append(ids, s.SnapshotID)
+	}
+	if len(ids) != 3 || ids[0] != 2 || ids[1] != 3 || ids[2] != 5 {
+		t.Errorf("newSnapshots(1, 5) = %v, want [2 3 5]", ids)
+	}
+
+	if got, ok := md.newSnapshots(5, 5); !ok || len(got) != 0 {
+		t.Errorf("newSnapshots(5, 5) = %v, %v, want no snapshots", got, ok)
+	}
+	if _, ok := md.newSnapshots(4, 5); ok {
+		t.Error("expected rolled back snapshot 4 not to be an ancestor of 5")
+	}
+}
+
+func TestIcebergObjectsSince_NotAncestor(t *testing.T) {
+	// Snapshot 2 was rolled back, so the files removed since are unknown and
+	// syncing the live files again would duplicate their rows.
+	parent := func(id int64) *int64 { return &id }
+	dt := &DiscoveredTable{
+		Name:    "events",
+		Objects: []S3Object{{Key: "events/data/a.parquet"}},
+		iceberg: &icebergTable{Root: "events/", SnapshotID: 3, metadata: &icebergMetadata{Snapshots: []icebergSnapshot{
+			{SnapshotID: 1},
+			{SnapshotID: 2, ParentSnapshotID: parent(1)},
+			{SnapshotID: 3, ParentSnapshotID: parent(1)},
+		}}},
+	}
+	for _, keyed := range []bool{false, true} {
+		objects, removed, err := (&Client{}).icebergObjectsSince(context.Background(), dt, 2, keyed)
+		if err == nil || !strings.Contains(err.Error(), "full_refresh") {
+			t.Errorf("keyed %v: expected an error asking for full_refresh, got %v", keyed, err)
+		}
+		if len(objects) != 0 || len(removed) != 0 {
+			t.Errorf("keyed %v: got %d objects and %d removed keys, want none", keyed, len(objects), len(removed))
+		}
+	}
+}
+
+func TestIcebergManifestEntries(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := ocf.NewEncoder(testIcebergManifestSchema, &buf)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	day := int32(19723)
+	seq := int64(7)
+	snapshotID := int64(42)
+	entries := []map[string]any{
+		{
+			"status": int32(1), "snapshot_id": nil, "sequence_number": nil,
+			"data_file": map[string]any{
+				"content": int32(0), "file_path": "s3://b/warehouse/events/data/day=19723/a.parquet",
+				"file_format": "PARQUET", "partition": map[string]any{"day": &day},
+				"record_count": int64(10), "file_size_in_bytes": int64(100), "equality_ids": nil,
+			},
+		},
+		{
+			"status": int32(1), "snapshot_id": &snapshotID, "sequence_number": &seq,
+			"data_file": map[string]any{
+				"content": int32(2), "file_path": "s3://b/warehouse/events/data/eq.parquet",
+				"file_format": "PARQUET", "partition": map[string]any{"day": nil},
+				"record_count": int64(1), "file_size_in_bytes": int64(10), "equality_ids": []int32{1, 3},
+			},
+		},
+		{
+			"status": int32(2), "snapshot_id": &snapshotID, "sequence_number": &seq,
+			"data_file": map[string]any{
+				"content": int32(0), "file_path": "s3://b/warehouse/events/data/removed.parquet",
+				"file_format": "PARQUET", "partition": map[string]any{"day": nil},
+				"record_count": int64(1), "file_size_in_bytes": int64(10), "equality_ids": nil,
+			},
+		},
+	}
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	c := &Client{spec: Spec{Bucket: "b"}}
+	mf := icebergManifestFile{PartitionSpecID: 1}
+	var files []icebergFile
+	err = decodeAvro(&buf, func(dec *ocf.Decoder) error {
+		var e icebergManifestEntry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+		if e.Status == icebergStatusDeleted {
+			return nil
+		}
+		f, err := c.icebergFile(e, mf, 5, 40)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("decodeAvro: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2: %+v", len(files), files)
+	}
+
+	data := files[0]
+	if data.Key != "warehouse/events/data/day=19723/a.parquet" || data.Content != icebergContentData {
+		t.Errorf("data file = %+v", data)
+	}
+	if data.SequenceNumber != 5 || data.SnapshotID != 40 {
+		t.Errorf("data file did not inherit manifest values: %+v", data)
+	}
+	if data.Partition != `{"day":19723}` {
+		t.Errorf("data file partition = %s", data.Partition)
+	}
+
+	eq := files[1]
+	if eq.Content != icebergContentEqualityDeletes || eq.SequenceNumber != 7 || eq.SnapshotID != 42 {
+		t.Errorf("equality delete file = %+v", eq)
+	}
+	if len(eq.EqualityIDs) != 2 || eq.EqualityIDs[0] != 1 || eq.EqualityIDs[1] != 3 {
+		t.Errorf("equality ids = %v, want [1 3]", eq.EqualityIDs)
+	}
+
+	if _, err := c.icebergFile(icebergManifestEntry{DataFile: icebergDataFile{
+		Content: int32(1), FilePath: "s3://b/dv.puffin", FileFormat: "PUFFIN",
+	}}, mf, 5, 40); err == nil {
+		t.Error("expected deletion vector file to be rejected")
+	}
+}
+
+func TestIcebergApplicableDeletes(t *testing.T) {
+	it := &icebergTable{
+		metadata: &icebergMetadata{PartitionSpecs: []icebergPartitionSpec{
+			{SpecID: 0},
+			{SpecID: 1, Fields: []json.RawMessage{json.RawMessage(`{"name":"day"}`)}},
+		}},
+		deletes: []icebergFile{
+			{Key: "pos-same-seq", Content: icebergContentPositionDeletes, SequenceNumber: 3},
+			{Key: "pos-older", Content: icebergContentPositionDeletes, SequenceNumber: 2},
+			{Key: "eq-same-seq", Content: icebergContentEqualityDeletes, SpecID: 1, Partition: `{"day":1}`, SequenceNumber: 3},
+			{Key: "eq-partition", Content: icebergContentEqualityDeletes, SpecID: 1, Partition: `{"day":1}`, SequenceNumber: 4},
+			{Key: "eq-other-partition", Content: icebergContentEqualityDeletes, SpecID: 1, Partition: `{"day":2}`, SequenceNumber: 4},
+			{Key: "eq-global", Content: icebergContentEqualityDeletes, SpecID: 0, Partition: `{}`, SequenceNumber: 4},
+		},
+	}
+
+	got := it.applicableDeletes(icebergFile{SpecID: 1, Partition: `{"day":1}`, SequenceNumber: 3})
+	var keys []string
+	for _, d := range got {
+		keys = append(keys, d.Key)
+	}
+	want := "pos-same-seq,eq-partition,eq-global"
+	if strings.Join(keys, ",") != want {
+		t.Errorf("applicableDeletes = %v, want %s", keys, want)
+	}
+}
+
+func TestIcebergChangedFiles(t *testing.T) {
+	it := &icebergTable{
+		metadata: &icebergMetadata{PartitionSpecs: []icebergPartitionSpec{
+			{SpecID: 1, Fields: []json.RawMessage{json.RawMessage(`{"name":"day"}`)}},
+		}},
+		dataFiles: map[string]icebergFile{
+			"a": {Key: "a", SpecID: 1, Partition: `{"day":1}`, SequenceNumber: 1},
+			"b": {Key: "b", SpecID: 1, Partition: `{"day":2}`, SequenceNumber: 1},
+			"c": {Key: "c", SpecID: 1, Partition: `{"day":1}`, SequenceNumber: 1},
+			"d": {Key: "d", SpecID: 1, Partition: `{"day":2}`, SequenceNumber: 3},
+		},
+		// The position delete file is cached, so it is not read from S3.
+		positionDeletes: map[string]map[string][]int64{"pos": {"a": {0, 4}, "d": {1}}},
+	}
+	deletes := []icebergFile{
+		{Key: "pos", Content: icebergContentPositionDeletes, SequenceNumber: 3},
+		{Key: "eq", Content: icebergContentEqualityDeletes, SpecID: 1, Partition: `{"day":2}`, SequenceNumber: 3},
+	}
+
+	// c has no deleted positions and d was added since, so it is read with
+	// the deletes applied anyway.
+	got, err := (&Client{}).icebergChangedFiles(context.Background(), it, deletes, map[string]bool{"d": true})
+	if err != nil {
+		t.Fatalf("icebergChangedFiles: %v", err)
+	}
+	if strings.Join(got, ",") != "a,b" {
+		t.Errorf("changed files = %v, want a,b", got)
+	}
+}
+
+func TestIcebergRowFilter(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "region", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	batch := func(rows string) arrow.RecordBatch {
+		rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, sc, strings.NewReader(rows))
+		if err != nil {
+			t.Fatalf("RecordFromJSON: %v", err)
+		}
+		return rec
+	}
+
+	f := &icebergRowFilter{
+		positions: map[int64]struct{}{1: {}, 4: {}},
+		equality: []*icebergEqualityDeletes{{
+			columns: []string{"region"},
+			keys:    map[string]struct{}{"\x01\x00": {}},
+		}},
+	}
+
+	first := batch(`[{"id": 0, "region": "us"}, {"id": 1, "region": "us"}, {"id": 2, "region": null}]`)
+	defer first.Release()
+	got, err := f.apply(first)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got.NumRows() != 1 || got.Column(0).(*array.Int64).Value(0) != 0 {
+		t.Errorf("first batch = %v, want only id 0", got)
+	}
+	got.Release()
+
+	// Positions continue across batches: row 4 is the second row here.
+	second := batch(`[{"id": 3, "region": "eu"}, {"id": 4, "region": "eu"}, {"id": 5, "region": "eu"}]`)
+	defer second.Release()
+	got, err = f.apply(second)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	ids := got.Column(0).(*array.Int64)
+	if got.NumRows() != 2 || ids.Value(0) != 3 || ids.Value(1) != 5 {
+		t.Errorf("second batch = %v, want ids 3 and 5", got)
+	}
+	if len(f.kept) != 2 || f.kept[0] != 3 || f.kept[1] != 5 {
+		t.Errorf("kept = %v, want positions 3 and 5", f.kept)
+	}
+	got.Release()
+
+	third := batch(`[{"id": 6, "region": null}]`)
+	defer third.Release()
+	if got, err := f.apply(third); err != nil || got != nil {
+		t.Errorf("apply(all deleted) = %v, %v, want nil", got, err)
+	}
+}
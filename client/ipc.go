@@ -0,0 +1,99 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// ipcFileMagic opens (and closes) Arrow IPC files. It is followed by two
+// padding bytes and a regular IPC stream, so both the file and the stream
+// format can be read sequentially without the footer.
+const ipcFileMagic = "ARROW1"
+
+// readIPCSchema returns the schema embedded in an Arrow IPC file or stream.
+func (c *Client) readIPCSchema(ctx context.Context, key string) (*arrow.Schema, error) {
+	body, err := c.openObject(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	r, err := newIPCReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read arrow schema for %s: %w", key, err)
+	}
+	defer r.Release()
+
+	return r.Schema(), nil
+}
+
+// streamIPCRecords streams the record batches of an Arrow IPC file or stream,
+// re-sliced to at most batchSize rows. The version id of the object read is
+// stored in versionID if it is not nil.
+func (c *Client) streamIPCRecords(ctx context.Context, key string, batchSize int, versionID *string, records chan<- arrow.RecordBatch) error {
+	body, err := c.openObjectVersion(ctx, key, versionID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := readIPCRecords(ctx, body, batchSize, records); err != nil {
+		return fmt.Errorf("error reading records from %s: %w", key, err)
+	}
+	return nil
+}
+
+// readIPCRecords decodes Arrow IPC record batches from r. Batches larger than
+// batchSize are split into zero-copy slices; smaller batches are passed through.
+// Decode errors after the first batch was sent fail the sync rather than
+// marking the object malformed.
+func readIPCRecords(ctx context.Context, r io.Reader, batchSize int, records chan<- arrow.RecordBatch) error {
+	ir, err := newIPCReader(r)
+	if err != nil {
+		return err
+	}
+	defer ir.Release()
+
+	emitted := false
+	for ir.Next() {
+		rec := ir.RecordBatch()
+		rows := rec.NumRows()
+		for off := int64(0); off < rows; off += int64(batchSize) {
+			slice := rec.NewSlice(off, min(off+int64(batchSize), rows))
+			select {
+			case records <- slice:
+				emitted = true
+			case <-ctx.Done():
+				slice.Release()
+				return ctx.Err()
+			}
+		}
+	}
+	if err := ir.Err(); err != nil && err != io.EOF {
+		return partialObjectError(fmt.Errorf("%w: %v", errMalformedObject, err), emitted)
+	}
+	return nil
+}
+
+// newIPCReader returns a stream reader over r, skipping the IPC file magic
+// when r holds the file format (.arrow/.feather) rather than a stream.
+func newIPCReader(r io.Reader) (*ipc.Reader, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(ipcFileMagic)); err == nil && string(magic) == ipcFileMagic {
+		// Skip the magic and its padding to the 8-byte boundary.
+		if _, err := br.Discard(8); err != nil {
+			return nil, fmt.Errorf("%w: truncated arrow file: %v", errMalformedObject, err)
+		}
+	}
+	ir, err := ipc.NewReader(br, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid arrow ipc data: %v", errMalformedObject, err)
+	}
+	return ir, nil
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+var testIPCSchema = arrow.NewSchema([]arrow.Field{
+	{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+	{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+}, nil)
+
+// testIPCBatch builds a record with ids [start, start+n).
+func testIPCBatch(t *testing.T, start, n int64) arrow.RecordBatch {
+	t.Helper()
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, testIPCSchema)
+	defer bldr.Release()
+	for i := start; i < start+n; i++ {
+		bldr.Field(0).(*array.Int64Builder).Append(i)
+		bldr.Field(1).(*array.StringBuilder).Append("row")
+	}
+	return bldr.NewRecordBatch()
+}
+
+func writeTestIPC(t *testing.T, fileFormat bool, batches ...arrow.RecordBatch) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w interface {
+		Write(arrow.RecordBatch) error
+		Close() error
+	}
+	if fileFormat {
+		fw, err := ipc.NewFileWriter(&buf, ipc.WithSchema(testIPCSchema))
+		if err != nil {
+			t.Fatalf("NewFileWriter: %v", err)
+		}
+		w = fw
+	} else {
+		w = ipc.NewWriter(&buf, ipc.WithSchema(testIPCSchema))
+	}
+	for _, rec := range batches {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		rec.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestIPCRecords(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		fileFormat bool
+	}{
+		{"file", true},
+		{"stream", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := writeTestIPC(t, tc.fileFormat, testIPCBatch(t, 0, 5), testIPCBatch(t, 5, 2))
+
+			records := make(chan arrow.RecordBatch, 16)
+			if err := readIPCRecords(context.Background(), bytes.NewReader(data), 2, records); err != nil {
+				t.Fatalf("readIPCRecords: %v", err)
+			}
+			close(records)
+
+			var sizes []int64
+			var ids []int64
+			for rec := range records {
+				if !rec.Schema().Equal(testIPCSchema) {
+					t.Errorf("schema = %v, want %v", rec.Schema(), testIPCSchema)
+				}
+				sizes = append(sizes, rec.NumRows())
+				col := rec.Column(0).(*array.Int64)
+				for i := 0; i < col.Len(); i++ {
+					ids = append(ids, col.Value(i))
+				}
+				rec.Release()
+			}
+
+			wantSizes := []int64{2, 2, 1, 2}
+			if len(sizes) != len(wantSizes) {
+				t.Fatalf("batch sizes = %v, want %v", sizes, wantSizes)
+			}
+			for i := range wantSizes {
+				if sizes[i] != wantSizes[i] {
+					t.Errorf("batch sizes = %v, want %v", sizes, wantSizes)
+					break
+				}
+			}
+			for i, id := range ids {
+				if id != int64(i) {
+					t.Errorf("ids = %v, want 0..6 in order", ids)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestIPCRecords_Malformed(t *testing.T) {
+	records := make(chan arrow.RecordBatch, 1)
+	err := readIPCRecords(context.Background(), bytes.NewReader([]byte("ARROW1\x00\x00garbage")), 10, records)
+	if !errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errMalformedObject, got %v", err)
+	}
+}
+
+func TestIPCRecords_TruncatedAfterFirstBatch(t *testing.T) {
+	data := writeTestIPC(t, false, testIPCBatch(t, 0, 2), testIPCBatch(t, 2, 2))
+	// Cut the stream within the second batch, leaving out the end-of-stream
+	// marker.
+	records := make(chan arrow.RecordBatch, 16)
+	err := readIPCRecords(context.Background(), bytes.NewReader(data[:len(data)-20]), 10, records)
+	close(records)
+	n := 0
+	for rec := range records {
+		n += int(rec.NumRows())
+		rec.Release()
+	}
+	if n != 2 {
+		t.Errorf("emitted %d rows before the truncation, want 2", n)
+	}
+	// The first batch was emitted, so the object cannot be skipped.
+	if err == nil || errors.Is(err, errMalformedObject) {
+		t.Errorf("expected an error that is not errMalformedObject, got %v", err)
+	}
+}
+
+func TestFileExtensions_Arrow(t *testing.T) {
+	for _, key := range []string{"a/b.arrow", "a/b.feather", "a/b.arrows", "a/b.arrow.zst"} {
+		if !hasFileExtension(key, "arrow") {
+			t.Errorf("hasFileExtension(%q, arrow) = false, want true", key)
+		}
+	}
+	if hasFileExtension("a/b.parquet", "arrow") {
+		t.Error("hasFileExtension(a/b.parquet, arrow) = true, want false")
+	}
+}
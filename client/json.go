@@ -0,0 +1,444 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+)
+
+// inferJSONTableSchema samples the first InferRows lines of the SampleFiles
+// most recently modified objects and merges them into a single table schema.
+// Objects that are not newline-delimited JSON objects are returned as
+// mismatches and the next object is sampled instead; the schema is nil if no
+// object is.
+func (c *Client) inferJSONTableSchema(ctx context.Context, objects []S3Object) (*arrow.Schema, []schemaMismatch, error) {
+	root := &jsonType{}
+	sampled, mismatches, err := root.observeObjects(jsonSampleObjects(objects, len(objects)), c.spec.JSON.SampleFiles, c.spec.JSON.InferRows, func(key string) (io.ReadCloser, error) {
+		return c.openObject(ctx, key)
+	})
+	if err != nil || sampled == 0 {
+		return nil, mismatches, err
+	}
+	return root.schema(c.spec.JSON.Nested == "json"), mismatches, nil
+}
+
+// streamJSONRecords streams a newline-delimited JSON object as Arrow record
+// batches decoded with the table's inferred schema. The version id of the
+// object read is stored in versionID if it is not nil.
+func (c *Client) streamJSONRecords(ctx context.Context, key string, sc *arrow.Schema, batchSize int, versionID *string, records chan<- arrow.RecordBatch) error {
+	body, err := c.openObjectVersion(ctx, key, versionID)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	if err := readJSONRecords(ctx, body, sc, batchSize, records); err != nil {
+		return fmt.Errorf("error reading records from %s: %w", key, err)
+	}
+	return nil
+}
+
+// jsonSampleObjects returns up to n objects, most recently modified first, so
+// that fields added by newer producers are part of the inferred schema.
+func jsonSampleObjects(objects []S3Object, n int) []S3Object {
+	sorted := make([]S3Object, len(objects))
+	copy(sorted, objects)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ti, _ := time.Parse(time.RFC3339Nano, sorted[i].LastModified)
+		tj, _ := time.Parse(time.RFC3339Nano, sorted[j].LastModified)
+		return ti.After(tj)
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+// readJSONRecords decodes newline-delimited JSON objects into Arrow record
+// batches of at most batchSize rows. Keys absent from the schema are ignored
+// and missing keys are emitted as nulls. Malformed lines after the first batch
+// was sent fail like values that do not fit the schema.
+func readJSONRecords(ctx context.Context, r io.Reader, sc *arrow.Schema, batchSize int, records chan<- arrow.RecordBatch) error {
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, sc)
+	defer bldr.Release()
+
+	emitted := false
+	flush := func(rows int) error {
+		if rows == 0 {
+			return nil
+		}
+		rec := bldr.NewRecordBatch()
+		select {
+		case records <- rec:
+			emitted = true
+			return nil
+		case <-ctx.Done():
+			rec.Release()
+			return ctx.Err()
+		}
+	}
+
+	br := bufio.NewReader(r)
+	rows, line := 0, 0
+	for {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line++
+		if len(bytes.TrimSpace(data)) > 0 {
+			if rowErr := appendJSONRow(bldr, data); rowErr != nil {
+				return partialObjectError(fmt.Errorf("line %d: %w", line, rowErr), emitted)
+			}
+			rows++
+			if rows == batchSize {
+				if err := flush(rows); err != nil {
+					return err
+				}
+				rows = 0
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return flush(rows)
+}
+
+// appendJSONRow appends one JSON object to the record builder. Numbers are
+// decoded with UseNumber so int64 values beyond 2^53 keep their precision.
+// Lines that are not JSON objects fail with errMalformedObject, values that do
+// not fit the inferred types with errTypeMismatch.
+func appendJSONRow(bldr *array.RecordBuilder, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var row map[string]any
+	if err := dec.Decode(&row); err != nil {
+		return fmt.Errorf("%w: %v", errMalformedObject, err)
+	}
+	if row == nil {
+		return fmt.Errorf("%w: expected a JSON object, got null", errMalformedObject)
+	}
+
+	sc := bldr.Schema()
+	for i, f := range sc.Fields() {
+		if err := appendJSONValue(bldr.Field(i), row[f.Name]); err != nil {
+			return fmt.Errorf("%w: field %q: %v; raise json.infer_rows or json.sample_files to sample more lines", errTypeMismatch, f.Name, err)
+		}
+	}
+	return nil
+}
+
+// appendJSONValue appends a value decoded by encoding/json (with UseNumber)
+// to a builder of the inferred type. Missing and null values become nulls.
+func appendJSONValue(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		t, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, got %T", v)
+		}
+		b.Append(t)
+	case *array.Int64Builder:
+		num, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected integer, got %T", v)
+		}
+		n, err := num.Int64()
+		if err != nil {
+			return fmt.Errorf("expected integer, got %s", num)
+		}
+		b.Append(n)
+	case *array.Float64Builder:
+		num, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("expected number, got %T", v)
+		}
+		f, err := num.Float64()
+		if err != nil {
+			return fmt.Errorf("expected number, got %s", num)
+		}
+		b.Append(f)
+	case *array.StringBuilder:
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected string, got %T", v)
+		}
+		b.Append(str)
+	case *array.StructBuilder:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("expected object, got %T", v)
+		}
+		b.Append(true)
+		st := b.Type().(*arrow.StructType)
+		for i, f := range st.Fields() {
+			if err := appendJSONValue(b.FieldBuilder(i), obj[f.Name]); err != nil {
+				return fmt.Errorf("%w: field %q: %v; raise json.infer_rows or json.sample_files to sample more lines", errTypeMismatch, f.Name, err)
+			}
+		}
+	case *array.ListBuilder:
+		list, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("expected array, got %T", v)
+		}
+		b.Append(true)
+		for _, elem := range list {
+			if err := appendJSONValue(b.ValueBuilder(), elem); err != nil {
+				return err
+			}
+		}
+	case *types.JSONBuilder:
+		b.Append(v)
+	default:
+		return fmt.Errorf("unsupported column type %s", b.Type())
+	}
+	return nil
+}
+
+// jsonKind is the inferred kind of a JSON value.
+type jsonKind int
+
+const (
+	jsonNull jsonKind = iota
+	jsonBool
+	jsonInt
+	jsonFloat
+	jsonString
+	jsonObject
+	jsonArray
+	// jsonMixed marks values observed with incompatible kinds.
+	jsonMixed
+)
+
+// jsonType accumulates the shape of JSON values observed at one position.
+type jsonType struct {
+	kind   jsonKind
+	names  []string // object keys in first-seen order
+	fields map[string]*jsonType
+	elem   *jsonType // array element type
+}
+
+// observeObjects merges the first rows lines of up to n of the given objects
+// into t and returns how many were merged. Objects with a line that is not a
+// JSON object are not merged and are returned as mismatches.
+func (t *jsonType) observeObjects(objects []S3Object, n, rows int, open func(key string) (io.ReadCloser, error)) (int, []schemaMismatch, error) {
+	var (
+		sampled    int
+		mismatches []schemaMismatch
+	)
+	for _, obj := range objects {
+		if sampled == n {
+			break
+		}
+		body, err := open(obj.Key)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read schema from %s: %w", obj.Key, err)
+		}
+		sample := &jsonType{}
+		err = sample.observeLines(body, rows)
+		_ = body.Close()
+		if errors.Is(err, errMalformedObject) {
+			mismatches = append(mismatches, schemaMismatch{Object: obj, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read schema from %s: %w", obj.Key, err)
+		}
+		t.absorb(sample)
+		sampled++
+	}
+	return sampled, mismatches, nil
+}
+
+// observeLines merges up to n newline-delimited JSON objects into t.
+func (t *jsonType) observeLines(r io.Reader, n int) error {
+	br := bufio.NewReader(r)
+	for line, rows := 1, 0; rows < n; line++ {
+		data, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(bytes.TrimSpace(data)) > 0 {
+			if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+				return fmt.Errorf("%w: line %d is not a JSON object", errMalformedObject, line)
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.UseNumber()
+			if obsErr := t.observe(dec); obsErr != nil {
+				return fmt.Errorf("%w: line %d: %v", errMalformedObject, line, obsErr)
+			}
+			rows++
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	return nil
+}
+
+// observe reads one JSON value from dec and merges its shape into t.
+func (t *jsonType) observe(dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch v := tok.(type) {
+	case nil:
+	case bool:
+		t.merge(jsonBool)
+	case string:
+		t.merge(jsonString)
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			t.merge(jsonFloat)
+		} else if _, err := v.Int64(); err != nil {
+			t.merge(jsonFloat)
+		} else {
+			t.merge(jsonInt)
+		}
+	case json.Delim:
+		switch v {
+		case '{':
+			t.merge(jsonObject)
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ := keyTok.(string)
+				if err := t.field(key).observe(dec); err != nil {
+					return err
+				}
+			}
+		case '[':
+			t.merge(jsonArray)
+			if t.elem == nil {
+				t.elem = &jsonType{}
+			}
+			for dec.More() {
+				if err := t.elem.observe(dec); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("unexpected delimiter %v", v)
+		}
+		// Consume the closing delimiter.
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	default:
+		return errors.New("unexpected JSON token")
+	}
+	return nil
+}
+
+// merge widens t to also represent values of kind k.
+func (t *jsonType) merge(k jsonKind) {
+	switch {
+	case t.kind == k || t.kind == jsonMixed:
+	case t.kind == jsonNull:
+		t.kind = k
+	case (t.kind == jsonInt && k == jsonFloat) || (t.kind == jsonFloat && k == jsonInt):
+		t.kind = jsonFloat
+	default:
+		t.kind = jsonMixed
+	}
+}
+
+// absorb widens t to also represent the values observed by o.
+func (t *jsonType) absorb(o *jsonType) {
+	if o.kind != jsonNull {
+		t.merge(o.kind)
+	}
+	for _, name := range o.names {
+		t.field(name).absorb(o.fields[name])
+	}
+	if o.elem != nil {
+		if t.elem == nil {
+			t.elem = &jsonType{}
+		}
+		t.elem.absorb(o.elem)
+	}
+}
+
+func (t *jsonType) field(name string) *jsonType {
+	if t.fields == nil {
+		t.fields = make(map[string]*jsonType)
+	}
+	f, ok := t.fields[name]
+	if !ok {
+		f = &jsonType{}
+		t.fields[name] = f
+		t.names = append(t.names, name)
+	}
+	return f
+}
+
+// schema converts the top-level object shape into an Arrow schema.
+func (t *jsonType) schema(nestedAsJSON bool) *arrow.Schema {
+	fields := make([]arrow.Field, 0, len(t.names))
+	for _, name := range t.names {
+		fields = append(fields, arrow.Field{
+			Name:     name,
+			Type:     t.fields[name].dataType(nestedAsJSON),
+			Nullable: true,
+		})
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+// dataType maps the observed shape to an Arrow type. Values never observed
+// with a non-null value become strings; values that cannot be represented by
+// a single Arrow type (mixed kinds, empty objects, arrays of unknown elements)
+// and, when nestedAsJSON is set, all objects and arrays become JSON columns.
+func (t *jsonType) dataType(nestedAsJSON bool) arrow.DataType {
+	switch t.kind {
+	case jsonBool:
+		return arrow.FixedWidthTypes.Boolean
+	case jsonInt:
+		return arrow.PrimitiveTypes.Int64
+	case jsonFloat:
+		return arrow.PrimitiveTypes.Float64
+	case jsonString, jsonNull:
+		return arrow.BinaryTypes.String
+	case jsonObject:
+		if nestedAsJSON || len(t.names) == 0 {
+			return types.ExtensionTypes.JSON
+		}
+		fields := make([]arrow.Field, 0, len(t.names))
+		for _, name := range t.names {
+			fields = append(fields, arrow.Field{
+				Name:     name,
+				Type:     t.fields[name].dataType(nestedAsJSON),
+				Nullable: true,
+			})
+		}
+		return arrow.StructOf(fields...)
+	case jsonArray:
+		if nestedAsJSON || t.elem == nil || t.elem.kind == jsonNull {
+			return types.ExtensionTypes.JSON
+		}
+		return arrow.ListOf(t.elem.dataType(nestedAsJSON))
+	default:
+		return types.ExtensionTypes.JSON
+	}
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+)
+
+func inferJSONSchema(t *testing.T, input string, nestedAsJSON bool) *arrow.Schema {
+	t.Helper()
+	root := &jsonType{}
+	if err := root.observeLines(strings.NewReader(input), 1000); err != nil {
+		t.Fatalf("observeLines: %v", err)
+	}
+	return root.schema(nestedAsJSON)
+}
+
+func TestJSONSchemaInference(t *testing.T) {
+	input := `{"id": 1, "msg": "a", "ok": true, "score": 1, "tags": ["x"], "req": {"path": "/", "status": 200}}
+{"id": 2, "msg": null, "score": 2.5, "extra": "late", "req": {"status": 404, "ms": 1.5}}
+
+{"id": 9007199254740993, "mixed": 1}
+{"mixed": "one", "empty": {}, "nothing": null, "unknown": []}
+`
+	sc := inferJSONSchema(t, input, false)
+
+	want := []struct {
+		name string
+		typ  arrow.DataType
+	}{
+		{"id", arrow.PrimitiveTypes.Int64},
+		{"msg", arrow.BinaryTypes.String},
+		{"ok", arrow.FixedWidthTypes.Boolean},
+		{"score", arrow.PrimitiveTypes.Float64},
+		{"tags", arrow.ListOf(arrow.BinaryTypes.String)},
+		{"req", arrow.StructOf(
+			arrow.Field{Name: "path", Type: arrow.BinaryTypes.String, Nullable: true},
+			arrow.Field{Name: "status", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+			arrow.Field{Name: "ms", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		)},
+		{"extra", arrow.BinaryTypes.String},
+		{"mixed", types.ExtensionTypes.JSON},
+		{"empty", types.ExtensionTypes.JSON},
+		{"nothing", arrow.BinaryTypes.String},
+		{"unknown", types.ExtensionTypes.JSON},
+	}
+	if sc.NumFields() != len(want) {
+		t.Fatalf("NumFields = %d, want %d: %v", sc.NumFields(), len(want), sc)
+	}
+	for i, w := range want {
+		f := sc.Field(i)
+		if f.Name != w.name {
+			t.Errorf("field[%d].Name = %q, want %q", i, f.Name, w.name)
+		}
+		if !arrow.TypeEqual(f.Type, w.typ) {
+			t.Errorf("field %s type = %v, want %v", f.Name, f.Type, w.typ)
+		}
+	}
+}
+
+func TestJSONSchemaInference_NestedAsJSON(t *testing.T) {
+	sc := inferJSONSchema(t, `{"req": {"status": 200}, "tags": [1, 2]}`, true)
+	for _, f := range sc.Fields() {
+		if !arrow.TypeEqual(f.Type, types.ExtensionTypes.JSON) {
+			t.Errorf("field %s type = %v, want json", f.Name, f.Type)
+		}
+	}
+}
+
+func TestJSONSchemaInference_NotAnObject(t *testing.T) {
+	root := &jsonType{}
+	err := root.observeLines(strings.NewReader("[1, 2]\n"), 10)
+	if !errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errMalformedObject, got %v", err)
+	}
+}
+
+func TestReadJSONRecords(t *testing.T) {
+	input := `{"id": 9007199254740993, "req": {"status": 200}, "tags": ["a", "b"], "doc": {"k": [1]}}
+{"id": 2, "unexpected": true}
+{"id": 3}`
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "req", Type: arrow.StructOf(arrow.Field{Name: "status", Type: arrow.PrimitiveTypes.Int64, Nullable: true}), Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "doc", Type: types.ExtensionTypes.JSON, Nullable: true},
+	}, nil)
+
+	records := make(chan arrow.RecordBatch, 10)
+	if err := readJSONRecords(context.Background(), strings.NewReader(input), sc, 2, records); err != nil {
+		t.Fatalf("readJSONRecords: %v", err)
+	}
+	close(records)
+
+	var batches []arrow.RecordBatch
+	for rec := range records {
+		batches = append(batches, rec)
+		defer rec.Release()
+	}
+	if len(batches) != 2 || batches[0].NumRows() != 2 || batches[1].NumRows() != 1 {
+		t.Fatalf("expected batches of 2 and 1 rows, got %d batches", len(batches))
+	}
+
+	first := batches[0]
+	if got := first.Column(0).(*array.Int64).Value(0); got != 9007199254740993 {
+		t.Errorf("id = %d, want 9007199254740993 (no float64 precision loss)", got)
+	}
+	status := first.Column(1).(*array.Struct).Field(0).(*array.Int64)
+	if status.Value(0) != 200 {
+		t.Errorf("req.status = %d, want 200", status.Value(0))
+	}
+	if !first.Column(1).IsNull(1) {
+		t.Error("req should be null when the key is missing")
+	}
+	if got := first.Column(3).ValueStr(0); got != `{"k":[1]}` {
+		t.Errorf("doc = %s, want %s", got, `{"k":[1]}`)
+	}
+}
+
+func TestReadJSONRecords_TypeMismatch(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+	records := make(chan arrow.RecordBatch, 1)
+	err := readJSONRecords(context.Background(), strings.NewReader(`{"id": "abc"}`), sc, 10, records)
+	if !errors.Is(err, errTypeMismatch) || errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errTypeMismatch and not errMalformedObject, got %v", err)
+	}
+	err = readJSONRecords(context.Background(), strings.NewReader(`["not", "an", "object"]`), sc, 10, records)
+	if !errors.Is(err, errMalformedObject) {
+		t.Errorf("expected errMalformedObject, got %v", err)
+	}
+}
+
+func TestReadJSONRecords_MalformedAfterFirstBatch(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	}, nil)
+	records := make(chan arrow.RecordBatch, 10)
+	err := readJSONRecords(context.Background(), strings.NewReader("{\"id\": 1}\n{\"id\": 2}\n{\"id\": 3\n{\"id\": 4}\n"), sc, 2, records)
+	close(records)
+	n := 0
+	for rec := range records {
+		n += int(rec.NumRows())
+		rec.Release()
+	}
+	// The first batch was emitted, so the object cannot be skipped.
+	if err == nil || errors.Is(err, errMalformedObject) || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("expected an error at line 3 that is not errMalformedObject, got %v", err)
+	}
+	if n != 2 {
+		t.Errorf("emitted %d rows before the malformed line, want 2", n)
+	}
+}
+
+func TestReadJSONRecords_TypeMissAfterInferRows(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		input string
+	}{
+		{"float in int field", `{"id": 1, "req": {"status": 200}}
+{"id": 2, "req": {"status": 404}}
+{"id": 1.5, "req": {"status": 500}}
+`},
+		{"string in struct field", `{"id": 1, "req": {"status": 200}}
+{"id": 2, "req": {"status": 404}}
+{"id": 3, "req": "timeout"}
+`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := &jsonType{}
+			if err := root.observeLines(strings.NewReader(tc.input), 2); err != nil {
+				t.Fatalf("observeLines: %v", err)
+			}
+			sc := root.schema(false)
+
+			records := make(chan arrow.RecordBatch, 10)
+			err := readJSONRecords(context.Background(), strings.NewReader(tc.input), sc, 2, records)
+			close(records)
+			if !errors.Is(err, errTypeMismatch) || errors.Is(err, errMalformedObject) {
+				t.Errorf("expected errTypeMismatch and not errMalformedObject, got %v", err)
+			}
+			n := 0
+			for rec := range records {
+				n += int(rec.NumRows())
+				rec.Release()
+			}
+			if n != 2 {
+				t.Errorf("emitted %d rows before the type miss, want 2", n)
+			}
+		})
+	}
+}
+
+func TestJSONSampleObjects(t *testing.T) {
+	objects := []S3Object{
+		{Key: "old", LastModified: "2024-01-01T00:00:00Z"},
+		{Key: "newest", LastModified: "2024-03-01T00:00:00Z"},
+		{Key: "new", LastModified: "2024-02-01T00:00:00Z"},
+	}
+	sample := jsonSampleObjects(objects, 2)
+	if len(sample) != 2 || sample[0].Key != "newest" || sample[1].Key != "new" {
+		t.Errorf("sample = %v, want [newest new]", sample)
+	}
+	if objects[0].Key != "old" {
+		t.Error("jsonSampleObjects must not reorder its input")
+	}
+}
+
+func TestHasFileExtension(t *testing.T) {
+	tests := []struct {
+		key      string
+		fileType string
+		want     bool
+	}{
+		{"a/b.parquet", "parquet", true},
+		{"a/b.PARQUET", "parquet", true},
+		{"a/b.csv", "parquet", false},
+		{"a/b.jsonl", "jsonl", true},
+		{"a/b.ndjson", "jsonl", true},
+		{"a/b.json", "ndjson", true},
+		{"a/b.csv", "csv", true},
+	}
+	for _, tc := range tests {
+		if got := hasFileExtension(tc.key, tc.fileType); got != tc.want {
+			t.Errorf("hasFileExtension(%q, %q) = %v, want %v", tc.key, tc.fileType, got, tc.want)
+		}
+	}
+}
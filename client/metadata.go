@@ -0,0 +1,151 @@
+package client
+
+import (
+	"slices"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// Names of the metadata columns that record where each row was read from.
+const (
+	bucketColumn       = "_s3_bucket"
+	sourceKeyColumn    = "_s3_key"
+	etagColumn         = "_s3_etag"
+	lastModifiedColumn = "_s3_last_modified"
+	rowNumberColumn    = "_s3_row_number"
+	versionIDColumn    = "_s3_version_id"
+)
+
+// metadataFields are the Arrow fields of the metadata columns, in the order
+// they are appended to tables. ETags, modification times and version ids are
+// not known for every object, so their columns are nullable.
+var metadataFields = []arrow.Field{
+	{Name: bucketColumn, Type: arrow.BinaryTypes.String},
+	{Name: sourceKeyColumn, Type: arrow.BinaryTypes.String},
+	{Name: etagColumn, Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: lastModifiedColumn, Type: arrow.FixedWidthTypes.Timestamp_us, Nullable: true},
+	{Name: rowNumberColumn, Type: arrow.PrimitiveTypes.Int64},
+	{Name: versionIDColumn, Type: arrow.BinaryTypes.String, Nullable: true},
+}
+
+// metadataColumnNames returns the names of the metadata columns.
+func metadataColumnNames() []string {
+	names := make([]string, len(metadataFields))
+	for i, f := range metadataFields {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// metadataColumns returns the fields of the metadata columns added to every
+// table: those listed in metadata_columns, and _s3_key with on_overwrite
+// "replace".
+func (s *Spec) metadataColumns() []arrow.Field {
+	var fields []arrow.Field
+	for _, f := range metadataFields {
+		if slices.Contains(s.MetadataColumns, f.Name) || (f.Name == sourceKeyColumn && s.OnOverwrite == "replace") {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// objectMetadata holds the values of the metadata columns of an object.
+type objectMetadata struct {
+	bucket    string
+	object    S3Object
+	versionID string
+}
+
+// withMetadataColumns returns a new Arrow RecordBatch with one column appended
+// per metadata field. rows holds the position of each row of rec in the
+// object, counted from zero.
+func withMetadataColumns(rec arrow.RecordBatch, fields []arrow.Field, md objectMetadata, rows []int64) arrow.RecordBatch {
+	if len(fields) == 0 {
+		return rec
+	}
+
+	sc := rec.Schema()
+	smd := sc.Metadata()
+	newSchema := arrow.NewSchema(append(sc.Fields(), fields...), &smd)
+
+	cols := make([]arrow.Array, 0, int(rec.NumCols())+len(fields))
+	for i := 0; i < int(rec.NumCols()); i++ {
+		cols = append(cols, rec.Column(i))
+	}
+	n := int(rec.NumRows())
+	for _, f := range fields {
+		var arr arrow.Array
+		switch f.Name {
+		case bucketColumn:
+			arr = constantString(md.bucket, n)
+		case sourceKeyColumn:
+			arr = constantString(md.object.Key, n)
+		case etagColumn:
+			arr = constantString(md.object.ETag, n)
+		case lastModifiedColumn:
+			arr = lastModifiedArray(md.object.LastModified, n)
+		case rowNumberColumn:
+			arr = int64Array(rows)
+		case versionIDColumn:
+			arr = constantString(md.versionID, n)
+		}
+		defer arr.Release()
+		cols = append(cols, arr)
+	}
+	return array.NewRecordBatch(newSchema, cols, rec.NumRows())
+}
+
+// constantString builds a string array of length n holding value, or nulls
+// if value is empty.
+func constantString(value string, n int) arrow.Array {
+	bldr := array.NewStringBuilder(memory.DefaultAllocator)
+	defer bldr.Release()
+	if value == "" {
+		bldr.AppendNulls(n)
+		return bldr.NewArray()
+	}
+	bldr.Reserve(n)
+	for i := 0; i < n; i++ {
+		bldr.Append(value)
+	}
+	return bldr.NewArray()
+}
+
+// lastModifiedArray builds a timestamp array of length n holding the parsed
+// RFC 3339 time, or nulls if it cannot be parsed.
+func lastModifiedArray(lastModified string, n int) arrow.Array {
+	bldr := array.NewTimestampBuilder(memory.DefaultAllocator, arrow.FixedWidthTypes.Timestamp_us.(*arrow.TimestampType))
+	defer bldr.Release()
+	t, err := time.Parse(time.RFC3339Nano, lastModified)
+	if err != nil {
+		bldr.AppendNulls(n)
+		return bldr.NewArray()
+	}
+	v := arrow.Timestamp(t.UnixMicro())
+	bldr.Reserve(n)
+	for i := 0; i < n; i++ {
+		bldr.Append(v)
+	}
+	return bldr.NewArray()
+}
+
+// int64Array builds an int64 array of values.
+func int64Array(values []int64) arrow.Array {
+	bldr := array.NewInt64Builder(memory.DefaultAllocator)
+	defer bldr.Release()
+	bldr.AppendValues(values, nil)
+	return bldr.NewArray()
+}
+
+// rowRange returns the positions start, start+1, ..., start+n-1.
+func rowRange(start int64, n int) []int64 {
+	rows := make([]int64, n)
+	for i := range rows {
+		rows[i] = start + int64(i)
+	}
+	return rows
+}
@@ -0,0 +1,78 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+)
+
+func TestSpec_MetadataColumns(t *testing.T) {
+	s := Spec{MetadataColumns: []string{rowNumberColumn, bucketColumn}}
+	got := s.metadataColumns()
+	if len(got) != 2 || got[0].Name != bucketColumn || got[1].Name != rowNumberColumn {
+		t.Errorf("metadataColumns = %v, want _s3_bucket, _s3_row_number", got)
+	}
+
+	s = Spec{OnOverwrite: "replace"}
+	if got := s.metadataColumns(); len(got) != 1 || got[0].Name != sourceKeyColumn {
+		t.Errorf("metadataColumns with on_overwrite replace = %v, want _s3_key", got)
+	}
+}
+
+func TestWithMetadataColumns(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+
+	fields := (&Spec{MetadataColumns: metadataColumnNames()}).metadataColumns()
+	md := objectMetadata{
+		bucket: "my-bucket",
+		object: S3Object{Key: "data/file.parquet", ETag: `"abc"`, LastModified: "2024-01-02T03:04:05Z"},
+	}
+	rows := rowRange(10, int(rec.NumRows()))
+	out := withMetadataColumns(rec, fields, md, rows)
+	defer out.Release()
+
+	base := int(rec.NumCols())
+	if int(out.NumCols()) != base+len(metadataFields) {
+		t.Fatalf("NumCols = %d, want %d", out.NumCols(), base+len(metadataFields))
+	}
+	col := func(name string) arrow.Array {
+		idx := out.Schema().FieldIndices(name)
+		if len(idx) != 1 {
+			t.Fatalf("missing column %s", name)
+		}
+		return out.Column(idx[0])
+	}
+	if got := col(bucketColumn).(*array.String).Value(0); got != "my-bucket" {
+		t.Errorf("_s3_bucket = %q", got)
+	}
+	if got := col(sourceKeyColumn).(*array.String).Value(0); got != "data/file.parquet" {
+		t.Errorf("_s3_key = %q", got)
+	}
+	if got := col(etagColumn).(*array.String).Value(0); got != `"abc"` {
+		t.Errorf("_s3_etag = %q", got)
+	}
+	ts := col(lastModifiedColumn).(*array.Timestamp).Value(0)
+	if got, want := ts.ToTime(arrow.Microsecond), time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("_s3_last_modified = %v", got)
+	}
+	rowNumbers := col(rowNumberColumn).(*array.Int64)
+	for i := 0; i < rowNumbers.Len(); i++ {
+		if rowNumbers.Value(i) != int64(10+i) {
+			t.Errorf("_s3_row_number[%d] = %d, want %d", i, rowNumbers.Value(i), 10+i)
+		}
+	}
+	if got := col(versionIDColumn); got.NullN() != got.Len() {
+		t.Errorf("_s3_version_id = %v, want nulls for an unversioned bucket", got)
+	}
+}
+
+func TestWithMetadataColumns_None(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+	if out := withMetadataColumns(rec, nil, objectMetadata{}, nil); out != rec {
+		t.Error("expected the record unchanged without metadata columns")
+	}
+}
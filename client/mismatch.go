@@ -0,0 +1,142 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+// quarantineTableName is the table that lists the objects excluded from their
+// tables with schema_mismatch "quarantine".
+const quarantineTableName = "s3_quarantined_objects"
+
+// schemaMismatch is an object whose schema could not be read or does not fit
+// the schema of its table.
+type schemaMismatch struct {
+	Object S3Object
+	Reason string
+}
+
+// applyMismatchPolicy applies the schema_mismatch policy to a table with
+// mismatched objects. It returns false if the table must be dropped, and an
+// error if discovery must fail.
+func (c *Client) applyMismatchPolicy(dt *DiscoveredTable, mismatches []schemaMismatch) (bool, error) {
+	keys := make([]string, len(mismatches))
+	reasons := make([]string, len(mismatches))
+	for i, m := range mismatches {
+		keys[i] = m.Object.Key
+		reasons[i] = m.Object.Key + ": " + m.Reason
+	}
+
+	switch c.spec.SchemaMismatch {
+	case "skip_table":
+		c.logger.Warn().
+			Str("table", dt.Name).
+			Strs("keys", keys).
+			Strs("reasons", reasons).
+			Msg("schema mismatch, skipping table")
+		return false, nil
+	case "skip_file", "quarantine":
+		c.logger.Warn().
+			Str("table", dt.Name).
+			Strs("keys", keys).
+			Strs("reasons", reasons).
+			Str("policy", c.spec.SchemaMismatch).
+			Msg("schema mismatch, skipping files")
+		skip := make(map[string]bool, len(mismatches))
+		for _, k := range keys {
+			skip[k] = true
+		}
+		objects := dt.Objects[:0:0]
+		for _, obj := range dt.Objects {
+			if !skip[obj.Key] {
+				objects = append(objects, obj)
+			}
+		}
+		dt.Objects = objects
+		dt.mismatches = mismatches
+		return len(objects) > 0, nil
+	default:
+		return false, fmt.Errorf("schema mismatch in table %s: %s", dt.Name, strings.Join(reasons, "; "))
+	}
+}
+
+// withoutMismatches removes the objects excluded by the schema_mismatch policy
+// from objects read from a table log rather than a listing.
+func (dt *DiscoveredTable) withoutMismatches(objects []S3Object) []S3Object {
+	if len(dt.mismatches) == 0 {
+		return objects
+	}
+	skip := make(map[string]bool, len(dt.mismatches))
+	for _, m := range dt.mismatches {
+		skip[m.Object.Key] = true
+	}
+	kept := make([]S3Object, 0, len(objects))
+	for _, obj := range objects {
+		if !skip[obj.Key] {
+			kept = append(kept, obj)
+		}
+	}
+	return kept
+}
+
+// quarantineTable returns the table listing quarantined objects.
+func quarantineTable(quarantined []quarantinedObject) DiscoveredTable {
+	table := &schema.Table{
+		Name:        quarantineTableName,
+		Description: "Objects excluded from their tables because their schema does not match",
+		Columns: schema.ColumnList{
+			{Name: "table_name", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "key", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "size", Type: arrow.PrimitiveTypes.Int64},
+			{Name: "last_modified", Type: arrow.FixedWidthTypes.Timestamp_us},
+			{Name: "reason", Type: arrow.BinaryTypes.String},
+		},
+	}
+	if quarantined == nil {
+		// A non-nil list marks the table even when nothing is quarantined.
+		quarantined = []quarantinedObject{}
+	}
+	return DiscoveredTable{Name: quarantineTableName, Table: table, quarantine: quarantined}
+}
+
+// quarantinedObject is a quarantined object with the table it was excluded
+// from.
+type quarantinedObject struct {
+	Table string
+	schemaMismatch
+}
+
+// syncQuarantine emits the quarantined objects found during discovery.
+func (c *Client) syncQuarantine(table *schema.Table, dt *DiscoveredTable, res chan<- message.SyncMessage) {
+	c.logger.Info().
+		Str("table", table.Name).
+		Int("objects", len(dt.quarantine)).
+		Msg("syncing table")
+
+	res <- &message.SyncMigrateTable{Table: table}
+	if len(dt.quarantine) == 0 {
+		return
+	}
+
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, table.ToArrowSchema())
+	defer bldr.Release()
+	for _, q := range dt.quarantine {
+		bldr.Field(0).(*array.StringBuilder).Append(q.Table)
+		bldr.Field(1).(*array.StringBuilder).Append(q.Object.Key)
+		bldr.Field(2).(*array.Int64Builder).Append(q.Object.Size)
+		if t, err := time.Parse(time.RFC3339Nano, q.Object.LastModified); err == nil {
+			bldr.Field(3).(*array.TimestampBuilder).AppendTime(t)
+		} else {
+			bldr.Field(3).AppendNull()
+		}
+		bldr.Field(4).(*array.StringBuilder).Append(q.Reason)
+	}
+	res <- &message.SyncInsert{Record: bldr.NewRecordBatch()}
+}
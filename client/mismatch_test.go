@@ -0,0 +1,190 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/rs/zerolog"
+)
+
+func TestStrictTableSchema(t *testing.T) {
+	a := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	b := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.BinaryTypes.String}}, nil)
+	objects := []S3Object{{Key: "t/1.parquet"}, {Key: "t/2.parquet"}, {Key: "t/3.parquet"}, {Key: "t/4.parquet"}}
+
+	sc, mismatches := strictTableSchema(objects, []*arrow.Schema{b, a, a, nil})
+	if !sc.Equal(a) {
+		t.Errorf("schema = %v, want the majority schema %v", sc, a)
+	}
+	if len(mismatches) != 1 || mismatches[0].Object.Key != "t/1.parquet" {
+		t.Errorf("mismatches = %v, want t/1.parquet", mismatches)
+	}
+
+	// Ties go to the schema seen first.
+	sc, mismatches = strictTableSchema(objects[:2], []*arrow.Schema{b, a})
+	if !sc.Equal(b) || len(mismatches) != 1 || mismatches[0].Object.Key != "t/2.parquet" {
+		t.Errorf("tie = %v, %v, want %v with t/2.parquet mismatched", sc, mismatches, b)
+	}
+
+	if sc, mismatches := strictTableSchema(objects[:1], []*arrow.Schema{nil}); sc != nil || len(mismatches) != 0 {
+		t.Errorf("no schemas = %v, %v, want nil", sc, mismatches)
+	}
+}
+
+func TestMergedTableSchema(t *testing.T) {
+	a := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int32}}, nil)
+	b := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}, nil)
+	c := arrow.NewSchema([]arrow.Field{{Name: "id", Type: arrow.BinaryTypes.String}}, nil)
+	objects := []S3Object{{Key: "t/1.parquet"}, {Key: "t/2.parquet"}, {Key: "t/3.parquet"}}
+
+	sc, mismatches := mergedTableSchema(objects, []*arrow.Schema{a, c, b})
+	if !sc.Equal(b) {
+		t.Errorf("schema = %v, want %v", sc, b)
+	}
+	if len(mismatches) != 1 || mismatches[0].Object.Key != "t/2.parquet" {
+		t.Errorf("mismatches = %v, want t/2.parquet", mismatches)
+	}
+}
+
+func TestJSONObserveObjects(t *testing.T) {
+	bodies := map[string]string{
+		"t/1.jsonl": `{"id": 1, "name": "a"}` + "\n",
+		"t/2.jsonl": `{"id": 2, "bad": true}` + "\n[1, 2]\n",
+		"t/3.jsonl": `{"id": 3.5, "tags": ["x"]}` + "\n",
+		"t/4.jsonl": `{"late": 1}` + "\n",
+	}
+	open := func(key string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(bodies[key])), nil
+	}
+	objects := []S3Object{{Key: "t/1.jsonl"}, {Key: "t/2.jsonl"}, {Key: "t/3.jsonl"}, {Key: "t/4.jsonl"}}
+
+	// The malformed object is a mismatch, its keys are not part of the
+	// schema, and the next object is sampled in its place.
+	root := &jsonType{}
+	sampled, mismatches, err := root.observeObjects(objects, 2, 10, open)
+	if err != nil {
+		t.Fatalf("observeObjects: %v", err)
+	}
+	if sampled != 2 {
+		t.Errorf("sampled = %d, want 2", sampled)
+	}
+	if len(mismatches) != 1 || mismatches[0].Object.Key != "t/2.jsonl" || !strings.Contains(mismatches[0].Reason, "line 2") {
+		t.Errorf("mismatches = %v, want t/2.jsonl at line 2", mismatches)
+	}
+	want := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+	}, nil)
+	if sc := root.schema(false); !sc.Equal(want) {
+		t.Errorf("schema = %v, want %v", sc, want)
+	}
+
+	// Errors other than malformed content still fail discovery.
+	failing := func(key string) (io.ReadCloser, error) { return nil, errors.New("access denied") }
+	if _, _, err := (&jsonType{}).observeObjects(objects, 2, 10, failing); err == nil || !strings.Contains(err.Error(), "t/1.jsonl") {
+		t.Errorf("observeObjects error = %v, want one naming t/1.jsonl", err)
+	}
+}
+
+func TestApplyMismatchPolicy(t *testing.T) {
+	newTable := func() *DiscoveredTable {
+		return &DiscoveredTable{
+			Name:    "t",
+			Objects: []S3Object{{Key: "t/1.parquet"}, {Key: "t/2.parquet"}},
+		}
+	}
+	mismatches := []schemaMismatch{{Object: S3Object{Key: "t/2.parquet"}, Reason: "bad"}}
+
+	tests := []struct {
+		policy  string
+		keep    bool
+		objects int
+		wantErr bool
+	}{
+		{policy: "fail", wantErr: true},
+		{policy: "", wantErr: true},
+		{policy: "skip_table", keep: false, objects: 2},
+		{policy: "skip_file", keep: true, objects: 1},
+		{policy: "quarantine", keep: true, objects: 1},
+	}
+	for _, tc := range tests {
+		t.Run(tc.policy, func(t *testing.T) {
+			c := &Client{spec: Spec{SchemaMismatch: tc.policy}, logger: zerolog.Nop()}
+			dt := newTable()
+			keep, err := c.applyMismatchPolicy(dt, mismatches)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "t/2.parquet: bad") {
+					t.Fatalf("expected error naming the object, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyMismatchPolicy: %v", err)
+			}
+			if keep != tc.keep || len(dt.Objects) != tc.objects {
+				t.Errorf("keep = %v with %d objects, want %v with %d", keep, len(dt.Objects), tc.keep, tc.objects)
+			}
+		})
+	}
+
+	// A table left without objects is dropped.
+	c := &Client{spec: Spec{SchemaMismatch: "skip_file"}, logger: zerolog.Nop()}
+	dt := &DiscoveredTable{Name: "t", Objects: []S3Object{{Key: "t/2.parquet"}}}
+	if keep, err := c.applyMismatchPolicy(dt, mismatches); err != nil || keep {
+		t.Errorf("applyMismatchPolicy = %v, %v, want the table dropped", keep, err)
+	}
+}
+
+func TestWithoutMismatches(t *testing.T) {
+	dt := &DiscoveredTable{mismatches: []schemaMismatch{{Object: S3Object{Key: "t/2.parquet"}}}}
+	got := dt.withoutMismatches([]S3Object{{Key: "t/1.parquet"}, {Key: "t/2.parquet"}, {Key: "t/3.parquet"}})
+	if len(got) != 2 || got[0].Key != "t/1.parquet" || got[1].Key != "t/3.parquet" {
+		t.Errorf("withoutMismatches = %v", got)
+	}
+}
+
+func TestSyncQuarantine(t *testing.T) {
+	dt := quarantineTable([]quarantinedObject{{
+		Table: "t",
+		schemaMismatch: schemaMismatch{
+			Object: S3Object{Key: "t/2.parquet", Size: 42, LastModified: "2024-01-02T03:04:05Z"},
+			Reason: "bad",
+		},
+	}})
+	c := &Client{logger: zerolog.Nop()}
+	res := make(chan message.SyncMessage, 4)
+	c.syncQuarantine(dt.Table, &dt, res)
+	close(res)
+
+	var msgs []message.SyncMessage
+	for m := range res {
+		msgs = append(msgs, m)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("got %d messages, want migrate and insert", len(msgs))
+	}
+	rec := msgs[1].(*message.SyncInsert).Record
+	if rec.NumRows() != 1 {
+		t.Fatalf("rows = %d, want 1", rec.NumRows())
+	}
+	if got := rec.Column(1).(*array.String).Value(0); got != "t/2.parquet" {
+		t.Errorf("key = %q", got)
+	}
+	if got := rec.Column(2).(*array.Int64).Value(0); got != 42 {
+		t.Errorf("size = %d, want 42", got)
+	}
+	if rec.Column(3).IsNull(0) {
+		t.Error("last_modified is null")
+	}
+
+	empty := quarantineTable(nil)
+	if empty.quarantine == nil {
+		t.Error("expected an empty quarantine table to be marked")
+	}
+}
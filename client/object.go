@@ -0,0 +1,241 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// openObject opens an S3 object for sequential reading. Compressed objects,
+// identified by key extension or Content-Encoding, are decompressed on the
+// fly. The caller must close the returned reader.
+func (c *Client) openObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	return c.openObjectVersion(ctx, key, nil)
+}
+
+// openObjectVersion is openObject that also stores the version id of the
+// object read in versionID if it is not nil, or "" if the bucket is not
+// versioned.
+func (c *Client) openObjectVersion(ctx context.Context, key string, versionID *string) (io.ReadCloser, error) {
+	resp, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(c.spec.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	if versionID != nil {
+		*versionID = s3VersionID(resp.VersionId)
+	}
+	body, err := decompress(resp.Body, objectCodec(key, aws.ToString(resp.ContentEncoding)))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+	}
+	return body, nil
+}
+
+// s3VersionID returns the version id of an S3 response, or "" if the bucket
+// is not versioned.
+func s3VersionID(v *string) string {
+	if id := aws.ToString(v); id != "null" {
+		return id
+	}
+	return ""
+}
+
+// s3URIKey returns the object key of an s3://, s3a:// or s3n:// URI, which
+// must point into bucket.
+func s3URIKey(bucket, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid object URI %q: %w", uri, err)
+	}
+	switch u.Scheme {
+	case "s3", "s3a", "s3n":
+	default:
+		return "", fmt.Errorf("unsupported object URI %q", uri)
+	}
+	if u.Host != bucket {
+		return "", fmt.Errorf("object %q is outside bucket %q", uri, bucket)
+	}
+	return strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// objectTailSize is how many bytes at the end of an object are fetched when it
+// is opened for ranged reads. It covers the Parquet footer of most files, so
+// reading a schema usually takes a single request.
+const objectTailSize = 64 << 10
+
+// errObjectCompressed is returned by newS3ReaderAt for compressed objects,
+// which cannot be read at arbitrary offsets.
+var errObjectCompressed = errors.New("compressed objects do not support ranged reads")
+
+// s3GetObjectAPI is the subset of the S3 client used for ranged reads.
+type s3GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// s3ReaderAt reads an S3 object with ranged GETs. It implements
+// parquet.ReaderAtSeeker so Parquet readers fetch only the footer and the
+// column chunks they decode. ReadAt is safe for concurrent use; every range
+// is requested with If-Match so an object overwritten mid-read fails instead
+// of mixing two versions.
+type s3ReaderAt struct {
+	ctx    context.Context
+	api    s3GetObjectAPI
+	bucket string
+	key    string
+	etag   string
+	size   int64
+	// versionID is the version id of the object read, or "" if the bucket
+	// is not versioned.
+	versionID string
+
+	// tail holds the last bytes of the object, starting at tailOffset.
+	tail       []byte
+	tailOffset int64
+
+	pos int64
+}
+
+// newS3ReaderAt opens key for ranged reads, fetching its size and tail in a
+// single request.
+func newS3ReaderAt(ctx context.Context, api s3GetObjectAPI, bucket, key string) (*s3ReaderAt, error) {
+	if _, codec := splitCompressionExtension(key); codec != codecNone {
+		return nil, errObjectCompressed
+	}
+	resp, err := api.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=-%d", objectTailSize)),
+	})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "InvalidRange" {
+		// Suffix ranges of empty objects are not satisfiable.
+		return &s3ReaderAt{ctx: ctx, api: api, bucket: bucket, key: key}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if codecFromContentEncoding(aws.ToString(resp.ContentEncoding)) != codecNone {
+		return nil, errObjectCompressed
+	}
+
+	tail, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	size := int64(len(tail))
+	if cr := aws.ToString(resp.ContentRange); cr != "" {
+		if size, err = contentRangeSize(cr); err != nil {
+			return nil, fmt.Errorf("failed to download %s: %w", key, err)
+		}
+	}
+	return &s3ReaderAt{
+		ctx:        ctx,
+		api:        api,
+		bucket:     bucket,
+		key:        key,
+		etag:       aws.ToString(resp.ETag),
+		size:       size,
+		versionID:  s3VersionID(resp.VersionId),
+		tail:       tail,
+		tailOffset: size - int64(len(tail)),
+	}, nil
+}
+
+// contentRangeSize returns the complete length from a Content-Range header
+// such as "bytes 0-99/1234".
+func contentRangeSize(cr string) (int64, error) {
+	i := strings.LastIndexByte(cr, '/')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid Content-Range %q", cr)
+	}
+	size, err := strconv.ParseInt(cr[i+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Content-Range %q: %w", cr, err)
+	}
+	return size, nil
+}
+
+// Size returns the object size.
+func (r *s3ReaderAt) Size() int64 { return r.size }
+
+// ReadAt reads len(p) bytes at off, serving the object's tail from memory.
+func (r *s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d reading %s", off, r.key)
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := min(int64(len(p)), r.size-off)
+	if off >= r.tailOffset {
+		n := copy(p[:want], r.tail[off-r.tailOffset:])
+		if n < len(p) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, off+want-1)),
+	}
+	if r.etag != "" {
+		input.IfMatch = aws.String(r.etag)
+	}
+	resp, err := r.api.GetObject(r.ctx, input)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s at offset %d: %w", r.key, off, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	n, err := io.ReadFull(resp.Body, p[:want])
+	if err != nil {
+		return n, fmt.Errorf("failed to read %s at offset %d: %w", r.key, off, err)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read reads from the current offset, for callers that need an io.Reader.
+func (r *s3ReaderAt) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the offset of the next Read.
+func (r *s3ReaderAt) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.pos
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative seek offset %d", offset)
+	}
+	r.pos = offset
+	return offset, nil
+}
@@ -0,0 +1,239 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+	"github.com/infobloxopen/cq-source-s3/internal/testutil"
+)
+
+// fakeRangeAPI serves ranged GETs of a single in-memory object.
+type fakeRangeAPI struct {
+	data      []byte
+	etag      string
+	versionID string
+	requests  []string
+}
+
+func (f *fakeRangeAPI) GetObject(_ context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	rng := aws.ToString(in.Range)
+	f.requests = append(f.requests, rng)
+	if in.IfMatch != nil && *in.IfMatch != f.etag {
+		return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+	}
+
+	size := int64(len(f.data))
+	spec := strings.TrimPrefix(rng, "bytes=")
+	var start, end int64
+	if strings.HasPrefix(spec, "-") {
+		n, _ := strconv.ParseInt(spec[1:], 10, 64)
+		if size == 0 {
+			return nil, &smithy.GenericAPIError{Code: "InvalidRange"}
+		}
+		start, end = max(size-n, 0), size-1
+	} else {
+		parts := strings.SplitN(spec, "-", 2)
+		start, _ = strconv.ParseInt(parts[0], 10, 64)
+		end, _ = strconv.ParseInt(parts[1], 10, 64)
+		end = min(end, size-1)
+	}
+	return &s3.GetObjectOutput{
+		Body:         io.NopCloser(bytes.NewReader(f.data[start : end+1])),
+		ContentRange: aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, size)),
+		ETag:         aws.String(f.etag),
+		VersionId:    aws.String(f.versionID),
+	}, nil
+}
+
+func TestS3ReaderAt(t *testing.T) {
+	data := make([]byte, objectTailSize*3)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	api := &fakeRangeAPI{data: data, etag: `"v1"`}
+
+	r, err := newS3ReaderAt(context.Background(), api, "b", "k")
+	if err != nil {
+		t.Fatalf("newS3ReaderAt: %v", err)
+	}
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("Size = %d, want %d", r.Size(), len(data))
+	}
+
+	// Reads within the tail are served from memory.
+	buf := make([]byte, 16)
+	if _, err := r.ReadAt(buf, r.Size()-16); err != nil {
+		t.Fatalf("ReadAt tail: %v", err)
+	}
+	if !bytes.Equal(buf, data[len(data)-16:]) || len(api.requests) != 1 {
+		t.Errorf("tail read = %v after %d requests, want data from 1 request", buf, len(api.requests))
+	}
+
+	if _, err := r.ReadAt(buf, 100); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(buf, data[100:116]) || api.requests[1] != "bytes=100-115" {
+		t.Errorf("ranged read = %v via %v", buf, api.requests)
+	}
+
+	// Short reads at the end of the object report io.EOF.
+	n, err := r.ReadAt(make([]byte, 32), r.Size()-8)
+	if n != 8 || err != io.EOF {
+		t.Errorf("ReadAt past end = %d, %v, want 8, io.EOF", n, err)
+	}
+
+	// An overwritten object fails instead of mixing versions.
+	api.etag = `"v2"`
+	if _, err := r.ReadAt(buf, 0); err == nil {
+		t.Error("expected ReadAt to fail after the object changed")
+	}
+}
+
+func TestS3ReaderAt_VersionID(t *testing.T) {
+	// The version id is taken from the response of the first read, and
+	// unversioned buckets report the version "null".
+	for versionID, want := range map[string]string{"3HL4kqtJlcpXroDTDmJ": "3HL4kqtJlcpXroDTDmJ", "null": ""} {
+		api := &fakeRangeAPI{data: []byte("data"), etag: `"v1"`, versionID: versionID}
+		r, err := newS3ReaderAt(context.Background(), api, "b", "k")
+		if err != nil {
+			t.Fatalf("newS3ReaderAt: %v", err)
+		}
+		if r.versionID != want || len(api.requests) != 1 {
+			t.Errorf("versionID = %q after %d requests, want %q from 1 request", r.versionID, len(api.requests), want)
+		}
+	}
+}
+
+func TestS3ReaderAt_ParquetFooter(t *testing.T) {
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 10)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+	api := &fakeRangeAPI{data: data}
+
+	r, err := newS3ReaderAt(context.Background(), api, "b", "k.parquet")
+	if err != nil {
+		t.Fatalf("newS3ReaderAt: %v", err)
+	}
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		t.Fatalf("NewParquetReader: %v", err)
+	}
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("NewFileReader: %v", err)
+	}
+	sc, err := reader.Schema()
+	if err != nil {
+		t.Fatalf("Schema: %v", err)
+	}
+	if sc.NumFields() != 2 {
+		t.Errorf("schema = %v, want 2 fields", sc)
+	}
+	if len(api.requests) != 1 {
+		t.Errorf("reading the footer took %d requests, want 1: %v", len(api.requests), api.requests)
+	}
+}
+
+func TestS3ReaderAt_ParquetRowGroups(t *testing.T) {
+	const numRows, rowGroupRows = 20000, 5000
+	sc := testutil.SimpleTestSchema()
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, sc)
+	defer bldr.Release()
+	for i := 0; i < numRows; i++ {
+		bldr.Field(0).(*array.Int64Builder).Append(int64(i))
+		bldr.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("name_%d", i))
+	}
+	rec := bldr.NewRecordBatch()
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	props := parquet.NewWriterProperties(parquet.WithMaxRowGroupLength(rowGroupRows), parquet.WithDictionaryDefault(false))
+	w, err := pqarrow.NewFileWriter(sc, &buf, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("NewFileWriter: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if buf.Len() <= objectTailSize {
+		t.Fatalf("test file is %d bytes, want more than the %d byte tail", buf.Len(), objectTailSize)
+	}
+
+	api := &fakeRangeAPI{data: buf.Bytes()}
+	r, err := newS3ReaderAt(context.Background(), api, "b", "k.parquet")
+	if err != nil {
+		t.Fatalf("newS3ReaderAt: %v", err)
+	}
+	pf, err := file.NewParquetReader(r)
+	if err != nil {
+		t.Fatalf("NewParquetReader: %v", err)
+	}
+	reader, err := pqarrow.NewFileReader(pf, pqarrow.ArrowReadProperties{BatchSize: 1000}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatalf("NewFileReader: %v", err)
+	}
+	rr, err := reader.GetRecordReader(context.Background(), nil, nil)
+	if err != nil {
+		t.Fatalf("GetRecordReader: %v", err)
+	}
+	defer rr.Release()
+
+	var rows int64
+	for rr.Next() {
+		rows += rr.RecordBatch().NumRows()
+	}
+	if err := rr.Err(); err != nil {
+		t.Fatalf("RecordReader: %v", err)
+	}
+	if rows != numRows {
+		t.Errorf("rows = %d, want %d", rows, numRows)
+	}
+	// Column chunks outside the tail are fetched with their own ranged GETs.
+	if len(api.requests) < 2 {
+		t.Errorf("requests = %v, want ranged reads of row groups", api.requests)
+	}
+}
+
+func TestS3ReaderAt_Unsupported(t *testing.T) {
+	if _, err := newS3ReaderAt(context.Background(), &fakeRangeAPI{}, "b", "k.parquet.gz"); !errors.Is(err, errObjectCompressed) {
+		t.Errorf("expected errObjectCompressed for .gz key, got %v", err)
+	}
+
+	r, err := newS3ReaderAt(context.Background(), &fakeRangeAPI{}, "b", "empty.parquet")
+	if err != nil {
+		t.Fatalf("newS3ReaderAt(empty): %v", err)
+	}
+	if r.Size() != 0 {
+		t.Errorf("Size = %d, want 0", r.Size())
+	}
+	if _, err := file.NewParquetReader(r); err == nil {
+		t.Error("expected an empty object to fail as a parquet file")
+	}
+}
+
+func TestContentRangeSize(t *testing.T) {
+	if size, err := contentRangeSize("bytes 0-99/1234"); err != nil || size != 1234 {
+		t.Errorf("contentRangeSize = %d, %v, want 1234", size, err)
+	}
+	if _, err := contentRangeSize("bytes 0-99/*"); err == nil {
+		t.Error("expected error for unknown length")
+	}
+}
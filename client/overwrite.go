@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/cloudquery/plugin-sdk/v4/message"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/state"
+)
+
+// ObjectETagsKey returns the state backend key for the ETags of a table's
+// synced objects.
+func ObjectETagsKey(scope StateScope, tableName string) string {
+	return scope.key(tableName, "object_etags")
+}
+
+// GetObjectETags retrieves the ETag of every synced object of a table by key.
+// Returns an empty map if none are stored or the value cannot be parsed.
+func GetObjectETags(ctx context.Context, sc state.Client, scope StateScope, tableName string) (map[string]string, error) {
+	etags := make(map[string]string)
+	val, err := getStateValue(ctx, sc, scope, tableName, "object_etags")
+	if err != nil {
+		return etags, fmt.Errorf("failed to get object etags for %s: %w", tableName, err)
+	}
+	if val == "" {
+		return etags, nil
+	}
+	if err := json.Unmarshal([]byte(val), &etags); err != nil || etags == nil {
+		return make(map[string]string), nil
+	}
+	return etags, nil
+}
+
+// SetObjectETags stores the ETags of a table's synced objects.
+func SetObjectETags(ctx context.Context, sc state.Client, scope StateScope, tableName string, etags map[string]string) error {
+	b, err := json.Marshal(etags)
+	if err != nil {
+		return fmt.Errorf("failed to encode object etags for %s: %w", tableName, err)
+	}
+	return sc.SetKey(ctx, ObjectETagsKey(scope, tableName), string(b))
+}
+
+// changedObjects splits objects by their synced ETag: objects whose ETag is
+// unchanged are dropped, objects synced before with another ETag are also
+// returned as overwritten, and all others are returned as new.
+func changedObjects(objects []S3Object, etags map[string]string) (changed, overwritten []S3Object) {
+	for _, obj := range objects {
+		etag, ok := etags[obj.Key]
+		switch {
+		case !ok:
+			changed = append(changed, obj)
+		case etag != obj.ETag:
+			changed = append(changed, obj)
+			overwritten = append(overwritten, obj)
+		}
+	}
+	return changed, overwritten
+}
+
+// updateObjectETags records the ETags of synced objects and drops the keys
+// that are no longer listed for the table.
+func updateObjectETags(etags map[string]string, synced, listed []S3Object) {
+	for _, obj := range synced {
+		etags[obj.Key] = obj.ETag
+	}
+	keep := make(map[string]bool, len(listed))
+	for _, obj := range listed {
+		keep[obj.Key] = true
+	}
+	for key := range etags {
+		if !keep[key] {
+			delete(etags, key)
+		}
+	}
+}
+
+// deleteBySourceKey returns a message deleting the rows of a table that were
+// read from the object with the given key, which on_overwrite "replace"
+// records in the _s3_key column.
+func deleteBySourceKey(tableName, key string) *message.SyncDeleteRecord {
+	bldr := array.NewStringBuilder(memory.DefaultAllocator)
+	defer bldr.Release()
+	bldr.Append(key)
+	arr := bldr.NewArray()
+	defer arr.Release()
+
+	sc := arrow.NewSchema([]arrow.Field{{Name: sourceKeyColumn, Type: arrow.BinaryTypes.String}}, nil)
+	return &message.SyncDeleteRecord{
+		DeleteRecord: message.DeleteRecord{
+			TableName: tableName,
+			WhereClause: message.PredicateGroups{{
+				GroupingType: "AND",
+				Predicates: message.Predicates{{
+					Operator: "eq",
+					Column:   sourceKeyColumn,
+					Record:   array.NewRecordBatch(sc, []arrow.Array{arr}, 1),
+				}},
+			}},
+		},
+	}
+}
+
+// deleteRemovedObjects returns messages deleting the rows of table read from
+// the objects with the given keys, whose rows Delta and Iceberg tables update
+// or delete by removing or rewriting the objects. Rows are matched by the
+// _s3_key column, so without it the rows cannot be deleted and an error
+// describing the change is returned instead of emitting the rows twice.
+func deleteRemovedObjects(table *schema.Table, keys []string, change string) ([]*message.SyncDeleteRecord, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	if table.Columns.Get(sourceKeyColumn) == nil {
+		return nil, fmt.Errorf("%s changed the rows of %d data files that were already synced; add %s to metadata_columns so their rows can be deleted, or list the table in full_refresh", change, len(keys), sourceKeyColumn)
+	}
+	msgs := make([]*message.SyncDeleteRecord, len(keys))
+	for i, key := range keys {
+		msgs[i] = deleteBySourceKey(table.Name, key)
+	}
+	return msgs, nil
+}
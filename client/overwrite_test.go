@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+func TestChangedObjects(t *testing.T) {
+	etags := map[string]string{
+		"t/same.parquet":      `"a"`,
+		"t/rewritten.parquet": `"b"`,
+	}
+	objects := []S3Object{
+		{Key: "t/same.parquet", ETag: `"a"`},
+		{Key: "t/rewritten.parquet", ETag: `"c"`},
+		{Key: "t/new.parquet", ETag: `"d"`},
+	}
+
+	changed, overwritten := changedObjects(objects, etags)
+	if len(changed) != 2 || changed[0].Key != "t/rewritten.parquet" || changed[1].Key != "t/new.parquet" {
+		t.Errorf("changed = %v, want t/rewritten.parquet and t/new.parquet", changed)
+	}
+	if len(overwritten) != 1 || overwritten[0].Key != "t/rewritten.parquet" {
+		t.Errorf("overwritten = %v, want t/rewritten.parquet", overwritten)
+	}
+}
+
+func TestUpdateObjectETags(t *testing.T) {
+	etags := map[string]string{
+		"t/kept.parquet":    `"a"`,
+		"t/deleted.parquet": `"b"`,
+	}
+	synced := []S3Object{{Key: "t/new.parquet", ETag: `"c"`}}
+	listed := []S3Object{{Key: "t/kept.parquet"}, {Key: "t/new.parquet"}}
+
+	updateObjectETags(etags, synced, listed)
+	want := map[string]string{"t/kept.parquet": `"a"`, "t/new.parquet": `"c"`}
+	if len(etags) != len(want) {
+		t.Fatalf("etags = %v, want %v", etags, want)
+	}
+	for key, etag := range want {
+		if etags[key] != etag {
+			t.Errorf("etags[%s] = %q, want %q", key, etags[key], etag)
+		}
+	}
+}
+
+func TestObjectETags_Roundtrip(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	scope := StateScope{Bucket: "bucket"}
+
+	etags, err := GetObjectETags(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetObjectETags: %v", err)
+	}
+	if len(etags) != 0 {
+		t.Fatalf("expected no etags, got %v", etags)
+	}
+	etags["events/1.parquet"] = `"1"`
+	if err := SetObjectETags(ctx, sc, scope, "events", etags); err != nil {
+		t.Fatalf("SetObjectETags: %v", err)
+	}
+	got, err := GetObjectETags(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetObjectETags: %v", err)
+	}
+	if got["events/1.parquet"] != `"1"` {
+		t.Errorf("etags = %v", got)
+	}
+}
+
+func TestDeleteBySourceKey(t *testing.T) {
+	msg := deleteBySourceKey("events", "events/1.parquet")
+	if msg.TableName != "events" {
+		t.Errorf("TableName = %q, want events", msg.TableName)
+	}
+	if len(msg.WhereClause) != 1 || len(msg.WhereClause[0].Predicates) != 1 {
+		t.Fatalf("WhereClause = %+v, want one predicate", msg.WhereClause)
+	}
+	pred := msg.WhereClause[0].Predicates[0]
+	if pred.Operator != "eq" || pred.Column != sourceKeyColumn {
+		t.Errorf("predicate = %s %s, want eq %s", pred.Column, pred.Operator, sourceKeyColumn)
+	}
+	if got := pred.Record.Column(0).(*array.String).Value(0); got != "events/1.parquet" {
+		t.Errorf("predicate value = %q, want events/1.parquet", got)
+	}
+}
+
+func TestDeleteRemovedObjects(t *testing.T) {
+	table := &schema.Table{Name: "events", Columns: schema.ColumnList{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}}
+	if msgs, err := deleteRemovedObjects(table, nil, "delta commits after version 3"); err != nil || msgs != nil {
+		t.Errorf("deleteRemovedObjects without removed objects = %v, %v; want nothing", msgs, err)
+	}
+	_, err := deleteRemovedObjects(table, []string{"events/a.parquet"}, "delta commits after version 3")
+	if err == nil || !strings.Contains(err.Error(), sourceKeyColumn) {
+		t.Fatalf("expected an error naming %s for a table without it, got %v", sourceKeyColumn, err)
+	}
+
+	table.Columns = append(table.Columns, schema.Column{Name: sourceKeyColumn, Type: arrow.BinaryTypes.String})
+	msgs, err := deleteRemovedObjects(table, []string{"events/a.parquet", "events/b.parquet"}, "delta commits after version 3")
+	if err != nil {
+		t.Fatalf("deleteRemovedObjects: %v", err)
+	}
+	if len(msgs) != 2 || msgs[1].TableName != "events" {
+		t.Fatalf("messages = %v, want a delete per object", msgs)
+	}
+	if got := msgs[1].WhereClause[0].Predicates[0].Record.Column(0).(*array.String).Value(0); got != "events/b.parquet" {
+		t.Errorf("predicate value = %q, want events/b.parquet", got)
+	}
+}
@@ -1,28 +1,30 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 
 	"github.com/apache/arrow-go/v18/arrow"
 	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
 	"github.com/apache/arrow-go/v18/parquet/file"
 	"github.com/apache/arrow-go/v18/parquet/pqarrow"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
-// readParquetSchema downloads an S3 object to a temp file and reads its Arrow schema.
+// readParquetSchema reads the Arrow schema of a Parquet object from its footer
+// using ranged reads, so the data pages are never downloaded.
 func (c *Client) readParquetSchema(ctx context.Context, key string) (*arrow.Schema, error) {
-	tmpFile, cleanup, err := c.downloadToTemp(ctx, key)
+	src, cleanup, err := c.parquetSource(ctx, key, true, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer cleanup()
 
-	pf, err := file.OpenParquetFile(tmpFile.Name(), false)
+	pf, err := file.NewParquetReader(src)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open parquet file %s: %w", key, err)
 	}
@@ -43,15 +45,19 @@ func (c *Client) readParquetSchema(ctx context.Context, key string) (*arrow.Sche
 	return sc, nil
 }
 
-// streamRecords downloads an S3 object and streams Arrow record batches to the channel.
-func (c *Client) streamRecords(ctx context.Context, key string, batchSize int, records chan<- arrow.RecordBatch) error {
-	tmpFile, cleanup, err := c.downloadToTemp(ctx, key)
+// streamRecords reads a Parquet object and streams Arrow record batches to the
+// channel. With read_mode "stream" the column chunks of each row group are
+// fetched with ranged GETs as they are decoded; otherwise the object is
+// downloaded to scratch_dir first. The version id of the object read is
+// stored in versionID if it is not nil.
+func (c *Client) streamRecords(ctx context.Context, key string, batchSize int, versionID *string, records chan<- arrow.RecordBatch) error {
+	src, cleanup, err := c.parquetSource(ctx, key, c.spec.ReadMode == "stream", versionID)
 	if err != nil {
 		return err
 	}
 	defer cleanup()
 
-	pf, err := file.OpenParquetFile(tmpFile.Name(), false)
+	pf, err := file.NewParquetReader(src)
 	if err != nil {
 		return fmt.Errorf("failed to open parquet file %s: %w", key, err)
 	}
@@ -88,19 +94,69 @@ func (c *Client) streamRecords(ctx context.Context, key string, batchSize int, r
 	return nil
 }
 
-// downloadToTemp downloads an S3 object to a temporary file and returns the file
-// and a cleanup function.
-func (c *Client) downloadToTemp(ctx context.Context, key string) (*os.File, func(), error) {
-	resp, err := c.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(c.spec.Bucket),
-		Key:    aws.String(key),
-	})
+// parquetSource opens an S3 object for Parquet reading. With ranged set, byte
+// ranges are fetched on demand; otherwise the object is downloaded to a
+// temporary file first. Compressed objects cannot be read at arbitrary
+// offsets, so they are downloaded even when ranged is set, into memory with
+// read_mode "stream" and to a temporary file otherwise. The version id of the
+// object read is stored in versionID if it is not nil. The returned cleanup
+// function must be called when reading is done.
+func (c *Client) parquetSource(ctx context.Context, key string, ranged bool, versionID *string) (parquet.ReaderAtSeeker, func(), error) {
+	if ranged {
+		r, err := newS3ReaderAt(ctx, c.s3Client, c.spec.Bucket, key)
+		if err == nil {
+			if versionID != nil {
+				*versionID = r.versionID
+			}
+			return r, func() {}, nil
+		}
+		if !errors.Is(err, errObjectCompressed) {
+			return nil, nil, err
+		}
+	}
+
+	if c.spec.ReadMode == "stream" {
+		data, err := c.downloadToMemory(ctx, key, versionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return bytes.NewReader(data), func() {}, nil
+	}
+
+	tmpFile, cleanup, err := c.downloadToTemp(ctx, key, versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tmpFile, cleanup, nil
+}
+
+// downloadToMemory downloads and decompresses an S3 object into memory,
+// storing its version id in versionID if it is not nil.
+func (c *Client) downloadToMemory(ctx context.Context, key string, versionID *string) ([]byte, error) {
+	body, err := c.openObjectVersion(ctx, key, versionID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// downloadToTemp downloads an S3 object to a temporary file in scratch_dir,
+// decompressing it if needed, and returns the file and a cleanup function.
+// The version id of the object is stored in versionID if it is not nil.
+func (c *Client) downloadToTemp(ctx context.Context, key string, versionID *string) (*os.File, func(), error) {
+	body, err := c.openObjectVersion(ctx, key, versionID)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to download %s: %w", key, err)
+		return nil, nil, err
 	}
-	defer func() { _ = resp.Body.Close() }()
+	defer func() { _ = body.Close() }()
 
-	tmpFile, err := os.CreateTemp("", "cq-s3-*.parquet")
+	tmpFile, err := os.CreateTemp(c.spec.ScratchDir, "cq-s3-*.parquet")
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to create temp file: %w", err)
 	}
@@ -110,7 +166,7 @@ func (c *Client) downloadToTemp(ctx context.Context, key string) (*os.File, func
 		_ = os.Remove(tmpFile.Name())
 	}
 
-	if _, err := io.Copy(tmpFile, resp.Body); err != nil {
+	if _, err := io.Copy(tmpFile, body); err != nil {
 		cleanup()
 		return nil, nil, fmt.Errorf("failed to write temp file for %s: %w", key, err)
 	}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+// hiveDefaultPartition is the value Hive and Spark write for NULL partition values.
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// partitionDateLayout is the layout used to detect date-typed partition values.
+const partitionDateLayout = "2006-01-02"
+
+// inferPartitionFields returns one nullable Arrow field per Hive-style
+// partition key found across the objects, in first-seen order. A key is typed
+// as int64 if every non-null value parses as an integer, as date32 if every
+// non-null value is a YYYY-MM-DD date, and as string otherwise.
+func inferPartitionFields(objects []S3Object) []arrow.Field {
+	var order []string
+	values := make(map[string][]string)
+	for _, obj := range objects {
+		for _, p := range obj.Partitions {
+			if _, ok := values[p.Key]; !ok {
+				order = append(order, p.Key)
+				values[p.Key] = nil
+			}
+			if p.Value == hiveDefaultPartition || p.Value == "" {
+				continue
+			}
+			values[p.Key] = append(values[p.Key], p.Value)
+		}
+	}
+
+	fields := make([]arrow.Field, 0, len(order))
+	for _, key := range order {
+		fields = append(fields, arrow.Field{
+			Name:     key,
+			Type:     inferPartitionType(values[key]),
+			Nullable: true,
+		})
+	}
+	return fields
+}
+
+// checkPartitionKeys returns an error if a partition key of the objects
+// sanitizes to an empty column name, if an object has two partition keys with
+// the same column name, or if different keys sanitize to the same column name,
+// whose values would otherwise be mixed up in one column.
+func checkPartitionKeys(objects []S3Object) error {
+	rawKeys := make(map[string]string)
+	for _, obj := range objects {
+		seen := make(map[string]bool, len(obj.Partitions))
+		for _, p := range obj.Partitions {
+			if p.Key == "" {
+				return fmt.Errorf("partition key %q of %s has no characters valid in a column name", p.RawKey, obj.Key)
+			}
+			if seen[p.Key] {
+				return fmt.Errorf("%s has more than one partition key named %s", obj.Key, p.Key)
+			}
+			seen[p.Key] = true
+			if raw, ok := rawKeys[p.Key]; ok && raw != p.RawKey {
+				return fmt.Errorf("partition keys %q and %q of %s both become column %s", raw, p.RawKey, obj.Key, p.Key)
+			}
+			rawKeys[p.Key] = p.RawKey
+		}
+	}
+	return nil
+}
+
+// inferPartitionType picks the narrowest Arrow type that can represent all values.
+func inferPartitionType(values []string) arrow.DataType {
+	if len(values) == 0 {
+		return arrow.BinaryTypes.String
+	}
+	isInt, isDate := true, true
+	for _, v := range values {
+		if isInt {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				isInt = false
+			}
+		}
+		if isDate {
+			if _, err := time.Parse(partitionDateLayout, v); err != nil {
+				isDate = false
+			}
+		}
+	}
+	switch {
+	case isInt:
+		return arrow.PrimitiveTypes.Int64
+	case isDate:
+		return arrow.FixedWidthTypes.Date32
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// withoutFileColumns drops partition fields whose name already exists in the
+// file schema. Files that physically contain the partition column take precedence.
+func withoutFileColumns(partitions []arrow.Field, sc *arrow.Schema) []arrow.Field {
+	var kept []arrow.Field
+	for _, f := range partitions {
+		if sc.HasField(f.Name) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// withPartitionColumns returns a new Arrow RecordBatch with one constant column
+// appended per partition field, filled with the object's partition value.
+// Missing or unparsable values are emitted as nulls.
+func withPartitionColumns(rec arrow.RecordBatch, fields []arrow.Field, partitions []naming.Partition) arrow.RecordBatch {
+	if len(fields) == 0 {
+		return rec
+	}
+
+	byKey := make(map[string]string, len(partitions))
+	for _, p := range partitions {
+		byKey[p.Key] = p.Value
+	}
+
+	sc := rec.Schema()
+	newFields := append(sc.Fields(), fields...)
+	md := sc.Metadata()
+	newSchema := arrow.NewSchema(newFields, &md)
+
+	cols := make([]arrow.Array, 0, len(newFields))
+	for i := 0; i < int(rec.NumCols()); i++ {
+		cols = append(cols, rec.Column(i))
+	}
+	for _, f := range fields {
+		arr := partitionArray(f.Type, byKey[f.Name], int(rec.NumRows()))
+		defer arr.Release()
+		cols = append(cols, arr)
+	}
+
+	return array.NewRecordBatch(newSchema, cols, rec.NumRows())
+}
+
+// partitionArray builds an array of length n holding the typed partition value.
+func partitionArray(dt arrow.DataType, value string, n int) arrow.Array {
+	bldr := array.NewBuilder(memory.DefaultAllocator, dt)
+	defer bldr.Release()
+	bldr.Reserve(n)
+
+	if value == "" || value == hiveDefaultPartition {
+		bldr.AppendNulls(n)
+		return bldr.NewArray()
+	}
+
+	switch b := bldr.(type) {
+	case *array.Int64Builder:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			b.AppendNulls(n)
+			break
+		}
+		for i := 0; i < n; i++ {
+			b.Append(v)
+		}
+	case *array.Date32Builder:
+		t, err := time.Parse(partitionDateLayout, value)
+		if err != nil {
+			b.AppendNulls(n)
+			break
+		}
+		v := arrow.Date32FromTime(t)
+		for i := 0; i < n; i++ {
+			b.Append(v)
+		}
+	case *array.StringBuilder:
+		for i := 0; i < n; i++ {
+			b.Append(value)
+		}
+	default:
+		bldr.AppendNulls(n)
+	}
+	return bldr.NewArray()
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+func TestInferPartitionFields(t *testing.T) {
+	objects := []S3Object{
+		{Partitions: []naming.Partition{{Key: "dt", Value: "2024-01-01"}, {Key: "hour", Value: "07"}, {Key: "region", Value: "us"}}},
+		{Partitions: []naming.Partition{{Key: "dt", Value: "2024-01-02"}, {Key: "hour", Value: "23"}, {Key: "region", Value: "10"}}},
+		{Partitions: []naming.Partition{{Key: "dt", Value: hiveDefaultPartition}, {Key: "hour", Value: "5"}}},
+	}
+
+	fields := inferPartitionFields(objects)
+
+	want := []struct {
+		name string
+		typ  arrow.DataType
+	}{
+		{"dt", arrow.FixedWidthTypes.Date32},
+		{"hour", arrow.PrimitiveTypes.Int64},
+		{"region", arrow.BinaryTypes.String},
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("got %d fields, want %d: %v", len(fields), len(want), fields)
+	}
+	for i, w := range want {
+		if fields[i].Name != w.name {
+			t.Errorf("field[%d].Name = %q, want %q", i, fields[i].Name, w.name)
+		}
+		if !arrow.TypeEqual(fields[i].Type, w.typ) {
+			t.Errorf("field[%d].Type = %v, want %v", i, fields[i].Type, w.typ)
+		}
+		if !fields[i].Nullable {
+			t.Errorf("field[%d] should be nullable", i)
+		}
+	}
+}
+
+func TestInferPartitionFields_None(t *testing.T) {
+	if fields := inferPartitionFields([]S3Object{{Key: "data/file.parquet"}}); len(fields) != 0 {
+		t.Errorf("expected no partition fields, got %v", fields)
+	}
+}
+
+func TestCheckPartitionKeys(t *testing.T) {
+	objects := func(keys ...string) []S3Object {
+		var objs []S3Object
+		for _, key := range keys {
+			_, partitions := naming.SplitPartitions(key)
+			objs = append(objs, S3Object{Key: key, Partitions: partitions})
+		}
+		return objs
+	}
+
+	if err := checkPartitionKeys(objects("t/dt=1/region=us/a.parquet", "t/dt=2/b.parquet")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, keys := range [][]string{
+		{"t/--=1/a.parquet"},
+		{"t/dt=1/dt=2/a.parquet"},
+		{"t/event-type=a/event_type=b/a.parquet"},
+		{"t/event-type=a/a.parquet", "t/event_type=b/b.parquet"},
+	} {
+		if err := checkPartitionKeys(objects(keys...)); err == nil {
+			t.Errorf("expected an error for %v", keys)
+		}
+	}
+}
+
+func TestWithoutFileColumns(t *testing.T) {
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.BinaryTypes.String},
+		{Name: "dt", Type: arrow.BinaryTypes.String},
+	}, nil)
+	partitions := []arrow.Field{
+		{Name: "dt", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+		{Name: "region", Type: arrow.BinaryTypes.String, Nullable: true},
+	}
+
+	kept := withoutFileColumns(partitions, sc)
+	if len(kept) != 1 || kept[0].Name != "region" {
+		t.Errorf("withoutFileColumns = %v, want [region]", kept)
+	}
+}
+
+func TestWithPartitionColumns(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+
+	fields := []arrow.Field{
+		{Name: "dt", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+		{Name: "hour", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+		{Name: "region", Type: arrow.BinaryTypes.String, Nullable: true},
+	}
+	partitions := []naming.Partition{
+		{Key: "dt", Value: "2024-01-02"},
+		{Key: "hour", Value: hiveDefaultPartition},
+		{Key: "region", Value: "us-east"},
+	}
+
+	result := withPartitionColumns(rec, fields, partitions)
+	defer result.Release()
+
+	if result.NumCols() != 5 {
+		t.Fatalf("NumCols = %d, want 5", result.NumCols())
+	}
+	if result.NumRows() != rec.NumRows() {
+		t.Errorf("NumRows = %d, want %d", result.NumRows(), rec.NumRows())
+	}
+
+	dt := result.Column(2).(*array.Date32)
+	if got := dt.Value(0).ToTime().Format(partitionDateLayout); got != "2024-01-02" {
+		t.Errorf("dt = %q, want %q", got, "2024-01-02")
+	}
+	if !result.Column(3).IsNull(0) {
+		t.Error("hour should be null for the Hive default partition")
+	}
+	if got := result.Column(4).(*array.String).Value(0); got != "us-east" {
+		t.Errorf("region = %q, want %q", got, "us-east")
+	}
+}
+
+func TestWithPartitionColumns_NoFields(t *testing.T) {
+	rec := makeTestRecordBatch(nil)
+	defer rec.Release()
+
+	if result := withPartitionColumns(rec, nil, nil); result != rec {
+		t.Error("expected the original record when there are no partition fields")
+	}
+}
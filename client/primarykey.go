@@ -0,0 +1,84 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/infobloxopen/cq-source-s3/internal/glob"
+)
+
+// primaryKeyRule is a compiled primary_keys entry.
+type primaryKeyRule struct {
+	table   *regexp.Regexp
+	columns []string
+}
+
+// primaryKeyRules are the compiled primary_keys entries, in order.
+type primaryKeyRules []primaryKeyRule
+
+// newPrimaryKeyRules compiles and validates the primary_keys entries.
+func newPrimaryKeyRules(keys []PrimaryKey) (primaryKeyRules, error) {
+	rules := make(primaryKeyRules, 0, len(keys))
+	for i, k := range keys {
+		if k.Table == "" {
+			return nil, fmt.Errorf("invalid primary_keys[%d]: table is required", i)
+		}
+		re, err := glob.Compile(k.Table)
+		if err != nil {
+			return nil, fmt.Errorf("invalid primary_keys[%d] table pattern: %w", i, err)
+		}
+		if len(k.Columns) == 0 {
+			return nil, fmt.Errorf("invalid primary_keys[%d]: columns are required", i)
+		}
+		seen := make(map[string]bool, len(k.Columns))
+		for _, name := range k.Columns {
+			if name == "" {
+				return nil, fmt.Errorf("invalid primary_keys[%d]: columns must not contain empty names", i)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("invalid primary_keys[%d]: column %s is listed twice", i, name)
+			}
+			seen[name] = true
+		}
+		rules = append(rules, primaryKeyRule{table: re, columns: k.Columns})
+	}
+	return rules, nil
+}
+
+// columns returns the primary key columns of the first rule matching table,
+// or nil if none does.
+func (r primaryKeyRules) columns(table string) []string {
+	for _, rule := range r {
+		if rule.table.MatchString(table) {
+			return rule.columns
+		}
+	}
+	return nil
+}
+
+// apply marks the primary key columns of table, replacing any primary key
+// read from file metadata. Every column must exist and have a type
+// destinations can key rows by.
+func (r primaryKeyRules) apply(table *schema.Table) error {
+	columns := r.columns(table.Name)
+	if len(columns) == 0 {
+		return nil
+	}
+	for i := range table.Columns {
+		table.Columns[i].PrimaryKey = false
+	}
+	for _, name := range columns {
+		col := table.Columns.Get(name)
+		if col == nil {
+			return fmt.Errorf("table %s has no primary_keys column %s", table.Name, name)
+		}
+		switch col.Type.ID() {
+		case arrow.LIST, arrow.LARGE_LIST, arrow.FIXED_SIZE_LIST, arrow.STRUCT, arrow.MAP:
+			return fmt.Errorf("primary_keys column %s of table %s has nested type %s", name, table.Name, col.Type)
+		}
+		col.PrimaryKey = true
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+)
+
+func TestPrimaryKeyRules(t *testing.T) {
+	rules, err := newPrimaryKeyRules([]PrimaryKey{
+		{Table: "orders", Columns: []string{"order_id"}},
+		{Table: "dim_*", Columns: []string{"id", "region"}},
+		{Table: "*", Columns: []string{"id"}},
+	})
+	if err != nil {
+		t.Fatalf("newPrimaryKeyRules: %v", err)
+	}
+	tests := map[string][]string{
+		"orders":        {"order_id"},
+		"dim_customers": {"id", "region"},
+		"users":         {"id"},
+	}
+	for table, want := range tests {
+		if got := rules.columns(table); !slices.Equal(got, want) {
+			t.Errorf("columns(%q) = %v, want %v", table, got, want)
+		}
+	}
+
+	table := &schema.Table{
+		Name: "dim_customers",
+		Columns: schema.ColumnList{
+			{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+			{Name: "region", Type: arrow.BinaryTypes.String},
+			{Name: "name", Type: arrow.BinaryTypes.String, PrimaryKey: true},
+		},
+	}
+	if err := rules.apply(table); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if got := table.PrimaryKeys(); !slices.Equal(got, []string{"id", "region"}) {
+		t.Errorf("PrimaryKeys = %v, want [id region]", got)
+	}
+
+	missing := &schema.Table{Name: "orders", Columns: schema.ColumnList{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}}
+	if err := rules.apply(missing); err == nil {
+		t.Error("expected error for a missing primary key column")
+	}
+	nested := &schema.Table{Name: "users", Columns: schema.ColumnList{{Name: "id", Type: arrow.ListOf(arrow.PrimitiveTypes.Int64)}}}
+	if err := rules.apply(nested); err == nil {
+		t.Error("expected error for a nested primary key column")
+	}
+
+	for _, keys := range [][]PrimaryKey{
+		{{Columns: []string{"id"}}},
+		{{Table: "orders"}},
+		{{Table: "orders", Columns: []string{"id", "id"}}},
+		{{Table: "dim_[a", Columns: []string{"id"}}},
+	} {
+		if _, err := newPrimaryKeyRules(keys); err == nil {
+			t.Errorf("expected error for primary_keys %+v", keys)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cloudquery/plugin-sdk/v4/state"
+)
+
+// ProcessedObjects is the state of a table synced with incremental_mode
+// "objects": the key and ETag of every object synced since the watermark.
+// Objects last modified at or before the watermark count as synced, which
+// bounds the set to the objects of the lookback window.
+type ProcessedObjects struct {
+	Watermark time.Time                  `json:"watermark"`
+	Objects   map[string]processedObject `json:"objects"`
+}
+
+// processedObject is a synced object in a ProcessedObjects set.
+type processedObject struct {
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// ProcessedObjectsKey returns the state backend key for a table's set of
+// processed objects.
+func ProcessedObjectsKey(scope StateScope, tableName string) string {
+	return scope.key(tableName, "processed_objects")
+}
+
+// GetProcessedObjects retrieves the processed objects of a table. A table
+// without a set starts from its last_modified cursor, so switching from the
+// cursor mode does not sync the table again. Returns an empty set if neither
+// exists or the value cannot be parsed.
+func GetProcessedObjects(ctx context.Context, sc state.Client, scope StateScope, tableName string) (*ProcessedObjects, error) {
+	p := &ProcessedObjects{Objects: make(map[string]processedObject)}
+	val, err := getStateValue(ctx, sc, scope, tableName, "processed_objects")
+	if err != nil {
+		return p, fmt.Errorf("failed to get processed objects for %s: %w", tableName, err)
+	}
+	if val == "" {
+		p.Watermark, err = GetCursor(ctx, sc, scope, tableName)
+		return p, err
+	}
+	if err := json.Unmarshal([]byte(val), p); err != nil {
+		return &ProcessedObjects{Objects: make(map[string]processedObject)}, nil
+	}
+	if p.Objects == nil {
+		p.Objects = make(map[string]processedObject)
+	}
+	return p, nil
+}
+
+// SetProcessedObjects stores the processed objects of a table.
+func SetProcessedObjects(ctx context.Context, sc state.Client, scope StateScope, tableName string, p *ProcessedObjects) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode processed objects for %s: %w", tableName, err)
+	}
+	return sc.SetKey(ctx, ProcessedObjectsKey(scope, tableName), string(b))
+}
+
+// filter returns the objects that have not been processed: those last
+// modified after the watermark whose key and ETag are not in the set.
+// Objects whose LastModified cannot be parsed are always returned.
+func (p *ProcessedObjects) filter(objects []S3Object) []S3Object {
+	var filtered []S3Object
+	for _, obj := range objects {
+		t, err := time.Parse(time.RFC3339Nano, obj.LastModified)
+		if err != nil {
+			filtered = append(filtered, obj)
+			continue
+		}
+		if !t.After(p.Watermark) {
+			continue
+		}
+		if done, ok := p.Objects[obj.Key]; ok && done.ETag == obj.ETag {
+			continue
+		}
+		filtered = append(filtered, obj)
+	}
+	return filtered
+}
+
+// add records objects as processed. Objects whose LastModified cannot be
+// parsed are not recorded, so they are synced again like in cursor mode.
+func (p *ProcessedObjects) add(objects []S3Object) {
+	for _, obj := range objects {
+		t, err := time.Parse(time.RFC3339Nano, obj.LastModified)
+		if err != nil {
+			continue
+		}
+		p.Objects[obj.Key] = processedObject{ETag: obj.ETag, LastModified: t}
+	}
+}
+
+// compact advances the watermark to lookback before the newest processed
+// object, but not past limit unless it is zero, and drops the objects at or
+// before it. Objects that appear in a listing later than others are still
+// synced if they were last modified within lookback of the newest object.
+func (p *ProcessedObjects) compact(lookback time.Duration, limit time.Time) {
+	var newest time.Time
+	for _, obj := range p.Objects {
+		if obj.LastModified.After(newest) {
+			newest = obj.LastModified
+		}
+	}
+	if newest.IsZero() {
+		return
+	}
+	w := newest.Add(-lookback)
+	if !limit.IsZero() && w.After(limit) {
+		w = limit
+	}
+	if w.After(p.Watermark) {
+		p.Watermark = w
+	}
+	for key, obj := range p.Objects {
+		if !obj.LastModified.After(p.Watermark) {
+			delete(p.Objects, key)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProcessedObjects_Filter(t *testing.T) {
+	p := &ProcessedObjects{
+		Watermark: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Objects: map[string]processedObject{
+			"t/done.parquet":      {ETag: `"a"`, LastModified: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+			"t/rewritten.parquet": {ETag: `"b"`, LastModified: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	objects := []S3Object{
+		{Key: "t/old.parquet", LastModified: "2023-12-31T00:00:00Z", ETag: `"x"`},
+		{Key: "t/done.parquet", LastModified: "2024-01-02T00:00:00Z", ETag: `"a"`},
+		{Key: "t/rewritten.parquet", LastModified: "2024-01-02T00:00:00Z", ETag: `"c"`},
+		{Key: "t/late.parquet", LastModified: "2024-01-01T12:00:00Z", ETag: `"d"`},
+		{Key: "t/bad.parquet", LastModified: "not-a-time"},
+	}
+
+	got := p.filter(objects)
+	want := []string{"t/rewritten.parquet", "t/late.parquet", "t/bad.parquet"}
+	if len(got) != len(want) {
+		t.Fatalf("filter returned %d objects, want %d: %v", len(got), len(want), got)
+	}
+	for i, key := range want {
+		if got[i].Key != key {
+			t.Errorf("object %d = %s, want %s", i, got[i].Key, key)
+		}
+	}
+}
+
+func TestProcessedObjects_Compact(t *testing.T) {
+	p := &ProcessedObjects{Objects: make(map[string]processedObject)}
+	p.add([]S3Object{
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z", ETag: `"1"`},
+		{Key: "t/2.parquet", LastModified: "2024-01-02T00:00:00Z", ETag: `"2"`},
+		{Key: "t/3.parquet", LastModified: "2024-01-03T00:00:00Z", ETag: `"3"`},
+		{Key: "t/bad.parquet", LastModified: "not-a-time"},
+	})
+	p.compact(36*time.Hour, time.Time{})
+
+	if want := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC); !p.Watermark.Equal(want) {
+		t.Errorf("Watermark = %v, want %v", p.Watermark, want)
+	}
+	if len(p.Objects) != 2 {
+		t.Errorf("Objects = %v, want t/2.parquet and t/3.parquet", p.Objects)
+	}
+	if _, ok := p.Objects["t/1.parquet"]; ok {
+		t.Error("t/1.parquet not compacted")
+	}
+
+	// The watermark never moves back.
+	p.compact(72*time.Hour, time.Time{})
+	if want := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC); !p.Watermark.Equal(want) {
+		t.Errorf("Watermark = %v, want %v", p.Watermark, want)
+	}
+}
+
+func TestProcessedObjects_CompactLimit(t *testing.T) {
+	p := &ProcessedObjects{Objects: make(map[string]processedObject)}
+	p.add([]S3Object{
+		{Key: "t/1.parquet", LastModified: "2024-01-01T00:00:00Z"},
+		{Key: "t/3.parquet", LastModified: "2024-01-03T00:00:00Z"},
+	})
+	limit := time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC)
+	p.compact(0, limit)
+	if !p.Watermark.Equal(limit) {
+		t.Errorf("Watermark = %v, want limit %v", p.Watermark, limit)
+	}
+	if _, ok := p.Objects["t/3.parquet"]; !ok || len(p.Objects) != 1 {
+		t.Errorf("Objects = %v, want t/3.parquet", p.Objects)
+	}
+}
+
+func TestProcessedObjects_Roundtrip(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	scope := StateScope{Bucket: "bucket", PathPrefix: "data/"}
+
+	p, err := GetProcessedObjects(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetProcessedObjects: %v", err)
+	}
+	if !p.Watermark.IsZero() || len(p.Objects) != 0 {
+		t.Fatalf("expected an empty set, got %+v", p)
+	}
+	p.add([]S3Object{{Key: "data/events/1.parquet", LastModified: "2024-01-01T00:00:00Z", ETag: `"1"`}})
+	if err := SetProcessedObjects(ctx, sc, scope, "events", p); err != nil {
+		t.Fatalf("SetProcessedObjects: %v", err)
+	}
+
+	got, err := GetProcessedObjects(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetProcessedObjects: %v", err)
+	}
+	if obj := got.Objects["data/events/1.parquet"]; obj.ETag != `"1"` {
+		t.Errorf("ETag = %q, want %q", obj.ETag, `"1"`)
+	}
+}
+
+func TestGetProcessedObjects_StartsFromCursor(t *testing.T) {
+	ctx := context.Background()
+	sc := memState{}
+	scope := StateScope{Bucket: "bucket"}
+	cursor := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	if err := SetCursor(ctx, sc, scope, "events", cursor); err != nil {
+		t.Fatalf("SetCursor: %v", err)
+	}
+
+	p, err := GetProcessedObjects(ctx, sc, scope, "events")
+	if err != nil {
+		t.Fatalf("GetProcessedObjects: %v", err)
+	}
+	if !p.Watermark.Equal(cursor) {
+		t.Errorf("Watermark = %v, want cursor %v", p.Watermark, cursor)
+	}
+}
@@ -2,21 +2,178 @@ package client
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
 )
 
 // Spec is the user-facing configuration for the S3 source plugin.
 type Spec struct {
-	Bucket        string `json:"bucket"`
-	Region        string `json:"region"`
-	LocalProfile  string `json:"local_profile,omitempty"`
-	PathPrefix    string `json:"path_prefix,omitempty"`
-	FileType      string `json:"filetype,omitempty"`
-	RowsPerRecord int    `json:"rows_per_record,omitempty"`
-	Concurrency   int    `json:"concurrency,omitempty"`
-	Endpoint      string `json:"endpoint,omitempty"`
-	PathStyle     bool   `json:"path_style,omitempty"`
+	Bucket              string       `json:"bucket"`
+	Region              string       `json:"region"`
+	LocalProfile        string       `json:"local_profile,omitempty"`
+	PathPrefix          string       `json:"path_prefix,omitempty"`
+	Include             []string     `json:"include,omitempty"`
+	Exclude             []string     `json:"exclude,omitempty"`
+	FileType            string       `json:"filetype,omitempty"`
+	RowsPerRecord       int          `json:"rows_per_record,omitempty"`
+	Concurrency         int          `json:"concurrency,omitempty"`
+	Endpoint            string       `json:"endpoint,omitempty"`
+	PathStyle           bool         `json:"path_style,omitempty"`
+	TableFormat         string       `json:"table_format,omitempty"`
+	ReadMode            string       `json:"read_mode,omitempty"`
+	ScratchDir          string       `json:"scratch_dir,omitempty"`
+	SchemaEvolution     string       `json:"schema_evolution,omitempty"`
+	SchemaMismatch      string       `json:"schema_mismatch,omitempty"`
+	Tables              TablesSpec   `json:"tables,omitempty"`
+	Sources             []SourceSpec `json:"sources,omitempty"`
+	StateNamespace      string       `json:"state_namespace,omitempty"`
+	IncrementalMode     string       `json:"incremental_mode,omitempty"`
+	IncrementalLookback string       `json:"incremental_lookback,omitempty"`
+	OnOverwrite         string       `json:"on_overwrite,omitempty"`
+	CheckpointObjects   int          `json:"checkpoint_objects,omitempty"`
+	CheckpointInterval  string       `json:"checkpoint_interval,omitempty"`
+	FullRefresh         []string     `json:"full_refresh,omitempty"`
+	MetadataColumns     []string     `json:"metadata_columns,omitempty"`
+	CqID                string       `json:"cq_id,omitempty"`
+	CqIDColumns         []string     `json:"cq_id_columns,omitempty"`
+	PrimaryKeys         []PrimaryKey `json:"primary_keys,omitempty"`
+	CloudQueryMetadata  string       `json:"cloudquery_metadata,omitempty"`
+	DestinationPath     string       `json:"destination_path,omitempty"`
+	CSV                 CSVSpec      `json:"csv,omitempty"`
+	JSON                JSONSpec     `json:"json,omitempty"`
+}
+
+// SourceSpec is one bucket and prefix synced by a spec with sources. Region,
+// endpoint, path style and profile default to the top-level values; PathStyle
+// is a pointer so that a source can turn path-style addressing off as well.
+type SourceSpec struct {
+	Bucket       string `json:"bucket"`
+	PathPrefix   string `json:"path_prefix,omitempty"`
+	Region       string `json:"region,omitempty"`
+	Endpoint     string `json:"endpoint,omitempty"`
+	PathStyle    *bool  `json:"path_style,omitempty"`
+	LocalProfile string `json:"local_profile,omitempty"`
+	// RoleARN is an IAM role assumed to read the bucket.
+	RoleARN string `json:"role_arn,omitempty"`
+	// TablePrefix is prepended to the names of the tables discovered in the
+	// source, which keeps them apart from same-named tables of other sources.
+	TablePrefix string `json:"table_prefix,omitempty"`
+}
+
+// TablesSpec maps object keys to table names with ordered rules instead of
+// deriving every name from the key's directory.
+type TablesSpec struct {
+	// Rules are evaluated in order against each object key; the first rule
+	// that matches names the object's table.
+	Rules []TableRule `json:"rules,omitempty"`
+	// Unmatched controls objects that match no rule: "normalize" derives the
+	// table name from the key's directory, "ignore" skips the object.
+	Unmatched string `json:"unmatched,omitempty"`
+}
+
+// TableRule maps the object keys matching a glob or a regular expression to a
+// table. Exactly one of Glob and Regex must be set.
+type TableRule struct {
+	// Glob is matched against the whole object key; each wildcard is a
+	// capture group.
+	Glob string `json:"glob,omitempty"`
+	// Regex is matched anywhere in the object key unless anchored.
+	Regex string `json:"regex,omitempty"`
+	// Name is the table name. It may refer to capture groups as ${1} or
+	// ${name}; the expanded name is sanitized like derived names.
+	Name string `json:"name"`
+}
+
+// PrimaryKey declares the primary key columns of the tables whose name
+// matches Table, a table name or glob. The first entry whose Table matches a
+// table applies to it.
+type PrimaryKey struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// CSVSpec configures how CSV objects are parsed when filetype is "csv".
+type CSVSpec struct {
+	// Delimiter is the single character separating fields. Defaults to ",".
+	Delimiter string `json:"delimiter,omitempty"`
+	// QuoteChar is the single character used to quote fields. Defaults to `"`.
+	QuoteChar string `json:"quote_char,omitempty"`
+	// NoHeader disables treating the first row as column names; columns are
+	// then named column_1, column_2, and so on.
+	NoHeader bool `json:"no_header,omitempty"`
+	// NullValues are the field values that are read as NULL. Defaults to [""].
+	NullValues []string `json:"null_values,omitempty"`
+	// InferRows is the number of data rows sampled to infer column types.
+	InferRows int `json:"infer_rows,omitempty"`
+}
+
+// JSONSpec configures schema inference for newline-delimited JSON objects when
+// filetype is "jsonl" or "ndjson".
+type JSONSpec struct {
+	// InferRows is the number of lines sampled per object to infer the schema.
+	InferRows int `json:"infer_rows,omitempty"`
+	// SampleFiles is the number of most recently modified objects per table
+	// whose lines are sampled and merged into the table schema.
+	SampleFiles int `json:"sample_files,omitempty"`
+	// Nested controls how nested objects and arrays are mapped: "struct" maps
+	// them to Arrow structs and lists, "json" maps them to a JSON column.
+	Nested string `json:"nested,omitempty"`
 }
 
+// supportedFileTypes lists the values accepted for filetype.
+var supportedFileTypes = []string{"parquet", "csv", "jsonl", "ndjson", "avro", "arrow"}
+
+// supportedTableFormats lists the values accepted for table_format. An empty
+// table_format reads every object with the configured extension.
+var supportedTableFormats = []string{"delta", "iceberg"}
+
+// supportedReadModes lists the values accepted for read_mode. "download"
+// copies each Parquet object to a temporary file in scratch_dir before
+// decoding it; "stream" fetches row groups with ranged GETs and uses no disk.
+var supportedReadModes = []string{"download", "stream"}
+
+// supportedSchemaEvolutions lists the values accepted for schema_evolution.
+var supportedSchemaEvolutions = []string{"strict", "merge"}
+
+// supportedSchemaMismatches lists the values accepted for schema_mismatch, the
+// policy for objects whose schema does not fit their table: fail discovery,
+// skip the object, skip the whole table, or skip the object and list it in
+// the s3_quarantined_objects table.
+var supportedSchemaMismatches = []string{"fail", "skip_file", "skip_table", "quarantine"}
+
+// supportedIncrementalModes lists the values accepted for incremental_mode.
+// "cursor" syncs objects last modified after the newest synced object;
+// "objects" records the key and ETag of every synced object within the
+// incremental lookback, so objects that appear late are synced too.
+var supportedIncrementalModes = []string{"cursor", "objects"}
+
+// supportedOnOverwrites lists the values accepted for on_overwrite, the
+// handling of objects rewritten in place: "append" syncs their rows again
+// next to the old ones; "replace" tracks each object's ETag, adds the _s3_key
+// column and deletes the old rows of an overwritten object before syncing it.
+var supportedOnOverwrites = []string{"append", "replace"}
+
+// supportedCqIDs lists the values accepted for cq_id, the _cq_id of synced
+// rows: "random" leaves it to the destination; "deterministic" derives a
+// UUIDv5 from each row's object and position, or from cq_id_columns or
+// primary_keys, so rows synced again are upserted.
+var supportedCqIDs = []string{"random", "deterministic"}
+
+// supportedCloudQueryMetadata lists the values accepted for
+// cloudquery_metadata, the handling of the table metadata that CloudQuery
+// destinations such as cq-destination-s3 write to files: "ignore" names tables
+// by their keys; "honor" names tables after the original table and restores
+// its description, title and parent, which renames tables synced before.
+var supportedCloudQueryMetadata = []string{"honor", "ignore"}
+
+// supportedUnmatchedTables lists the values accepted for tables.unmatched.
+var supportedUnmatchedTables = []string{"normalize", "ignore"}
+
 // SetDefaults applies default values for optional fields.
 func (s *Spec) SetDefaults() {
 	if s.FileType == "" {
@@ -25,24 +182,274 @@ func (s *Spec) SetDefaults() {
 	if s.RowsPerRecord == 0 {
 		s.RowsPerRecord = 500
 	}
+	if s.ReadMode == "" {
+		s.ReadMode = "download"
+	}
+	if s.SchemaEvolution == "" {
+		s.SchemaEvolution = "strict"
+	}
+	if s.SchemaMismatch == "" {
+		s.SchemaMismatch = "fail"
+	}
+	if s.IncrementalMode == "" {
+		s.IncrementalMode = "cursor"
+	}
+	if s.IncrementalLookback == "" {
+		s.IncrementalLookback = "24h"
+	}
+	if s.OnOverwrite == "" {
+		s.OnOverwrite = "append"
+	}
+	if s.CqID == "" {
+		s.CqID = "random"
+	}
+	if s.CloudQueryMetadata == "" {
+		s.CloudQueryMetadata = "ignore"
+	}
+	if s.CheckpointObjects == 0 {
+		s.CheckpointObjects = 1000
+	}
+	if s.CheckpointInterval == "" {
+		s.CheckpointInterval = "1m"
+	}
+	if s.Tables.Unmatched == "" {
+		s.Tables.Unmatched = "normalize"
+	}
 	if s.Concurrency == 0 {
 		s.Concurrency = 50
 	}
+	if s.CSV.Delimiter == "" {
+		s.CSV.Delimiter = ","
+	}
+	if s.CSV.QuoteChar == "" {
+		s.CSV.QuoteChar = `"`
+	}
+	if s.CSV.NullValues == nil {
+		s.CSV.NullValues = []string{""}
+	}
+	if s.CSV.InferRows == 0 {
+		s.CSV.InferRows = 1000
+	}
+	if s.JSON.InferRows == 0 {
+		s.JSON.InferRows = 1000
+	}
+	if s.JSON.SampleFiles == 0 {
+		s.JSON.SampleFiles = 10
+	}
+	if s.JSON.Nested == "" {
+		s.JSON.Nested = "struct"
+	}
 }
 
 // Validate checks that required fields are set and values are valid.
 func (s *Spec) Validate() error {
-	if s.Bucket == "" {
-		return fmt.Errorf("bucket is required")
+	if len(s.Sources) > 0 {
+		if s.Bucket != "" || s.PathPrefix != "" {
+			return fmt.Errorf("bucket and path_prefix cannot be combined with sources; add them as a source")
+		}
+		for i, src := range s.Sources {
+			if err := src.validate(s.Region); err != nil {
+				return fmt.Errorf("invalid sources[%d]: %w", i, err)
+			}
+		}
+	} else {
+		if s.Bucket == "" {
+			return fmt.Errorf("bucket is required")
+		}
+		if s.Region == "" {
+			return fmt.Errorf("region is required")
+		}
+	}
+	if strings.Contains(s.StateNamespace, "/") {
+		return fmt.Errorf("state_namespace %q must not contain \"/\"", s.StateNamespace)
 	}
-	if s.Region == "" {
-		return fmt.Errorf("region is required")
+	if s.FileType == "orc" {
+		// ORC needs a decoder for its stripe encodings and there is no Go ORC
+		// reader in the plugin's dependency set; fail early with guidance.
+		return fmt.Errorf("filetype \"orc\" is not supported yet; rewrite ORC tables as parquet to sync them")
 	}
-	if s.FileType != "parquet" {
-		return fmt.Errorf("unsupported filetype: %q; supported: parquet", s.FileType)
+	if !slices.Contains(supportedFileTypes, s.FileType) {
+		return fmt.Errorf("unsupported filetype: %q; supported: %s", s.FileType, strings.Join(supportedFileTypes, ", "))
 	}
 	if s.RowsPerRecord < 1 {
 		return fmt.Errorf("rows_per_record must be at least 1")
 	}
+	if s.TableFormat != "" {
+		if !slices.Contains(supportedTableFormats, s.TableFormat) {
+			return fmt.Errorf("unsupported table_format: %q; supported: %s", s.TableFormat, strings.Join(supportedTableFormats, ", "))
+		}
+		if s.FileType != "parquet" {
+			return fmt.Errorf("table_format %q requires filetype \"parquet\", got %q", s.TableFormat, s.FileType)
+		}
+	}
+	if s.ReadMode != "" && !slices.Contains(supportedReadModes, s.ReadMode) {
+		return fmt.Errorf("unsupported read_mode: %q; supported: %s", s.ReadMode, strings.Join(supportedReadModes, ", "))
+	}
+	if s.SchemaEvolution != "" && !slices.Contains(supportedSchemaEvolutions, s.SchemaEvolution) {
+		return fmt.Errorf("unsupported schema_evolution: %q; supported: %s", s.SchemaEvolution, strings.Join(supportedSchemaEvolutions, ", "))
+	}
+	if s.SchemaMismatch != "" && !slices.Contains(supportedSchemaMismatches, s.SchemaMismatch) {
+		return fmt.Errorf("unsupported schema_mismatch: %q; supported: %s", s.SchemaMismatch, strings.Join(supportedSchemaMismatches, ", "))
+	}
+	if s.IncrementalMode != "" && !slices.Contains(supportedIncrementalModes, s.IncrementalMode) {
+		return fmt.Errorf("unsupported incremental_mode: %q; supported: %s", s.IncrementalMode, strings.Join(supportedIncrementalModes, ", "))
+	}
+	if s.IncrementalMode == "objects" && s.TableFormat != "" {
+		return fmt.Errorf("incremental_mode \"objects\" cannot be used with table_format %q, which syncs by table version", s.TableFormat)
+	}
+	if s.IncrementalLookback != "" {
+		if d, err := time.ParseDuration(s.IncrementalLookback); err != nil || d < 0 {
+			return fmt.Errorf("invalid incremental_lookback %q: must be a non-negative duration such as \"24h\"", s.IncrementalLookback)
+		}
+	}
+	if s.OnOverwrite != "" && !slices.Contains(supportedOnOverwrites, s.OnOverwrite) {
+		return fmt.Errorf("unsupported on_overwrite: %q; supported: %s", s.OnOverwrite, strings.Join(supportedOnOverwrites, ", "))
+	}
+	if s.OnOverwrite == "replace" && s.TableFormat != "" {
+		return fmt.Errorf("on_overwrite \"replace\" cannot be used with table_format %q, whose files are never overwritten", s.TableFormat)
+	}
+	if s.CheckpointObjects < -1 {
+		return fmt.Errorf("checkpoint_objects must be at least 1, or -1 to disable")
+	}
+	if s.CheckpointInterval != "" {
+		if d, err := time.ParseDuration(s.CheckpointInterval); err != nil || d < 0 {
+			return fmt.Errorf("invalid checkpoint_interval %q: must be a non-negative duration such as \"1m\"", s.CheckpointInterval)
+		}
+	}
+	if s.ScratchDir != "" {
+		if s.ReadMode == "stream" {
+			return fmt.Errorf("scratch_dir cannot be used with read_mode \"stream\", which does not use disk")
+		}
+		fi, err := os.Stat(s.ScratchDir)
+		if err != nil {
+			return fmt.Errorf("invalid scratch_dir: %w", err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("invalid scratch_dir: %s is not a directory", s.ScratchDir)
+		}
+	}
+	if _, err := newKeyFilter(s.Include, s.Exclude); err != nil {
+		return err
+	}
+	if (len(s.Include) > 0 || len(s.Exclude) > 0) && s.TableFormat != "" {
+		return fmt.Errorf("include and exclude cannot be used with table_format %q, which reads its file set from the table log", s.TableFormat)
+	}
+	for _, name := range s.MetadataColumns {
+		if !slices.Contains(metadataColumnNames(), name) {
+			return fmt.Errorf("unsupported metadata column: %q; supported: %s", name, strings.Join(metadataColumnNames(), ", "))
+		}
+	}
+	if _, err := newTableMatcher("full_refresh", s.FullRefresh); err != nil {
+		return err
+	}
+	if _, err := newPrimaryKeyRules(s.PrimaryKeys); err != nil {
+		return err
+	}
+	if s.CqID != "" && !slices.Contains(supportedCqIDs, s.CqID) {
+		return fmt.Errorf("unsupported cq_id: %q; supported: %s", s.CqID, strings.Join(supportedCqIDs, ", "))
+	}
+	if len(s.CqIDColumns) > 0 && s.CqID != "deterministic" {
+		return fmt.Errorf("cq_id_columns requires cq_id \"deterministic\"")
+	}
+	for _, name := range s.CqIDColumns {
+		if name == "" {
+			return fmt.Errorf("cq_id_columns must not contain empty column names")
+		}
+	}
+	if s.CloudQueryMetadata != "" && !slices.Contains(supportedCloudQueryMetadata, s.CloudQueryMetadata) {
+		return fmt.Errorf("unsupported cloudquery_metadata: %q; supported: %s", s.CloudQueryMetadata, strings.Join(supportedCloudQueryMetadata, ", "))
+	}
+	if s.DestinationPath != "" {
+		if _, err := newDestinationPathRule(s.DestinationPath); err != nil {
+			return fmt.Errorf("invalid destination_path: %w", err)
+		}
+		if len(s.Tables.Rules) > 0 {
+			return fmt.Errorf("destination_path cannot be used with tables rules; express the layout as a rule instead")
+		}
+		if s.TableFormat != "" {
+			return fmt.Errorf("destination_path cannot be used with table_format %q, which names tables by their root", s.TableFormat)
+		}
+	}
+	if err := s.Tables.validate(); err != nil {
+		return fmt.Errorf("invalid tables: %w", err)
+	}
+	if len(s.Tables.Rules) > 0 && s.TableFormat != "" {
+		return fmt.Errorf("tables rules cannot be used with table_format %q, which names tables by their root", s.TableFormat)
+	}
+	if s.FileType == "csv" {
+		if err := s.CSV.validate(); err != nil {
+			return fmt.Errorf("invalid csv options: %w", err)
+		}
+	}
+	if isJSONFileType(s.FileType) {
+		if err := s.JSON.validate(); err != nil {
+			return fmt.Errorf("invalid json options: %w", err)
+		}
+	}
+	return nil
+}
+
+// incrementalLookback returns the parsed incremental_lookback.
+func (s *Spec) incrementalLookback() time.Duration {
+	d, _ := time.ParseDuration(s.IncrementalLookback)
+	return d
+}
+
+// checkpointInterval returns the parsed checkpoint_interval.
+func (s *Spec) checkpointInterval() time.Duration {
+	d, _ := time.ParseDuration(s.CheckpointInterval)
+	return d
+}
+
+func (s *CSVSpec) validate() error {
+	if utf8.RuneCountInString(s.Delimiter) != 1 {
+		return fmt.Errorf("delimiter must be a single character, got %q", s.Delimiter)
+	}
+	if utf8.RuneCountInString(s.QuoteChar) != 1 {
+		return fmt.Errorf("quote_char must be a single character, got %q", s.QuoteChar)
+	}
+	if s.Delimiter == s.QuoteChar {
+		return fmt.Errorf("delimiter and quote_char must differ")
+	}
+	if s.Delimiter == "\n" || s.Delimiter == "\r" {
+		return fmt.Errorf("delimiter must not be a line break")
+	}
+	if s.InferRows < 1 {
+		return fmt.Errorf("infer_rows must be at least 1")
+	}
+	return nil
+}
+
+func (s *SourceSpec) validate(region string) error {
+	if s.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if s.Region == "" && region == "" {
+		return fmt.Errorf("region is required in the source or at the top level")
+	}
+	if s.TablePrefix != "" && naming.Sanitize(s.TablePrefix) != s.TablePrefix {
+		return fmt.Errorf("table_prefix %q may only contain letters, digits and underscores", s.TablePrefix)
+	}
+	return nil
+}
+
+func (s *TablesSpec) validate() error {
+	if s.Unmatched != "" && !slices.Contains(supportedUnmatchedTables, s.Unmatched) {
+		return fmt.Errorf("unsupported unmatched: %q; supported: %s", s.Unmatched, strings.Join(supportedUnmatchedTables, ", "))
+	}
+	_, err := newTableMapping(*s)
+	return err
+}
+
+func (s *JSONSpec) validate() error {
+	if s.InferRows < 1 {
+		return fmt.Errorf("infer_rows must be at least 1")
+	}
+	if s.SampleFiles < 1 {
+		return fmt.Errorf("sample_files must be at least 1")
+	}
+	if s.Nested != "struct" && s.Nested != "json" {
+		return fmt.Errorf("nested must be one of struct, json; got %q", s.Nested)
+	}
 	return nil
 }
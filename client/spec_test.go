@@ -1,7 +1,10 @@
 package client
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSpec_SetDefaults(t *testing.T) {
@@ -18,6 +21,18 @@ func TestSpec_SetDefaults(t *testing.T) {
 		if s.Concurrency != 50 {
 			t.Errorf("Concurrency = %d, want %d", s.Concurrency, 50)
 		}
+		if s.CSV.Delimiter != "," || s.CSV.QuoteChar != `"` {
+			t.Errorf("CSV delimiter/quote = %q/%q, want %q/%q", s.CSV.Delimiter, s.CSV.QuoteChar, ",", `"`)
+		}
+		if len(s.CSV.NullValues) != 1 || s.CSV.NullValues[0] != "" {
+			t.Errorf("CSV.NullValues = %q, want [\"\"]", s.CSV.NullValues)
+		}
+		if s.CSV.InferRows != 1000 {
+			t.Errorf("CSV.InferRows = %d, want %d", s.CSV.InferRows, 1000)
+		}
+		if s.JSON.InferRows != 1000 || s.JSON.SampleFiles != 10 || s.JSON.Nested != "struct" {
+			t.Errorf("JSON = %+v, want infer_rows 1000, sample_files 10, nested struct", s.JSON)
+		}
 	})
 
 	t.Run("does not override explicit values", func(t *testing.T) {
@@ -83,13 +98,433 @@ func TestSpec_Validate(t *testing.T) {
 
 	t.Run("invalid filetype", func(t *testing.T) {
 		s := validSpec()
-		s.FileType = "csv"
+		s.FileType = "xlsx"
 		err := s.Validate()
 		if err == nil {
 			t.Fatal("expected error for invalid filetype")
 		}
 	})
 
+	t.Run("csv filetype is allowed", func(t *testing.T) {
+		s := validSpec()
+		s.FileType = "csv"
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Errorf("unexpected error for csv: %v", err)
+		}
+	})
+
+	t.Run("csv delimiter must be a single character", func(t *testing.T) {
+		s := validSpec()
+		s.FileType = "csv"
+		s.SetDefaults()
+		s.CSV.Delimiter = "||"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for multi-character delimiter")
+		}
+	})
+
+	t.Run("csv delimiter and quote must differ", func(t *testing.T) {
+		s := validSpec()
+		s.FileType = "csv"
+		s.SetDefaults()
+		s.CSV.Delimiter = `"`
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for delimiter equal to quote_char")
+		}
+	})
+
+	t.Run("jsonl and ndjson filetypes are allowed", func(t *testing.T) {
+		for _, ft := range []string{"jsonl", "ndjson"} {
+			s := validSpec()
+			s.FileType = ft
+			s.SetDefaults()
+			if err := s.Validate(); err != nil {
+				t.Errorf("unexpected error for %s: %v", ft, err)
+			}
+		}
+	})
+
+	t.Run("avro and arrow filetypes are allowed", func(t *testing.T) {
+		for _, ft := range []string{"avro", "arrow"} {
+			s := validSpec()
+			s.FileType = ft
+			s.SetDefaults()
+			if err := s.Validate(); err != nil {
+				t.Errorf("unexpected error for %s: %v", ft, err)
+			}
+		}
+	})
+
+	t.Run("orc filetype is rejected with guidance", func(t *testing.T) {
+		s := validSpec()
+		s.FileType = "orc"
+		s.SetDefaults()
+		err := s.Validate()
+		if err == nil || !strings.Contains(err.Error(), "not supported yet") {
+			t.Fatalf("expected orc to be rejected as not yet supported, got %v", err)
+		}
+	})
+
+	t.Run("delta table_format requires parquet", func(t *testing.T) {
+		s := validSpec()
+		s.TableFormat = "delta"
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.FileType = "csv"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for delta with csv filetype")
+		}
+	})
+
+	t.Run("iceberg table_format requires parquet", func(t *testing.T) {
+		s := validSpec()
+		s.TableFormat = "iceberg"
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.FileType = "avro"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for iceberg with avro filetype")
+		}
+	})
+
+	t.Run("read_mode defaults to download", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.ReadMode != "download" {
+			t.Errorf("ReadMode = %q, want download", s.ReadMode)
+		}
+		s.ReadMode = "mmap"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for unknown read_mode")
+		}
+	})
+
+	t.Run("scratch_dir must be a directory", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		s.ScratchDir = t.TempDir()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.ReadMode = "stream"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for scratch_dir with read_mode stream")
+		}
+		s.ReadMode = "download"
+		s.ScratchDir = filepath.Join(s.ScratchDir, "missing")
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for missing scratch_dir")
+		}
+	})
+
+	t.Run("schema_evolution must be strict or merge", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.SchemaEvolution != "strict" {
+			t.Errorf("SchemaEvolution = %q, want strict", s.SchemaEvolution)
+		}
+		s.SchemaEvolution = "merge"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.SchemaEvolution = "union"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for unknown schema_evolution")
+		}
+	})
+
+	t.Run("schema_mismatch policy", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.SchemaMismatch != "fail" {
+			t.Errorf("SchemaMismatch = %q, want fail", s.SchemaMismatch)
+		}
+		s.SchemaMismatch = "quarantine"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.SchemaMismatch = "ignore"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for unknown schema_mismatch")
+		}
+	})
+
+	t.Run("include and exclude patterns", func(t *testing.T) {
+		s := validSpec()
+		s.Include = []string{"data/**/*.parquet"}
+		s.Exclude = []string{"**/_temporary/**"}
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.Exclude = []string{"backup/[a"}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for invalid exclude pattern")
+		}
+		s.Exclude = nil
+		s.TableFormat = "iceberg"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for include with table_format")
+		}
+	})
+
+	t.Run("sources replace bucket", func(t *testing.T) {
+		s := validSpec()
+		s.Bucket = ""
+		s.Sources = []SourceSpec{{Bucket: "a"}, {Bucket: "b", Region: "eu-west-1", TablePrefix: "eu"}}
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.Bucket = "my-bucket"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for bucket combined with sources")
+		}
+		s.Bucket = ""
+		s.Sources[0].Bucket = ""
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for a source without bucket")
+		}
+		s.Sources[0].Bucket = "a"
+		s.Region = ""
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for a source without region")
+		}
+		s.Region = "us-east-1"
+		s.Sources[1].TablePrefix = "eu-"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an invalid table_prefix")
+		}
+	})
+
+	t.Run("state namespace", func(t *testing.T) {
+		s := validSpec()
+		s.StateNamespace = "prod"
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.StateNamespace = "prod/eu"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for a state_namespace with a slash")
+		}
+	})
+
+	t.Run("incremental mode", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.IncrementalMode != "cursor" || s.IncrementalLookback != "24h" {
+			t.Errorf("defaults = %q, %q; want cursor, 24h", s.IncrementalMode, s.IncrementalLookback)
+		}
+		s.IncrementalMode = "objects"
+		s.IncrementalLookback = "2h30m"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := s.incrementalLookback(); got != 150*time.Minute {
+			t.Errorf("incrementalLookback = %v, want 2h30m", got)
+		}
+		s.IncrementalLookback = "a day"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an invalid incremental_lookback")
+		}
+		s.IncrementalLookback = "24h"
+		s.IncrementalMode = "etag"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an unsupported incremental_mode")
+		}
+		s.IncrementalMode = "objects"
+		s.TableFormat = "delta"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for incremental_mode objects with table_format")
+		}
+	})
+
+	t.Run("on overwrite", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.OnOverwrite != "append" {
+			t.Errorf("OnOverwrite = %q, want append", s.OnOverwrite)
+		}
+		s.OnOverwrite = "replace"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.OnOverwrite = "upsert"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an unsupported on_overwrite")
+		}
+		s.OnOverwrite = "replace"
+		s.TableFormat = "iceberg"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for on_overwrite replace with table_format")
+		}
+	})
+
+	t.Run("checkpoints", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.CheckpointObjects != 1000 || s.CheckpointInterval != "1m" {
+			t.Errorf("defaults = %d, %q; want 1000, 1m", s.CheckpointObjects, s.CheckpointInterval)
+		}
+		s.CheckpointObjects = -1
+		s.CheckpointInterval = "0"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := s.checkpointInterval(); got != 0 {
+			t.Errorf("checkpointInterval = %v, want 0", got)
+		}
+		s.CheckpointObjects = -2
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for checkpoint_objects below -1")
+		}
+		s.CheckpointObjects = 10
+		s.CheckpointInterval = "-1s"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for a negative checkpoint_interval")
+		}
+	})
+
+	t.Run("full refresh", func(t *testing.T) {
+		s := validSpec()
+		s.FullRefresh = []string{"dim_*"}
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.FullRefresh = []string{"dim_[a"}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an invalid full_refresh pattern")
+		}
+	})
+
+	t.Run("metadata columns", func(t *testing.T) {
+		s := validSpec()
+		s.MetadataColumns = []string{"_s3_key", "_s3_row_number"}
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.MetadataColumns = []string{"_s3_size"}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an unsupported metadata column")
+		}
+	})
+
+	t.Run("primary keys", func(t *testing.T) {
+		s := validSpec()
+		s.PrimaryKeys = []PrimaryKey{{Table: "orders", Columns: []string{"order_id"}}}
+		s.SetDefaults()
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.PrimaryKeys = []PrimaryKey{{Table: "orders"}}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for primary_keys without columns")
+		}
+	})
+
+	t.Run("cloudquery metadata", func(t *testing.T) {
+		s := validSpec()
+		s.DestinationPath = "{{TABLE}}/{{UUID}}.{{FORMAT}}"
+		s.SetDefaults()
+		if s.CloudQueryMetadata != "ignore" {
+			t.Errorf("CloudQueryMetadata = %q, want ignore", s.CloudQueryMetadata)
+		}
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.CloudQueryMetadata = "strip"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an unsupported cloudquery_metadata")
+		}
+		s.CloudQueryMetadata = "ignore"
+		s.DestinationPath = "{{UUID}}.{{FORMAT}}"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for a destination_path without {{TABLE}}")
+		}
+		s.DestinationPath = "{{TABLE}}/{{UUID}}.{{FORMAT}}"
+		s.Tables.Rules = []TableRule{{Glob: "exports/**", Name: "orders"}}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for destination_path with tables rules")
+		}
+	})
+
+	t.Run("cq id", func(t *testing.T) {
+		s := validSpec()
+		s.SetDefaults()
+		if s.CqID != "random" {
+			t.Errorf("CqID = %q, want random", s.CqID)
+		}
+		s.CqIDColumns = []string{"id"}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for cq_id_columns with cq_id random")
+		}
+		s.CqID = "deterministic"
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.CqIDColumns = []string{""}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an empty cq_id_columns name")
+		}
+		s.CqIDColumns = nil
+		s.CqID = "uuid"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for an unsupported cq_id")
+		}
+	})
+
+	t.Run("tables rules", func(t *testing.T) {
+		s := validSpec()
+		s.Tables.Rules = []TableRule{{Glob: "exports/*/orders/**", Name: "orders"}}
+		s.SetDefaults()
+		if s.Tables.Unmatched != "normalize" {
+			t.Errorf("Tables.Unmatched = %q, want normalize", s.Tables.Unmatched)
+		}
+		if err := s.Validate(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		s.Tables.Unmatched = "drop"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for unknown tables.unmatched")
+		}
+		s.Tables.Unmatched = "ignore"
+		s.Tables.Rules = []TableRule{{Regex: "exports/(", Name: "orders"}}
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for invalid regex")
+		}
+		s.Tables.Rules = []TableRule{{Glob: "exports/**", Name: "orders"}}
+		s.TableFormat = "delta"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for tables rules with table_format")
+		}
+	})
+
+	t.Run("unknown table_format", func(t *testing.T) {
+		s := validSpec()
+		s.TableFormat = "hudi"
+		s.SetDefaults()
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for unknown table_format")
+		}
+	})
+
+	t.Run("json nested mode must be struct or json", func(t *testing.T) {
+		s := validSpec()
+		s.FileType = "jsonl"
+		s.SetDefaults()
+		s.JSON.Nested = "flatten"
+		if err := s.Validate(); err == nil {
+			t.Fatal("expected error for invalid json.nested")
+		}
+	})
+
 	t.Run("rows_per_record less than 1", func(t *testing.T) {
 		s := validSpec()
 		s.RowsPerRecord = 0
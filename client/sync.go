@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/apache/arrow-go/v18/arrow"
-	"github.com/apache/arrow-go/v18/arrow/array"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/cloudquery/plugin-sdk/v4/message"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
@@ -64,38 +63,35 @@ func (c *Client) syncTables(ctx context.Context, options plugin.SyncOptions, res
 			continue
 		}
 
-		cursor, err := GetCursor(ctx, stateClient, c.spec.Bucket, table.Name)
-		if err != nil {
-			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to read cursor, performing full sync for table")
-			cursor = time.Time{}
+		if dt.quarantine != nil {
+			c.syncQuarantine(table, dt, res)
+			continue
 		}
-
-		objects := filterObjectsByCursor(dt.Objects, cursor)
-
-		c.logger.Info().
-			Str("table", table.Name).
-			Int("total_objects", len(dt.Objects)).
-			Int("new_objects", len(objects)).
-			Bool("incremental", !cursor.IsZero()).
-			Msg("syncing table")
-
-		if len(objects) == 0 {
-			c.logger.Debug().Str("table", table.Name).Msg("no new objects, skipping table")
-			res <- &message.SyncMigrateTable{Table: table}
+		src := dt.source
+		if src == nil {
+			src = c
+		}
+		if !table.IsIncremental {
+			if err := src.syncFullRefreshTable(ctx, table, dt, res); err != nil {
+				return fmt.Errorf("failed to sync table %s: %w", table.Name, err)
+			}
 			continue
 		}
-
-		res <- &message.SyncMigrateTable{Table: table}
-
-		if err := c.syncTableObjects(ctx, table, objects, res); err != nil {
-			return fmt.Errorf("failed to sync table %s: %w", table.Name, err)
+		if dt.delta != nil {
+			if err := src.syncDeltaTable(ctx, stateClient, table, dt, res); err != nil {
+				return fmt.Errorf("failed to sync table %s: %w", table.Name, err)
+			}
+			continue
 		}
-
-		maxMod := maxLastModified(objects)
-		if !maxMod.IsZero() {
-			if err := SetCursor(ctx, stateClient, c.spec.Bucket, table.Name, maxMod); err != nil {
-				c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to set cursor")
+		if dt.iceberg != nil {
+			if err := src.syncIcebergTable(ctx, stateClient, table, dt, res); err != nil {
+				return fmt.Errorf("failed to sync table %s: %w", table.Name, err)
 			}
+			continue
+		}
+
+		if err := src.syncListedTable(ctx, stateClient, table, dt, res); err != nil {
+			return fmt.Errorf("failed to sync table %s: %w", table.Name, err)
 		}
 	}
 
@@ -107,15 +103,107 @@ func (c *Client) syncTables(ctx context.Context, options plugin.SyncOptions, res
 	return nil
 }
 
-// syncTableObjects processes all objects for a single table with concurrency control.
-func (c *Client) syncTableObjects(ctx context.Context, table *schema.Table, objects []S3Object, res chan<- message.SyncMessage) error {
+// syncFullRefreshTable syncs every object of a table selected by full_refresh
+// without reading or recording incremental state. Such tables are not
+// incremental, so with write_mode "overwrite-delete-stale" the CLI deletes
+// the destination rows that this sync did not emit.
+func (c *Client) syncFullRefreshTable(ctx context.Context, table *schema.Table, dt *DiscoveredTable, res chan<- message.SyncMessage) error {
+	c.logger.Info().
+		Str("table", table.Name).
+		Int("total_objects", len(dt.Objects)).
+		Bool("full_refresh", true).
+		Msg("syncing table")
+
+	res <- &message.SyncMigrateTable{Table: table}
+	return c.syncTableObjects(ctx, dt, dt.Objects, res, nil)
+}
+
+// syncListedTable syncs the objects of a table that are new since the state
+// recorded for it with the incremental_mode and records the synced objects.
+// With on_overwrite "replace", objects whose ETag is unchanged are skipped and
+// the rows of overwritten objects are deleted before they are synced again.
+func (c *Client) syncListedTable(ctx context.Context, stateClient state.Client, table *schema.Table, dt *DiscoveredTable, res chan<- message.SyncMessage) error {
+	var (
+		objects     []S3Object
+		processed   *ProcessedObjects
+		incremental bool
+	)
+	if c.spec.IncrementalMode == "objects" {
+		var err error
+		processed, err = GetProcessedObjects(ctx, stateClient, c.stateScope(), table.Name)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to read processed objects, performing full sync for table")
+			processed = &ProcessedObjects{Objects: make(map[string]processedObject)}
+		}
+		objects = processed.filter(dt.Objects)
+		incremental = !processed.Watermark.IsZero() || len(processed.Objects) > 0
+	} else {
+		cursor, err := GetCursor(ctx, stateClient, c.stateScope(), table.Name)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to read cursor, performing full sync for table")
+			cursor = time.Time{}
+		}
+		objects = filterObjectsByCursor(dt.Objects, cursor)
+		incremental = !cursor.IsZero()
+	}
+	selected := objects
+
+	var etags map[string]string
+	var overwritten []S3Object
+	if c.spec.OnOverwrite == "replace" {
+		var err error
+		etags, err = GetObjectETags(ctx, stateClient, c.stateScope(), table.Name)
+		if err != nil {
+			c.logger.Warn().Err(err).Str("table", table.Name).Msg("failed to read object etags, syncing objects without replacing rows")
+		}
+		objects, overwritten = changedObjects(selected, etags)
+	}
+
+	c.logger.Info().
+		Str("table", table.Name).
+		Int("total_objects", len(dt.Objects)).
+		Int("new_objects", len(objects)).
+		Int("overwritten_objects", len(overwritten)).
+		Bool("incremental", incremental).
+		Msg("syncing table")
+
+	res <- &message.SyncMigrateTable{Table: table}
+
+	if len(selected) == 0 {
+		c.logger.Debug().Str("table", table.Name).Msg("no new objects, skipping table")
+		return nil
+	}
+
+	// Delete the rows of overwritten objects before their new rows are
+	// emitted. ETags are only recorded for objects whose rows were emitted, so
+	// after a failed sync the next one deletes and inserts the others again.
+	for _, obj := range overwritten {
+		res <- deleteBySourceKey(table.Name, obj.Key)
+	}
+
+	cp := c.newCheckpointer(stateClient, table.Name, selected, objects, processed, etags)
+	if err := c.syncTableObjects(ctx, dt, cp.ordered(), res, func(obj S3Object) { cp.objectDone(ctx, obj) }); err != nil {
+		return err
+	}
+	cp.finish(ctx, dt.Objects)
+	return nil
+}
+
+// syncTableObjects processes all objects for a single table with concurrency
+// control. If done is not nil, it is called after each object has been
+// emitted, possibly concurrently.
+func (c *Client) syncTableObjects(ctx context.Context, dt *DiscoveredTable, objects []S3Object, res chan<- message.SyncMessage, done func(S3Object)) error {
+	objects = dt.withoutMismatches(objects)
 	concurrency := c.spec.Concurrency
 
 	if concurrency == 1 {
 		for _, obj := range objects {
-			if err := c.syncObject(ctx, table, obj, res); err != nil {
+			if err := c.syncObject(ctx, dt, obj, res); err != nil {
 				return err
 			}
+			if done != nil {
+				done(obj)
+			}
 		}
 		return nil
 	}
@@ -157,12 +245,16 @@ func (c *Client) syncTableObjects(ctx context.Context, table *schema.Table, obje
 			if sem != nil {
 				defer func() { <-sem }()
 			}
-			if err := c.syncObject(ctx, table, o, res); err != nil {
+			if err := c.syncObject(ctx, dt, o, res); err != nil {
 				mu.Lock()
 				if firstErr == nil {
 					firstErr = err
 				}
 				mu.Unlock()
+				return
+			}
+			if done != nil {
+				done(o)
 			}
 		}(obj)
 	}
@@ -172,23 +264,98 @@ func (c *Client) syncTableObjects(ctx context.Context, table *schema.Table, obje
 }
 
 // syncObject streams records from a single S3 object and emits SyncInsert messages.
-func (c *Client) syncObject(ctx context.Context, table *schema.Table, obj S3Object, res chan<- message.SyncMessage) error {
+func (c *Client) syncObject(ctx context.Context, dt *DiscoveredTable, obj S3Object, res chan<- message.SyncMessage) error {
+	var deletes *icebergRowFilter
+	if dt.iceberg != nil {
+		var err error
+		if deletes, err = c.icebergRowFilter(ctx, dt.iceberg, obj); err != nil {
+			return fmt.Errorf("failed to load deletes for %s: %w", obj.Key, err)
+		}
+	}
+
+	metadata := c.spec.metadataColumns()
+	md := objectMetadata{bucket: c.spec.Bucket, object: obj}
+
+	// The version id is taken from the response of the request reading the
+	// object, which the reader stores before sending the first record.
+	var versionID string
 	records := make(chan arrow.RecordBatch, 1)
 	errCh := make(chan error, 1)
 
 	go func() {
 		defer close(records)
-		errCh <- c.streamRecords(ctx, obj.Key, c.spec.RowsPerRecord, records)
+		errCh <- c.streamObject(ctx, obj.Key, dt.ArrowSchema, &versionID, records)
 	}()
 
-	var totalRows int64
+	var totalRows, offset int64
 	for rec := range records {
+		// rows are the positions in the object of the rows of rec, which
+		// Iceberg deletes may leave with gaps.
+		var rows []int64
+		if (len(metadata) > 0 || dt.deterministicCqID) && deletes == nil {
+			rows = rowRange(offset, int(rec.NumRows()))
+		}
+		offset += rec.NumRows()
+		if deletes != nil {
+			filtered, err := deletes.apply(rec)
+			if err != nil {
+				rec.Release()
+				drainRecords(records, errCh)
+				return fmt.Errorf("failed to apply deletes to %s: %w", obj.Key, err)
+			}
+			if filtered != rec {
+				rec.Release()
+			}
+			if filtered == nil {
+				continue
+			}
+			rec = filtered
+			rows = deletes.kept
+		}
+		if c.spec.SchemaEvolution == "merge" {
+			projected, err := projectRecord(rec, dt.ArrowSchema)
+			if err != nil {
+				rec.Release()
+				drainRecords(records, errCh)
+				return fmt.Errorf("failed to conform %s to the schema of table %s: %w", obj.Key, dt.Name, err)
+			}
+			if projected != rec {
+				rec.Release()
+			}
+			rec = projected
+		}
 		totalRows += rec.NumRows()
-		// Add cq:table_name metadata to the Arrow schema so downstream
+		withPartitions := withPartitionColumns(rec, dt.Partitions, obj.Partitions)
+		if withPartitions != rec {
+			rec.Release()
+		}
+		rec = withPartitions
+		md.versionID = versionID
+		withMetadata := withMetadataColumns(rec, metadata, md, rows)
+		if withMetadata != rec {
+			rec.Release()
+		}
+		rec = withMetadata
+		if dt.deterministicCqID {
+			withID, err := withCqIDColumn(rec, dt.Name, dt.cqIDColumns, md, rows)
+			rec.Release()
+			if err != nil {
+				drainRecords(records, errCh)
+				return err
+			}
+			rec = withID
+		}
+		// Set cq:table_name metadata on the Arrow schema so downstream
 		// destination plugins (e.g., cq-destination-postgresql) can identify
 		// which table the record belongs to. The plugin-sdk batchwriter
-		// expects this metadata key to be present on every record batch.
-		rec = withTableMetadata(rec, table.Name)
+		// expects this metadata key to be present on every record batch, and
+		// files written by CloudQuery carry the name of the table they were
+		// written from, which is replaced by the synced table's name.
+		named := withTableName(rec, dt.Name)
+		if named != rec {
+			rec.Release()
+		}
+		rec = named
 		res <- &message.SyncInsert{Record: rec}
 	}
 
@@ -197,17 +364,21 @@ func (c *Client) syncObject(ctx context.Context, table *schema.Table, obj S3Obje
 		if errors.As(err, &noSuchKey) {
 			c.logger.Warn().
 				Str("key", obj.Key).
-				Str("table", table.Name).
+				Str("table", dt.Name).
 				Msg("object deleted between list and read, skipping")
 			return nil
 		}
 
-		if isMalformedParquetError(err) {
+		// Values that do not fit an inferred type (errTypeMismatch) and
+		// malformed contents after records were emitted are not skipped: the
+		// object is partly emitted, so they fail the sync.
+		if errors.Is(err, errMalformedObject) || isMalformedParquetError(err) {
 			c.logger.Warn().
 				Err(err).
 				Str("key", obj.Key).
-				Str("table", table.Name).
-				Msg("malformed parquet file, skipping")
+				Str("table", dt.Name).
+				Str("filetype", c.spec.FileType).
+				Msg("malformed file, skipping")
 			return nil
 		}
 
@@ -216,7 +387,7 @@ func (c *Client) syncObject(ctx context.Context, table *schema.Table, obj S3Obje
 
 	c.logger.Debug().
 		Str("key", obj.Key).
-		Str("table", table.Name).
+		Str("table", dt.Name).
 		Int64("rows", totalRows).
 		Int64("size_bytes", obj.Size).
 		Msg("object synced")
@@ -224,30 +395,13 @@ func (c *Client) syncObject(ctx context.Context, table *schema.Table, obj S3Obje
 	return nil
 }
 
-// withTableMetadata returns a new Arrow RecordBatch whose schema includes
-// the "cq:table_name" metadata key. Destination plugins use this metadata
-// to route records to the correct table during writes.
-func withTableMetadata(rec arrow.RecordBatch, tableName string) arrow.RecordBatch {
-	sc := rec.Schema()
-	md := sc.Metadata()
-
-	// Already has the metadata — nothing to do.
-	if idx := md.FindKey("cq:table_name"); idx >= 0 {
-		return rec
-	}
-
-	mdMap := md.ToMap()
-	mdMap["cq:table_name"] = tableName
-	newMD := arrow.MetadataFrom(mdMap)
-
-	newSchema := arrow.NewSchema(sc.Fields(), &newMD)
-
-	cols := make([]arrow.Array, rec.NumCols())
-	for i := range cols {
-		cols[i] = rec.Column(i)
+// drainRecords releases the remaining records of an object whose sync failed
+// and waits for its reader to finish.
+func drainRecords(records <-chan arrow.RecordBatch, errCh <-chan error) {
+	for rec := range records {
+		rec.Release()
 	}
-	newRec := array.NewRecordBatch(newSchema, cols, rec.NumRows())
-	return newRec
+	<-errCh
 }
 
 // isMalformedParquetError checks if the error is from a malformed Parquet file.
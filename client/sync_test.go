@@ -141,11 +141,11 @@ func makeTestRecordBatch(md *arrow.Metadata) arrow.RecordBatch {
 	return bldr.NewRecord()
 }
 
-func TestWithTableMetadata_AddsMetadata(t *testing.T) {
+func TestWithTableName_AddsMetadata(t *testing.T) {
 	rec := makeTestRecordBatch(nil)
 	defer rec.Release()
 
-	result := withTableMetadata(rec, "my_table")
+	result := withTableName(rec, "my_table")
 	defer result.Release()
 
 	md := result.Schema().Metadata()
@@ -166,14 +166,14 @@ func TestWithTableMetadata_AddsMetadata(t *testing.T) {
 	}
 }
 
-func TestWithTableMetadata_PreservesExistingMetadata(t *testing.T) {
+func TestWithTableName_PreservesExistingMetadata(t *testing.T) {
 	existing := arrow.MetadataFrom(map[string]string{
 		"custom_key": "custom_value",
 	})
 	rec := makeTestRecordBatch(&existing)
 	defer rec.Release()
 
-	result := withTableMetadata(rec, "my_table")
+	result := withTableName(rec, "my_table")
 	defer result.Release()
 
 	md := result.Schema().Metadata()
@@ -187,18 +187,20 @@ func TestWithTableMetadata_PreservesExistingMetadata(t *testing.T) {
 	}
 }
 
-func TestWithTableMetadata_SkipsWhenAlreadyPresent(t *testing.T) {
+func TestWithTableName_OverwritesExisting(t *testing.T) {
 	existing := arrow.MetadataFrom(map[string]string{
 		"cq:table_name": "original_table",
 	})
 	rec := makeTestRecordBatch(&existing)
 	defer rec.Release()
 
-	result := withTableMetadata(rec, "different_table")
+	result := withTableName(rec, "different_table")
+	defer result.Release()
 
-	// Should NOT overwrite — returns the original record
+	// Files written by CloudQuery name the table they were written from,
+	// which must not decide the destination table.
 	md := result.Schema().Metadata()
-	if v, ok := md.GetValue("cq:table_name"); !ok || v != "original_table" {
-		t.Errorf("cq:table_name = %q, want %q (should not overwrite)", v, "original_table")
+	if v, ok := md.GetValue("cq:table_name"); !ok || v != "different_table" {
+		t.Errorf("cq:table_name = %q, want %q", v, "different_table")
 	}
 }
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/infobloxopen/cq-source-s3/internal/glob"
+	"github.com/infobloxopen/cq-source-s3/internal/naming"
+)
+
+// tableMapping names tables from object keys with the rules of the tables
+// option.
+type tableMapping struct {
+	rules           []tableRule
+	ignoreUnmatched bool
+}
+
+// tableRule is a TableRule with its pattern compiled.
+type tableRule struct {
+	pattern *regexp.Regexp
+	name    string
+}
+
+// newTableMapping compiles the rules of the tables option.
+func newTableMapping(spec TablesSpec) (*tableMapping, error) {
+	m := &tableMapping{ignoreUnmatched: spec.Unmatched == "ignore"}
+	for i, r := range spec.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("rule %d: name is required", i)
+		}
+		var (
+			pattern *regexp.Regexp
+			err     error
+		)
+		switch {
+		case r.Glob != "" && r.Regex != "":
+			return nil, fmt.Errorf("rule %d: only one of glob and regex may be set", i)
+		case r.Glob != "":
+			pattern, err = glob.Compile(r.Glob)
+		case r.Regex != "":
+			pattern, err = regexp.Compile(r.Regex)
+		default:
+			return nil, fmt.Errorf("rule %d: glob or regex is required", i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		m.rules = append(m.rules, tableRule{pattern: pattern, name: r.Name})
+	}
+	return m, nil
+}
+
+// tableName returns the table of an object. key is the full object key that
+// rules are matched against; normalizedKey is the key with compression
+// extensions and partition segments removed, used by objects that match no
+// rule. It returns "" if the object belongs to no table.
+func (m *tableMapping) tableName(key, normalizedKey string) string {
+	if m != nil {
+		for _, r := range m.rules {
+			match := r.pattern.FindStringSubmatchIndex(key)
+			if match == nil {
+				continue
+			}
+			return naming.Sanitize(string(r.pattern.ExpandString(nil, r.name, key, match)))
+		}
+		if m.ignoreUnmatched {
+			return ""
+		}
+	}
+	return naming.Normalize(normalizedKey)
+}
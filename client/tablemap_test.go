@@ -0,0 +1,84 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestTableMapping(t *testing.T) {
+	m, err := newTableMapping(TablesSpec{
+		Rules: []TableRule{
+			{Glob: "prod/*/exports/v*/orders/**", Name: "orders"},
+			{Regex: `^prod/(?P<region>[^/]+)/exports/v\d+/([^/]+)/`, Name: "${2}_${region}"},
+		},
+		Unmatched: "normalize",
+	})
+	if err != nil {
+		t.Fatalf("newTableMapping: %v", err)
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"prod/us-east-1/exports/v2/orders/part-0.parquet", "orders"},
+		{"prod/us-east-1/exports/v2/users/part-0.parquet", "users_us_east_1"},
+		{"staging/items/part-0.parquet", "staging_items"},
+	}
+	for _, tc := range tests {
+		if got := m.tableName(tc.key, tc.key); got != tc.want {
+			t.Errorf("tableName(%q) = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+
+	m.ignoreUnmatched = true
+	if got := m.tableName("staging/items/part-0.parquet", "staging/items/part-0.parquet"); got != "" {
+		t.Errorf("tableName of unmatched key = %q, want it ignored", got)
+	}
+
+	var none *tableMapping
+	if got := none.tableName("a/b/part-0.parquet", "a/b/part-0.parquet"); got != "a_b" {
+		t.Errorf("nil mapping tableName = %q, want a_b", got)
+	}
+}
+
+func TestNewTableMapping_Invalid(t *testing.T) {
+	tests := map[string]TableRule{
+		"missing name":     {Glob: "a/*"},
+		"missing pattern":  {Name: "a"},
+		"glob and regex":   {Glob: "a/*", Regex: "a/.*", Name: "a"},
+		"invalid glob":     {Glob: "a/[b", Name: "a"},
+		"invalid regex":    {Regex: "a/(", Name: "a"},
+		"unterminated alt": {Glob: "{a,b", Name: "a"},
+	}
+	for name, rule := range tests {
+		if _, err := newTableMapping(TablesSpec{Rules: []TableRule{rule}}); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestGroupByPrefix_TableRules(t *testing.T) {
+	m, err := newTableMapping(TablesSpec{
+		Rules:     []TableRule{{Glob: "prod/*/exports/v2/orders/**", Name: "orders"}},
+		Unmatched: "ignore",
+	})
+	if err != nil {
+		t.Fatalf("newTableMapping: %v", err)
+	}
+	objects := []S3Object{
+		{Key: "prod/us-east-1/exports/v2/orders/dt=2024-01-01/part-0.parquet.gz"},
+		{Key: "prod/eu-west-1/exports/v2/orders/dt=2024-01-02/part-0.parquet"},
+		{Key: "prod/us-east-1/exports/v2/users/part-0.parquet"},
+	}
+
+	tables := groupByPrefix(objects, m)
+	if len(tables) != 1 || tables[0].Name != "orders" {
+		t.Fatalf("tables = %v, want only orders", tables)
+	}
+	if len(tables[0].Objects) != 2 {
+		t.Errorf("orders has %d objects, want 2", len(tables[0].Objects))
+	}
+	if len(tables[0].Partitions) != 1 || tables[0].Partitions[0].Name != "dt" {
+		t.Errorf("partitions = %v, want dt", tables[0].Partitions)
+	}
+}
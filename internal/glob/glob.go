@@ -0,0 +1,83 @@
+// Package glob compiles shell-style glob patterns over S3 object keys into
+// regular expressions.
+package glob
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Compile converts a glob pattern into a regular expression that matches whole
+// object keys.
+//
+// "*" matches any run of characters within one path segment and "**" matches
+// across segments; "**/" also matches no directory at all, so "a/**/b" matches
+// "a/b". "?" matches one character other than "/", "[...]" is a character
+// class ("[!...]" negates it) and "{a,b}" matches any of the comma-separated
+// literal alternatives. A backslash escapes the next character. Every
+// wildcard, class and alternation is a capture group, numbered from 1 in
+// pattern order.
+func Compile(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("((?:.*/)?)")
+				} else {
+					b.WriteString("(.*)")
+				}
+				continue
+			}
+			b.WriteString("([^/]*)")
+		case '?':
+			b.WriteString("([^/])")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == 0 {
+				// A leading "]" is part of the class.
+				end = strings.IndexByte(pattern[i+2:], ']') + 1
+			}
+			if end <= 0 {
+				return nil, fmt.Errorf("unterminated character class in glob %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("([" + strings.ReplaceAll(class, `\`, `\\`) + "])")
+			i += end + 1
+		case '{':
+			end := strings.IndexByte(pattern[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated alternation in glob %q", pattern)
+			}
+			alts := strings.Split(pattern[i+1:i+end], ",")
+			for j, alt := range alts {
+				alts[j] = regexp.QuoteMeta(alt)
+			}
+			b.WriteString("(" + strings.Join(alts, "|") + ")")
+			i += end
+		case '\\':
+			if i+1 == len(pattern) {
+				return nil, fmt.Errorf("trailing backslash in glob %q", pattern)
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return re, nil
+}
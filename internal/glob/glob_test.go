@@ -0,0 +1,51 @@
+package glob
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		match   bool
+		groups  []string
+	}{
+		{pattern: "data/*.parquet", key: "data/a.parquet", match: true, groups: []string{"a"}},
+		{pattern: "data/*.parquet", key: "data/x/a.parquet", match: false},
+		{pattern: "data/**", key: "data/x/a.parquet", match: true, groups: []string{"x/a.parquet"}},
+		{pattern: "data/**/*.parquet", key: "data/a.parquet", match: true, groups: []string{"", "a"}},
+		{pattern: "data/**/*.parquet", key: "data/x/y/a.parquet", match: true, groups: []string{"x/y/", "a"}},
+		{pattern: "prod/*/exports/v?/orders/**", key: "prod/us-east-1/exports/v2/orders/p.parquet", match: true, groups: []string{"us-east-1", "2", "p.parquet"}},
+		{pattern: "logs/[abc]/*", key: "logs/b/f", match: true, groups: []string{"b", "f"}},
+		{pattern: "logs/[!abc]/*", key: "logs/b/f", match: false},
+		{pattern: "{orders,users}/*", key: "users/f", match: true, groups: []string{"users", "f"}},
+		{pattern: "{orders,users}/*", key: "items/f", match: false},
+		{pattern: `a.b/\*`, key: "a.b/*", match: true, groups: []string{}},
+		{pattern: `a.b/\*`, key: "axb/*", match: false},
+		{pattern: "data/*.parquet", key: "prefix/data/a.parquet", match: false},
+	}
+	for _, tc := range tests {
+		re, err := Compile(tc.pattern)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tc.pattern, err)
+		}
+		m := re.FindStringSubmatch(tc.key)
+		if (m != nil) != tc.match {
+			t.Errorf("Compile(%q) match %q = %v, want %v", tc.pattern, tc.key, m != nil, tc.match)
+			continue
+		}
+		if m != nil && !slices.Equal(m[1:], tc.groups) {
+			t.Errorf("Compile(%q) groups for %q = %q, want %q", tc.pattern, tc.key, m[1:], tc.groups)
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, pattern := range []string{"logs/[abc", "{a,b", `trailing\`} {
+		if _, err := Compile(pattern); err == nil {
+			t.Errorf("Compile(%q) = nil error, want error", pattern)
+		}
+	}
+}
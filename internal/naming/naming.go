@@ -2,6 +2,7 @@
 package naming
 
 import (
+	"net/url"
 	"path"
 	"regexp"
 	"strings"
@@ -43,6 +44,48 @@ func Normalize(key string) string {
 	// Replace path separators with underscores
 	raw = strings.ReplaceAll(raw, "/", "_")
 
+	return Sanitize(raw)
+}
+
+// Partition is a single Hive-style "key=value" segment of an S3 object key.
+type Partition struct {
+	Key   string
+	Value string
+	// RawKey is the key as written in the object key, before sanitizing.
+	RawKey string
+}
+
+// SplitPartitions removes Hive-style "key=value" directory segments from an
+// S3 object key and returns the remaining key together with the partitions in
+// path order. The filename is never treated as a partition. Partition keys are
+// sanitized with the same rules as table names, keeping the key as written in
+// RawKey, and values are URL-unescaped,
+// matching how Hive and Spark escape special characters in partition paths.
+func SplitPartitions(key string) (string, []Partition) {
+	segments := strings.Split(key, "/")
+	kept := make([]string, 0, len(segments))
+	var partitions []Partition
+	for i, seg := range segments {
+		k, v, ok := strings.Cut(seg, "=")
+		if i == len(segments)-1 || !ok || k == "" {
+			kept = append(kept, seg)
+			continue
+		}
+		if unescaped, err := url.PathUnescape(v); err == nil {
+			v = unescaped
+		}
+		partitions = append(partitions, Partition{Key: Sanitize(k), Value: v, RawKey: k})
+	}
+	if len(partitions) == 0 {
+		return key, nil
+	}
+	return strings.Join(kept, "/"), partitions
+}
+
+// Sanitize replaces invalid characters with underscores, collapses consecutive
+// underscores and trims leading and trailing underscores, making raw usable as
+// a table or column name.
+func Sanitize(raw string) string {
 	// Replace invalid characters with underscores
 	raw = invalidChars.ReplaceAllString(raw, "_")
 
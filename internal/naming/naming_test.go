@@ -96,3 +96,98 @@ func TestNormalize(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitPartitions(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		wantKey    string
+		wantParts  []Partition
+		wantNormal string
+	}{
+		{
+			name:       "no partitions",
+			key:        "data/2024/file.parquet",
+			wantKey:    "data/2024/file.parquet",
+			wantNormal: "data_2024",
+		},
+		{
+			name:       "single partition",
+			key:        "events/dt=2024-01-01/part-0.parquet",
+			wantKey:    "events/part-0.parquet",
+			wantParts:  []Partition{{Key: "dt", RawKey: "dt", Value: "2024-01-01"}},
+			wantNormal: "events",
+		},
+		{
+			name:    "multiple partitions keep path order",
+			key:     "logs/web/year=2024/month=01/region=us-east/part-0.parquet",
+			wantKey: "logs/web/part-0.parquet",
+			wantParts: []Partition{
+				{Key: "year", RawKey: "year", Value: "2024"},
+				{Key: "month", RawKey: "month", Value: "01"},
+				{Key: "region", RawKey: "region", Value: "us-east"},
+			},
+			wantNormal: "logs_web",
+		},
+		{
+			name:       "values are url-unescaped",
+			key:        "events/ts=2024-01-01 10%3A00/part-0.parquet",
+			wantKey:    "events/part-0.parquet",
+			wantParts:  []Partition{{Key: "ts", RawKey: "ts", Value: "2024-01-01 10:00"}},
+			wantNormal: "events",
+		},
+		{
+			name:       "partition keys are sanitized",
+			key:        "events/event-type=click/part-0.parquet",
+			wantKey:    "events/part-0.parquet",
+			wantParts:  []Partition{{Key: "event_type", RawKey: "event-type", Value: "click"}},
+			wantNormal: "events",
+		},
+		{
+			name:       "filename with equals sign is not a partition",
+			key:        "events/a=b.parquet",
+			wantKey:    "events/a=b.parquet",
+			wantNormal: "events",
+		},
+		{
+			name:       "segment with empty key is not a partition",
+			key:        "events/=x/part-0.parquet",
+			wantKey:    "events/=x/part-0.parquet",
+			wantNormal: "events_x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKey, gotParts := SplitPartitions(tt.key)
+			if gotKey != tt.wantKey {
+				t.Errorf("SplitPartitions(%q) key = %q, want %q", tt.key, gotKey, tt.wantKey)
+			}
+			if len(gotParts) != len(tt.wantParts) {
+				t.Fatalf("SplitPartitions(%q) partitions = %v, want %v", tt.key, gotParts, tt.wantParts)
+			}
+			for i := range gotParts {
+				if gotParts[i] != tt.wantParts[i] {
+					t.Errorf("partition[%d] = %v, want %v", i, gotParts[i], tt.wantParts[i])
+				}
+			}
+			if got := Normalize(gotKey); got != tt.wantNormal {
+				t.Errorf("Normalize(%q) = %q, want %q", gotKey, got, tt.wantNormal)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"orders":          "orders",
+		"us-east-1/v2":    "us_east_1_v2",
+		"__a..b__":        "a_b",
+		"Events 2024.csv": "Events_2024_csv",
+	}
+	for raw, want := range tests {
+		if got := Sanitize(raw); got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", raw, got, want)
+		}
+	}
+}
@@ -1,12 +1,24 @@
 package test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
 	"github.com/cloudquery/plugin-sdk/v4/message"
 	"github.com/cloudquery/plugin-sdk/v4/plugin"
+	"github.com/cloudquery/plugin-sdk/v4/schema"
+	"github.com/cloudquery/plugin-sdk/v4/types"
+	"github.com/hamba/avro/v2/ocf"
 	"github.com/infobloxopen/cq-source-s3/client"
 	"github.com/infobloxopen/cq-source-s3/internal/testutil"
 	"github.com/rs/zerolog"
@@ -162,3 +174,929 @@ func TestE2E_FullSync(t *testing.T) {
 
 	t.Logf("Sync complete: %d tables, %d inserts, %d total rows", migrateCount, insertCount, totalRows)
 }
+
+// e2eSyncResult summarizes the messages emitted by a Sync call.
+type e2eSyncResult struct {
+	tables  map[string]*schema.Table
+	records map[string][]arrow.RecordBatch
+	rows    map[string]int64
+}
+
+// seedBucket creates a bucket, uploads the given objects and registers cleanup.
+func seedBucket(t *testing.T, bucket string, objects map[string][]byte) {
+	t.Helper()
+	ctx := context.Background()
+	s3Client, err := testutil.NewTestS3Client(ctx)
+	if err != nil {
+		t.Fatalf("NewTestS3Client: %v", err)
+	}
+	if err := testutil.CreateBucket(ctx, s3Client, bucket); err != nil {
+		t.Fatalf("CreateBucket: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := testutil.CleanBucket(ctx, s3Client, bucket); err != nil {
+			t.Logf("CleanBucket: %v", err)
+		}
+	})
+	for key, data := range objects {
+		if err := testutil.UploadObject(ctx, s3Client, bucket, key, data); err != nil {
+			t.Fatalf("UploadObject %s: %v", key, err)
+		}
+	}
+}
+
+// syncBucket configures a plugin client with the given spec and runs a full sync.
+func syncBucket(t *testing.T, spec client.Spec) e2eSyncResult {
+	t.Helper()
+	ctx := context.Background()
+
+	spec.Region = testutil.DefaultRegion
+	spec.Endpoint = testutil.TestEndpoint()
+	spec.PathStyle = true
+	spec.SetDefaults()
+	specBytes, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("json.Marshal spec: %v", err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+
+	logger := zerolog.New(zerolog.NewTestWriter(t)).With().Timestamp().Logger()
+	pluginClient, err := client.Configure(ctx, logger, specBytes, plugin.NewClientOptions{})
+	if err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	defer func() { _ = pluginClient.Close(ctx) }()
+
+	res := make(chan message.SyncMessage, 1000)
+	syncDone := make(chan error, 1)
+	go func() {
+		syncDone <- pluginClient.Sync(ctx, plugin.SyncOptions{Tables: []string{"*"}}, res)
+		close(res)
+	}()
+
+	result := e2eSyncResult{
+		tables:  make(map[string]*schema.Table),
+		records: make(map[string][]arrow.RecordBatch),
+		rows:    make(map[string]int64),
+	}
+	for msg := range res {
+		switch m := msg.(type) {
+		case *message.SyncMigrateTable:
+			result.tables[m.Table.Name] = m.Table
+		case *message.SyncInsert:
+			name, _ := m.Record.Schema().Metadata().GetValue("cq:table_name")
+			result.records[name] = append(result.records[name], m.Record)
+			result.rows[name] += m.Record.NumRows()
+		}
+	}
+	if err := <-syncDone; err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	return result
+}
+
+func TestE2E_HivePartitions(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	sc := testutil.SimpleTestSchema()
+	data, err := testutil.GenerateParquet(sc, 10)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-partitions"
+	seedBucket(t, bucket, map[string][]byte{
+		"events/dt=2024-01-01/part-0.parquet": data,
+		"events/dt=2024-01-02/part-0.parquet": data,
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket})
+
+	table, ok := result.tables["events"]
+	if !ok || len(result.tables) != 1 {
+		t.Fatalf("expected a single events table, got %v", result.tables)
+	}
+	if col := table.Columns.Get("dt"); col == nil || !arrow.TypeEqual(col.Type, arrow.FixedWidthTypes.Date32) {
+		t.Errorf("expected date32 dt partition column, got %v", col)
+	}
+	if result.rows["events"] != 20 {
+		t.Errorf("events rows = %d, want 20", result.rows["events"])
+	}
+	for _, rec := range result.records["events"] {
+		if idx := rec.Schema().FieldIndices("dt"); len(idx) != 1 {
+			t.Errorf("record is missing the dt partition column: %v", rec.Schema())
+		}
+	}
+}
+
+func TestE2E_CSV(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	bucket := "e2e-test-csv"
+	seedBucket(t, bucket, map[string][]byte{
+		"vendors/acme/2024-01.csv": []byte("id,amount,paid\n1,9.99,true\n2,15,false\n3,,true\n"),
+		"vendors/acme/2024-02.csv": []byte("id,amount,paid\n4,1.25,false\n"),
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, FileType: "csv"})
+
+	table, ok := result.tables["vendors_acme"]
+	if !ok {
+		t.Fatalf("expected vendors_acme table, got %v", result.tables)
+	}
+	if col := table.Columns.Get("amount"); col == nil || !arrow.TypeEqual(col.Type, arrow.PrimitiveTypes.Float64) {
+		t.Errorf("expected float64 amount column, got %v", col)
+	}
+	if result.rows["vendors_acme"] != 4 {
+		t.Errorf("vendors_acme rows = %d, want 4", result.rows["vendors_acme"])
+	}
+}
+
+func TestE2E_NDJSON(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	bucket := "e2e-test-ndjson"
+	seedBucket(t, bucket, map[string][]byte{
+		"firehose/2024/01/01/batch-1.jsonl": []byte(`{"level":"info","msg":"start","ctx":{"pid":1}}` + "\n" +
+			`{"level":"warn","msg":"slow","ctx":{"pid":1,"ms":250.5}}` + "\n"),
+		"firehose/2024/01/01/batch-2.jsonl": []byte(`{"level":"info","msg":"done","host":"a"}` + "\n"),
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, FileType: "jsonl"})
+
+	table, ok := result.tables["firehose_2024_01_01"]
+	if !ok {
+		t.Fatalf("expected firehose_2024_01_01 table, got %v", result.tables)
+	}
+	for _, name := range []string{"level", "msg", "ctx", "host"} {
+		if table.Columns.Get(name) == nil {
+			t.Errorf("missing column %q", name)
+		}
+	}
+	if col := table.Columns.Get("ctx"); col != nil && col.Type.ID() != arrow.STRUCT {
+		t.Errorf("ctx type = %v, want struct", col.Type)
+	}
+	if result.rows["firehose_2024_01_01"] != 3 {
+		t.Errorf("rows = %d, want 3", result.rows["firehose_2024_01_01"])
+	}
+}
+
+func TestE2E_GzipCSV(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte("id,name\n1,alice\n2,bob\n")); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	bucket := "e2e-test-gzip"
+	seedBucket(t, bucket, map[string][]byte{
+		"exports/users.csv.gz": buf.Bytes(),
+		"exports/README.gz":    buf.Bytes(),
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, FileType: "csv"})
+
+	if result.rows["exports"] != 2 {
+		t.Errorf("exports rows = %d, want 2", result.rows["exports"])
+	}
+}
+
+func TestE2E_StreamReadMode(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 10)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("gzip write: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("gzip close: %v", err)
+	}
+
+	bucket := "e2e-test-stream"
+	seedBucket(t, bucket, map[string][]byte{
+		"events/part-0.parquet":    data,
+		"events/part-1.parquet.gz": gz.Bytes(),
+	})
+
+	// Stream mode reads row groups with ranged GETs and decompresses the
+	// gzipped object in memory; neither path touches the disk.
+	result := syncBucket(t, client.Spec{Bucket: bucket, ReadMode: "stream"})
+
+	if result.rows["events"] != 20 {
+		t.Errorf("events rows = %d, want 20", result.rows["events"])
+	}
+}
+
+func TestE2E_SchemaEvolution(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	older := writeParquet(t, arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+	}, nil), `[{"id": 1, "name": "alice"}, {"id": 2, "name": "bob"}]`)
+	newer := writeParquet(t, arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "name", Type: arrow.BinaryTypes.String},
+		{Name: "email", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil), `[{"id": 3, "name": "carol", "email": "carol@example.com"}]`)
+
+	bucket := "e2e-test-evolution"
+	seedBucket(t, bucket, map[string][]byte{
+		"users/part-0.parquet": older,
+		"users/part-1.parquet": newer,
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, SchemaEvolution: "merge"})
+
+	table, ok := result.tables["users"]
+	if !ok {
+		t.Fatalf("expected users table, got %v", result.tables)
+	}
+	if col := table.Columns.Get("id"); col == nil || !arrow.TypeEqual(col.Type, arrow.PrimitiveTypes.Int64) {
+		t.Errorf("expected id to be widened to int64, got %v", col)
+	}
+	if table.Columns.Get("email") == nil {
+		t.Error("expected email column from the newer file")
+	}
+	if result.rows["users"] != 3 {
+		t.Errorf("users rows = %d, want 3", result.rows["users"])
+	}
+	for _, rec := range result.records["users"] {
+		if rec.Schema().FieldIndices("email") == nil {
+			t.Errorf("record without email column: %v", rec.Schema())
+		}
+	}
+}
+
+func TestE2E_SchemaMismatchQuarantine(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	simple, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+	different, err := testutil.GenerateParquet(testutil.DifferentTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-quarantine"
+	seedBucket(t, bucket, map[string][]byte{
+		"users/part-0.parquet":  simple,
+		"users/part-1.parquet":  simple,
+		"users/part-2.parquet":  different,
+		"orders/part-0.parquet": simple,
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, SchemaMismatch: "quarantine"})
+
+	if result.rows["users"] != 10 {
+		t.Errorf("users rows = %d, want 10 from the matching files", result.rows["users"])
+	}
+	if result.rows["orders"] != 5 {
+		t.Errorf("orders rows = %d, want 5", result.rows["orders"])
+	}
+	if _, ok := result.tables["s3_quarantined_objects"]; !ok {
+		t.Fatalf("expected s3_quarantined_objects table, got %v", result.tables)
+	}
+	if result.rows["s3_quarantined_objects"] != 1 {
+		t.Errorf("quarantined rows = %d, want 1", result.rows["s3_quarantined_objects"])
+	}
+}
+
+func TestE2E_TableRules(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-table-rules"
+	seedBucket(t, bucket, map[string][]byte{
+		"prod/us-east-1/exports/v2/orders/part-0.parquet": data,
+		"prod/eu-west-1/exports/v2/orders/part-0.parquet": data,
+		"prod/us-east-1/exports/v2/users/part-0.parquet":  data,
+		"tmp/scratch/part-0.parquet":                      data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket: bucket,
+		Tables: client.TablesSpec{
+			Rules: []client.TableRule{
+				{Glob: "prod/*/exports/v*/orders/**", Name: "orders"},
+				{Regex: `^prod/[^/]+/exports/v\d+/([^/]+)/`, Name: "${1}"},
+			},
+			Unmatched: "ignore",
+		},
+	})
+
+	if result.rows["orders"] != 10 {
+		t.Errorf("orders rows = %d, want 10 from both regions", result.rows["orders"])
+	}
+	if result.rows["users"] != 5 {
+		t.Errorf("users rows = %d, want 5", result.rows["users"])
+	}
+	if len(result.tables) != 2 {
+		t.Errorf("tables = %v, want only orders and users", result.tables)
+	}
+}
+
+func TestE2E_IncludeExclude(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-include-exclude"
+	seedBucket(t, bucket, map[string][]byte{
+		"data/orders/part-0.parquet":              data,
+		"data/orders/_temporary/0/part-1.parquet": data,
+		"data/backup/orders/part-0.parquet":       data,
+		"scratch/part-0.parquet":                  data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:  bucket,
+		Include: []string{"data/**"},
+		Exclude: []string{"**/_temporary/**", "data/backup/**"},
+	})
+
+	if result.rows["data_orders"] != 5 {
+		t.Errorf("data_orders rows = %d, want 5 without the _temporary file", result.rows["data_orders"])
+	}
+	if len(result.tables) != 1 {
+		t.Errorf("tables = %v, want only data_orders", result.tables)
+	}
+}
+
+func TestE2E_OnOverwriteReplace(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-on-overwrite"
+	seedBucket(t, bucket, map[string][]byte{
+		"orders/part-0.parquet": data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:      bucket,
+		OnOverwrite: "replace",
+	})
+
+	table := result.tables["orders"]
+	if table == nil || table.Columns.Get("_s3_key") == nil {
+		t.Fatalf("orders table = %v, want an _s3_key column", table)
+	}
+	for _, rec := range result.records["orders"] {
+		idx := rec.Schema().FieldIndices("_s3_key")
+		if len(idx) != 1 {
+			t.Fatalf("record schema %v has no _s3_key field", rec.Schema())
+		}
+		if got := rec.Column(idx[0]).ValueStr(0); got != "orders/part-0.parquet" {
+			t.Errorf("_s3_key = %q, want orders/part-0.parquet", got)
+		}
+	}
+}
+
+func TestE2E_MetadataColumns(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-metadata-columns"
+	seedBucket(t, bucket, map[string][]byte{
+		"orders/part-0.parquet": data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:          bucket,
+		MetadataColumns: []string{"_s3_bucket", "_s3_key", "_s3_etag", "_s3_last_modified", "_s3_row_number", "_s3_version_id"},
+	})
+
+	table := result.tables["orders"]
+	if table == nil {
+		t.Fatal("orders table not discovered")
+	}
+	for _, name := range []string{"_s3_bucket", "_s3_key", "_s3_etag", "_s3_last_modified", "_s3_row_number", "_s3_version_id"} {
+		if table.Columns.Get(name) == nil {
+			t.Errorf("orders has no %s column", name)
+		}
+	}
+	var rowNumbers []string
+	for _, rec := range result.records["orders"] {
+		idx := rec.Schema().FieldIndices("_s3_row_number")
+		if len(idx) != 1 {
+			t.Fatalf("record schema %v has no _s3_row_number field", rec.Schema())
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			rowNumbers = append(rowNumbers, rec.Column(idx[0]).ValueStr(i))
+		}
+		if got := rec.Column(rec.Schema().FieldIndices("_s3_bucket")[0]).ValueStr(0); got != bucket {
+			t.Errorf("_s3_bucket = %q, want %q", got, bucket)
+		}
+	}
+	if want := []string{"0", "1", "2", "3", "4"}; strings.Join(rowNumbers, ",") != strings.Join(want, ",") {
+		t.Errorf("_s3_row_number = %v, want %v", rowNumbers, want)
+	}
+}
+
+func TestE2E_DeterministicCqID(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-deterministic-cq-id"
+	seedBucket(t, bucket, map[string][]byte{
+		"orders/part-0.parquet": data,
+	})
+
+	cqIDs := func(result e2eSyncResult) []string {
+		var ids []string
+		for _, rec := range result.records["orders"] {
+			idx := rec.Schema().FieldIndices("_cq_id")
+			if len(idx) != 1 {
+				t.Fatalf("record schema %v has no _cq_id field", rec.Schema())
+			}
+			for i := 0; i < int(rec.NumRows()); i++ {
+				ids = append(ids, rec.Column(idx[0]).ValueStr(i))
+			}
+		}
+		return ids
+	}
+
+	spec := client.Spec{Bucket: bucket, CqID: "deterministic"}
+	first := syncBucket(t, spec)
+	if col := first.tables["orders"].Columns.Get("_cq_id"); col == nil || !col.PrimaryKey {
+		t.Errorf("_cq_id = %v, want a primary key column", col)
+	}
+	ids := cqIDs(first)
+	if len(ids) != 5 {
+		t.Fatalf("got %d ids, want 5", len(ids))
+	}
+	if again := cqIDs(syncBucket(t, spec)); strings.Join(again, ",") != strings.Join(ids, ",") {
+		t.Errorf("_cq_id on a second sync = %v, want %v", again, ids)
+	}
+}
+
+func TestE2E_PrimaryKeys(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-primary-keys"
+	seedBucket(t, bucket, map[string][]byte{
+		"orders/part-0.parquet": data,
+		"users/part-0.parquet":  data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:      bucket,
+		PrimaryKeys: []client.PrimaryKey{{Table: "ord*", Columns: []string{"id"}}},
+	})
+
+	if got := result.tables["orders"].PrimaryKeys(); strings.Join(got, ",") != "id" {
+		t.Errorf("orders primary keys = %v, want [id]", got)
+	}
+	if got := result.tables["users"].PrimaryKeys(); strings.Join(got, ",") != "_cq_id" {
+		t.Errorf("users primary keys = %v, want [_cq_id]", got)
+	}
+}
+
+func TestE2E_CloudQueryMetadata(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	instances := &schema.Table{
+		Name:        "aws_ec2_instances",
+		Description: "EC2 instances",
+		Columns: schema.ColumnList{
+			{Name: "arn", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "state", Type: arrow.BinaryTypes.String},
+		},
+	}
+	tags := &schema.Table{
+		Name:   "aws_ec2_instance_tags",
+		Parent: instances,
+		Columns: schema.ColumnList{
+			{Name: "arn", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+			{Name: "key", Type: arrow.BinaryTypes.String, PrimaryKey: true, NotNull: true},
+		},
+	}
+
+	bucket := "e2e-test-cloudquery-metadata"
+	seedBucket(t, bucket, map[string][]byte{
+		"exports/aws_ec2_instances/2024/01/02/a.parquet":     writeCloudQueryParquet(t, instances, `[{"arn": "i-1", "state": "running"}]`),
+		"exports/aws_ec2_instances/2024/01/03/b.parquet":     writeCloudQueryParquet(t, instances, `[{"arn": "i-2", "state": "stopped"}]`),
+		"exports/aws_ec2_instance_tags/2024/01/02/c.parquet": writeCloudQueryParquet(t, tags, `[{"arn": "i-1", "key": "env"}]`),
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:             bucket,
+		DestinationPath:    "exports/{{TABLE}}/{{YEAR}}/{{MONTH}}/{{DAY}}/{{UUID}}.{{FORMAT}}",
+		CloudQueryMetadata: "honor",
+	})
+
+	table := result.tables["aws_ec2_instances"]
+	if table == nil {
+		t.Fatalf("aws_ec2_instances not discovered; tables: %v", result.tables)
+	}
+	if table.Description != "EC2 instances" {
+		t.Errorf("Description = %q, want EC2 instances", table.Description)
+	}
+	if got := table.PrimaryKeys(); strings.Join(got, ",") != "arn" {
+		t.Errorf("aws_ec2_instances primary keys = %v, want [arn]", got)
+	}
+	if result.rows["aws_ec2_instances"] != 2 {
+		t.Errorf("aws_ec2_instances rows = %d, want 2", result.rows["aws_ec2_instances"])
+	}
+	child := result.tables["aws_ec2_instance_tags"]
+	if child == nil || child.Parent == nil || child.Parent.Name != "aws_ec2_instances" {
+		t.Errorf("aws_ec2_instance_tags = %v, want a child of aws_ec2_instances", child)
+	}
+}
+
+func TestE2E_FullRefresh(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	bucket := "e2e-test-full-refresh"
+	seedBucket(t, bucket, map[string][]byte{
+		"dim_customers/part-0.parquet": data,
+		"orders/part-0.parquet":        data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Bucket:      bucket,
+		FullRefresh: []string{"dim_*"},
+	})
+
+	if table := result.tables["dim_customers"]; table == nil || table.IsIncremental {
+		t.Errorf("dim_customers = %v, want a full refresh table", table)
+	}
+	if table := result.tables["orders"]; table == nil || !table.IsIncremental {
+		t.Errorf("orders = %v, want an incremental table", table)
+	}
+	if result.rows["dim_customers"] != 5 {
+		t.Errorf("dim_customers rows = %d, want 5", result.rows["dim_customers"])
+	}
+}
+
+func TestE2E_MultipleSources(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	data, err := testutil.GenerateParquet(testutil.SimpleTestSchema(), 5)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	seedBucket(t, "e2e-test-sources-a", map[string][]byte{
+		"orders/part-0.parquet": data,
+		"users/part-0.parquet":  data,
+	})
+	seedBucket(t, "e2e-test-sources-b", map[string][]byte{
+		"orders/part-0.parquet": data,
+		"orders/part-1.parquet": data,
+	})
+
+	result := syncBucket(t, client.Spec{
+		Sources: []client.SourceSpec{
+			{Bucket: "e2e-test-sources-a"},
+			{Bucket: "e2e-test-sources-b", TablePrefix: "b"},
+		},
+	})
+
+	want := map[string]int64{"orders": 5, "users": 5, "b_orders": 10}
+	for name, rows := range want {
+		if result.rows[name] != rows {
+			t.Errorf("%s rows = %d, want %d", name, result.rows[name], rows)
+		}
+	}
+	if len(result.tables) != len(want) {
+		t.Errorf("tables = %v, want %v", result.tables, want)
+	}
+}
+
+func TestE2E_Avro(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	const avroSchema = `{"type":"record","name":"order","fields":[
+		{"name":"id","type":"long"},
+		{"name":"note","type":["string","null"],"default":""},
+		{"name":"ordered_at","type":{"type":"long","logicalType":"timestamp-millis"}},
+		{"name":"order_id","type":{"type":"string","logicalType":"uuid"}}
+	]}`
+	var buf bytes.Buffer
+	enc, err := ocf.NewEncoder(avroSchema, &buf)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	for i, note := range []any{map[string]any{"string": "gift"}, nil} {
+		row := map[string]any{
+			"id":         int64(i + 1),
+			"note":       note,
+			"ordered_at": time.UnixMilli(1700000000000).UTC(),
+			"order_id":   "123e4567-e89b-12d3-a456-426614174000",
+		}
+		if err := enc.Encode(row); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	bucket := "e2e-test-avro"
+	seedBucket(t, bucket, map[string][]byte{
+		"topics/orders/partition=0/orders+0+0000000000.avro": buf.Bytes(),
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, FileType: "avro"})
+
+	table, ok := result.tables["topics_orders"]
+	if !ok {
+		t.Fatalf("expected topics_orders table, got %v", result.tables)
+	}
+	if col := table.Columns.Get("note"); col == nil || col.NotNull {
+		t.Errorf("note column = %+v, want nullable", col)
+	}
+	if col := table.Columns.Get("order_id"); col == nil || !arrow.TypeEqual(col.Type, types.ExtensionTypes.UUID) {
+		t.Errorf("order_id column = %+v, want uuid", col)
+	}
+	if result.rows["topics_orders"] != 2 {
+		t.Errorf("rows = %d, want 2", result.rows["topics_orders"])
+	}
+}
+
+func TestE2E_ArrowIPC(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	sc := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	bldr := array.NewRecordBuilder(memory.DefaultAllocator, sc)
+	defer bldr.Release()
+	bldr.Field(0).(*array.Int64Builder).AppendValues([]int64{1, 2, 3}, nil)
+	bldr.Field(1).(*array.StringBuilder).AppendValues([]string{"a", "b", "c"}, nil)
+	rec := bldr.NewRecordBatch()
+	defer rec.Release()
+
+	var file, stream bytes.Buffer
+	fw, err := ipc.NewFileWriter(&file, ipc.WithSchema(sc))
+	if err != nil {
+		t.Fatalf("NewFileWriter: %v", err)
+	}
+	sw := ipc.NewWriter(&stream, ipc.WithSchema(sc))
+	for _, w := range []interface {
+		Write(arrow.RecordBatch) error
+		Close() error
+	}{fw, sw} {
+		if err := w.Write(rec); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	bucket := "e2e-test-arrow"
+	seedBucket(t, bucket, map[string][]byte{
+		"metrics/hosts.feather": file.Bytes(),
+		"metrics/more.arrows":   stream.Bytes(),
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, FileType: "arrow", RowsPerRecord: 2})
+
+	if _, ok := result.tables["metrics"]; !ok {
+		t.Fatalf("expected metrics table, got %v", result.tables)
+	}
+	if result.rows["metrics"] != 6 {
+		t.Errorf("rows = %d, want 6", result.rows["metrics"])
+	}
+}
+
+func TestE2E_DeltaLake(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	sc := testutil.SimpleTestSchema()
+	data, err := testutil.GenerateParquet(sc, 10)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	const schemaString = `{\"type\":\"struct\",\"fields\":[` +
+		`{\"name\":\"id\",\"type\":\"long\",\"nullable\":true,\"metadata\":{}},` +
+		`{\"name\":\"name\",\"type\":\"string\",\"nullable\":true,\"metadata\":{}},` +
+		`{\"name\":\"day\",\"type\":\"date\",\"nullable\":true,\"metadata\":{}}]}`
+	commit0 := `{"protocol":{"minReaderVersion":1,"minWriterVersion":2}}` + "\n" +
+		`{"metaData":{"id":"e2e","format":{"provider":"parquet","options":{}},"schemaString":"` + schemaString + `","partitionColumns":["day"],"configuration":{},"createdTime":1704067200000}}` + "\n" +
+		`{"add":{"path":"day=2024-01-01/part-0.parquet","partitionValues":{"day":"2024-01-01"},"size":1,"modificationTime":1704067200000,"dataChange":true}}` + "\n"
+	commit1 := `{"add":{"path":"day=2024-01-02/part-0.parquet","partitionValues":{"day":"2024-01-02"},"size":1,"modificationTime":1704153600000,"dataChange":true}}` + "\n"
+	commit2 := `{"remove":{"path":"day=2024-01-01/part-0.parquet","dataChange":false}}` + "\n" +
+		`{"add":{"path":"day=2024-01-01/part-1.parquet","partitionValues":{"day":"2024-01-01"},"size":1,"modificationTime":1704240000000,"dataChange":false}}` + "\n"
+
+	bucket := "e2e-test-delta"
+	seedBucket(t, bucket, map[string][]byte{
+		"lake/events/_delta_log/00000000000000000000.json": []byte(commit0),
+		"lake/events/_delta_log/00000000000000000001.json": []byte(commit1),
+		"lake/events/_delta_log/00000000000000000002.json": []byte(commit2),
+		"lake/events/day=2024-01-01/part-0.parquet":        data,
+		"lake/events/day=2024-01-01/part-1.parquet":        data,
+		"lake/events/day=2024-01-02/part-0.parquet":        data,
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, TableFormat: "delta"})
+
+	table, ok := result.tables["lake_events"]
+	if !ok || len(result.tables) != 1 {
+		t.Fatalf("expected a single lake_events table, got %v", result.tables)
+	}
+	if col := table.Columns.Get("day"); col == nil || !arrow.TypeEqual(col.Type, arrow.FixedWidthTypes.Date32) {
+		t.Errorf("expected date32 day partition column, got %v", col)
+	}
+	// The compacted-away part-0.parquet under day=2024-01-01 must not be read.
+	if result.rows["lake_events"] != 20 {
+		t.Errorf("lake_events rows = %d, want 20", result.rows["lake_events"])
+	}
+}
+
+func TestE2E_Iceberg(t *testing.T) {
+	skipIfNoLocalStack(t)
+
+	sc := testutil.SimpleTestSchema()
+	data, err := testutil.GenerateParquet(sc, 10)
+	if err != nil {
+		t.Fatalf("GenerateParquet: %v", err)
+	}
+
+	const (
+		bucket   = "e2e-test-iceberg"
+		location = "s3://" + bucket + "/lake/orders"
+	)
+	// Position deletes remove the first two rows of the data file.
+	deleteSchema := arrow.NewSchema([]arrow.Field{
+		{Name: "file_path", Type: arrow.BinaryTypes.String},
+		{Name: "pos", Type: arrow.PrimitiveTypes.Int64},
+	}, nil)
+	deletes := writeParquet(t, deleteSchema, `[
+{"file_path": "`+location+`/data/00000-0.parquet", "pos": 0},
+{"file_path": "`+location+`/data/00000-0.parquet", "pos": 1}]`)
+
+	manifestList := writeAvro(t, `{"type":"record","name":"manifest_file","fields":[
+{"name":"manifest_path","type":"string"},
+{"name":"partition_spec_id","type":"int"},
+{"name":"content","type":"int"},
+{"name":"sequence_number","type":"long"},
+{"name":"added_snapshot_id","type":"long"}]}`,
+		map[string]any{"manifest_path": location + "/metadata/m0.avro", "partition_spec_id": int32(0), "content": int32(0), "sequence_number": int64(1), "added_snapshot_id": int64(1)},
+		map[string]any{"manifest_path": location + "/metadata/m1.avro", "partition_spec_id": int32(0), "content": int32(1), "sequence_number": int64(1), "added_snapshot_id": int64(1)},
+	)
+	entrySchema := `{"type":"record","name":"manifest_entry","fields":[
+{"name":"status","type":"int"},
+{"name":"snapshot_id","type":["null","long"],"default":null},
+{"name":"sequence_number","type":["null","long"],"default":null},
+{"name":"data_file","type":{"type":"record","name":"r2","fields":[
+  {"name":"content","type":"int"},
+  {"name":"file_path","type":"string"},
+  {"name":"file_format","type":"string"},
+  {"name":"partition","type":{"type":"record","name":"r102","fields":[]}},
+  {"name":"record_count","type":"long"},
+  {"name":"file_size_in_bytes","type":"long"}]}}]}`
+	dataFile := func(content int32, path string, size int) map[string]any {
+		return map[string]any{
+			"status": int32(1), "snapshot_id": nil, "sequence_number": nil,
+			"data_file": map[string]any{
+				"content": content, "file_path": path, "file_format": "PARQUET",
+				"partition": map[string]any{}, "record_count": int64(10), "file_size_in_bytes": int64(size),
+			},
+		}
+	}
+	dataManifest := writeAvro(t, entrySchema, dataFile(0, location+"/data/00000-0.parquet", len(data)))
+	deleteManifest := writeAvro(t, entrySchema, dataFile(1, location+"/data/00000-0-deletes.parquet", len(deletes)))
+
+	metadata := `{"format-version":2,"location":"` + location + `","current-snapshot-id":1,
+"current-schema-id":0,"schemas":[{"schema-id":0,"type":"struct","fields":[
+  {"id":1,"name":"id","required":true,"type":"long"},{"id":2,"name":"name","required":true,"type":"string"}]}],
+"partition-specs":[{"spec-id":0,"fields":[]}],
+"snapshots":[{"snapshot-id":1,"sequence-number":1,"timestamp-ms":1704067200000,
+  "manifest-list":"` + location + `/metadata/snap-1.avro","summary":{"operation":"overwrite"}}]}`
+
+	seedBucket(t, bucket, map[string][]byte{
+		"lake/orders/metadata/v1.metadata.json":          []byte(metadata),
+		"lake/orders/metadata/version-hint.text":         []byte("1"),
+		"lake/orders/metadata/snap-1.avro":               manifestList,
+		"lake/orders/metadata/m0.avro":                   dataManifest,
+		"lake/orders/metadata/m1.avro":                   deleteManifest,
+		"lake/orders/data/00000-0.parquet":               data,
+		"lake/orders/data/00000-0-deletes.parquet":       deletes,
+		"lake/orders/data/orphaned-not-in-table.parquet": data,
+	})
+
+	result := syncBucket(t, client.Spec{Bucket: bucket, TableFormat: "iceberg"})
+
+	if _, ok := result.tables["lake_orders"]; !ok || len(result.tables) != 1 {
+		t.Fatalf("expected a single lake_orders table, got %v", result.tables)
+	}
+	// The orphaned file is not in the snapshot and two rows are deleted.
+	if result.rows["lake_orders"] != 8 {
+		t.Errorf("lake_orders rows = %d, want 8", result.rows["lake_orders"])
+	}
+}
+
+// writeParquet encodes JSON rows as a Parquet file.
+func writeParquet(t *testing.T, sc *arrow.Schema, rows string) []byte {
+	t.Helper()
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, sc, strings.NewReader(rows))
+	if err != nil {
+		t.Fatalf("RecordFromJSON: %v", err)
+	}
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	w, err := pqarrow.NewFileWriter(sc, &buf, nil, pqarrow.DefaultWriterProps())
+	if err != nil {
+		t.Fatalf("NewFileWriter: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeCloudQueryParquet encodes JSON rows of table as a Parquet file the way
+// cq-destination-s3 does, with the table's Arrow schema and metadata stored.
+func writeCloudQueryParquet(t *testing.T, table *schema.Table, rows string) []byte {
+	t.Helper()
+	sc := table.ToArrowSchema()
+	rec, _, err := array.RecordFromJSON(memory.DefaultAllocator, sc, strings.NewReader(rows))
+	if err != nil {
+		t.Fatalf("RecordFromJSON: %v", err)
+	}
+	defer rec.Release()
+
+	var buf bytes.Buffer
+	w, err := pqarrow.NewFileWriter(sc, &buf, nil, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		t.Fatalf("NewFileWriter: %v", err)
+	}
+	if err := w.Write(rec); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeAvro encodes datums as an Avro object container file.
+func writeAvro(t *testing.T, schema string, datums ...map[string]any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := ocf.NewEncoder(schema, &buf)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	for _, d := range datums {
+		if err := enc.Encode(d); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}